@@ -0,0 +1,106 @@
+// internal/cmd/acknowledge.go
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// acknowledgeListLimit caps how many removed repositories and rewritten
+// refs are printed; the safety state file keeps all of them.
+const acknowledgeListLimit = 20
+
+// acknowledgeCmd clears a safety alert once an operator has reviewed
+// it, which lets sync prune and retention delete snapshots again.
+var acknowledgeCmd = &cobra.Command{
+	Use:   "acknowledge",
+	Short: "Acknowledge a safety alert and resume pruning and retention",
+	Args:  cobra.NoArgs,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rt, err := prepareRuntime()
+		if err != nil {
+			return err
+		}
+		defer rt.Logger.Close()
+
+		return runCancelable(func(ctx context.Context) error {
+			return withLock(rt.Logger, rt.Layout.LockFile, func() error {
+				return executeAcknowledge(rt)
+			})
+		})
+	},
+}
+
+func executeAcknowledge(rt *Runtime) error {
+
+	alert, err := state.LoadSafety(rt.Layout.SafetyStateFile)
+	if err != nil {
+		return err
+	}
+
+	if !alert.Active() {
+		fmt.Println("No unacknowledged safety alert")
+		return nil
+	}
+
+	fmt.Printf("Safety alert raised at %s\n", alert.RaisedAt)
+
+	for _, reason := range alert.Reasons {
+		fmt.Printf("  - %s\n", reason)
+	}
+
+	printAcknowledgeList("Removed repositories", alert.RemovedRepositories)
+	printAcknowledgeList("Deleted or force-updated refs", alert.RewrittenRefs)
+
+	alert.AcknowledgedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := state.SaveSafety(rt.Layout.SafetyStateFile, *alert); err != nil {
+		return fmt.Errorf("save safety state: %w", err)
+	}
+
+	rt.Logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Safety.Acknowledged,
+
+			Details: map[string]any{
+				"raised_at":            alert.RaisedAt,
+				"reasons":              alert.Reasons,
+				"removed_repositories": len(alert.RemovedRepositories),
+				"rewritten_refs":       len(alert.RewrittenRefs),
+			},
+		},
+	)
+
+	fmt.Println()
+	fmt.Println("[OK] Alert acknowledged; pruning and retention resume with the next run")
+
+	return nil
+}
+
+func printAcknowledgeList(label string, items []string) {
+
+	if len(items) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Printf("%s (%d)\n", label, len(items))
+
+	for i, item := range items {
+
+		if i == acknowledgeListLimit {
+			fmt.Printf("  ... and %d more\n", len(items)-i)
+			break
+		}
+
+		fmt.Printf("  - %s\n", item)
+	}
+}
@@ -0,0 +1,141 @@
+// internal/cmd/diff.go
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/flarexes/gitback/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var diffJSON bool
+
+// diffCmd reports what changed between two snapshots: assets added or
+// removed, and every ref created, deleted, or moved.
+var diffCmd = &cobra.Command{
+	Use:   "diff <from> <to>",
+	Short: "Show what changed between two snapshots",
+	Args:  cobra.ExactArgs(2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rt, err := prepareRuntime()
+		if err != nil {
+			return err
+		}
+		defer rt.Logger.Close()
+
+		from, err := snapshot.Resolve(rt.Config, args[0])
+		if err != nil {
+			return err
+		}
+
+		to, err := snapshot.Resolve(rt.Config, args[1])
+		if err != nil {
+			return err
+		}
+
+		return runCancelable(func(ctx context.Context) error {
+
+			diff, err := snapshot.DiffSnapshots(ctx, rt.Config, from, to)
+			if err != nil {
+				return err
+			}
+
+			if diffJSON {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(diff)
+			}
+
+			printDiff(diff)
+
+			return nil
+		})
+	},
+}
+
+func printDiff(diff *snapshot.Diff) {
+
+	fmt.Printf("%s -> %s\n", diff.From, diff.To)
+
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Mirrors) == 0 {
+		fmt.Println()
+		fmt.Println("No changes")
+		return
+	}
+
+	if len(diff.Added) > 0 {
+
+		fmt.Println()
+		fmt.Println("Added")
+
+		for _, asset := range diff.Added {
+			fmt.Printf("  + %-10s %s\n", asset.Kind, asset.Name)
+		}
+	}
+
+	if len(diff.Removed) > 0 {
+
+		fmt.Println()
+		fmt.Println("Removed")
+
+		for _, asset := range diff.Removed {
+			fmt.Printf("  - %-10s %s\n", asset.Kind, asset.Name)
+		}
+	}
+
+	refs := 0
+
+	for _, mirror := range diff.Mirrors {
+
+		fmt.Println()
+		fmt.Println(mirror.Path)
+
+		for _, change := range mirror.Refs {
+			fmt.Printf("  %-12s %s%s\n", change.Change, change.Ref, commitCounts(change))
+		}
+
+		refs += len(mirror.Refs)
+	}
+
+	fmt.Println()
+	fmt.Printf(
+		"%d added, %d removed, %d refs changed in %d mirrors\n",
+		len(diff.Added),
+		len(diff.Removed),
+		refs,
+		len(diff.Mirrors),
+	)
+}
+
+// commitCounts formats the known commit counts of a ref change, e.g.
+// " (+3 -1)".
+func commitCounts(change snapshot.RefChange) string {
+
+	switch {
+	case change.AddedCommits != nil && change.RemovedCommits != nil:
+		return fmt.Sprintf(" (+%d -%d)", *change.AddedCommits, *change.RemovedCommits)
+	case change.AddedCommits != nil:
+		return fmt.Sprintf(" (+%d)", *change.AddedCommits)
+	case change.RemovedCommits != nil:
+		return fmt.Sprintf(" (-%d)", *change.RemovedCommits)
+	default:
+		return ""
+	}
+}
+
+func init() {
+
+	diffCmd.Flags().BoolVar(
+		&diffJSON,
+		"json",
+		false,
+		"Output machine-readable JSON",
+	)
+
+	snapshotCmd.AddCommand(diffCmd)
+}
@@ -79,7 +79,11 @@ func printDoctorReport(report *doctor.Report) {
 			continue
 		}
 
-		fmt.Printf("[FAIL] %s\n", check.Name)
+		if check.Optional {
+			fmt.Printf("[WARN] %s (optional)\n", check.Name)
+		} else {
+			fmt.Printf("[FAIL] %s\n", check.Name)
+		}
 
 		if check.Message != "" {
 			fmt.Printf(
@@ -154,6 +154,8 @@ func existingInstallation(layout runtime.Layout) ([]string, error) {
 		{"mirror state", layout.MirrorsStateFile},
 		{"repository inventory", layout.RepositoryInventoryFile},
 		{"gist inventory", layout.GistInventoryFile},
+		{"wiki inventory", layout.WikiInventoryFile},
+		{"starred inventory", layout.StarredInventoryFile},
 	}
 
 	var found []string
@@ -0,0 +1,120 @@
+// internal/cmd/inspect.go
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/flarexes/gitback/internal/health"
+	"github.com/flarexes/gitback/internal/snapshot"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var inspectJSON bool
+
+// inspectCmd shows what a snapshot holds, from the mirror state embedded
+// at the start of the archive, without extracting it.
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <snapshot>",
+	Short: "Show the repositories, wikis, and gists in a snapshot",
+	Args:  cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rt, err := prepareRuntime()
+		if err != nil {
+			return err
+		}
+		defer rt.Logger.Close()
+
+		archive, err := snapshot.Resolve(rt.Config, args[0])
+		if err != nil {
+			return err
+		}
+
+		return runCancelable(func(ctx context.Context) error {
+
+			data, err := snapshot.ReadMirrorState(ctx, rt.Config, archive)
+			if err != nil {
+				return err
+			}
+
+			if inspectJSON {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(data)
+			}
+
+			printInspection(archive, data)
+
+			return nil
+		})
+	},
+}
+
+func printInspection(archive string, data *state.MirrorState) {
+
+	fmt.Printf("Snapshot: %s\n", archive)
+
+	if manifest, err := snapshot.LoadManifest(archive); err == nil && manifest.Incremental() {
+		fmt.Printf("Parent:   %s\n", manifest.Parent)
+	}
+
+	fmt.Printf("Synced:   %s\n", data.SyncCompletedAt)
+
+	printInspectedAssets("Repositories", data.Repositories)
+
+	if len(data.Wikis) > 0 {
+		printInspectedAssets("Wikis", data.Wikis)
+	}
+
+	if len(data.Gists) > 0 {
+		printInspectedAssets("Gists", data.Gists)
+	}
+
+	if len(data.Starred) > 0 {
+		printInspectedAssets("Starred", data.Starred)
+	}
+}
+
+func printInspectedAssets(label string, assets []state.Asset) {
+
+	fmt.Println()
+	fmt.Printf("%s (%d)\n", label, len(assets))
+
+	for _, asset := range assets {
+
+		switch {
+		case asset.Empty:
+			fmt.Printf("  [EMPTY] %s\n", asset.Name)
+		case asset.LastSuccess:
+			fmt.Printf("  [OK]    %s\n", asset.Name)
+
+			if asset.Description != "" {
+				fmt.Printf("          %s\n", singleLine(asset.Description))
+			}
+
+			if asset.LFSObjects > 0 {
+				fmt.Printf("          LFS: %d objects, %s\n", asset.LFSObjects, health.HumanSize(asset.LFSBytes))
+			}
+		default:
+			fmt.Printf("  [FAIL]  %s\n", asset.Name)
+			fmt.Printf("          %s\n", asset.Error)
+		}
+	}
+}
+
+func init() {
+
+	inspectCmd.Flags().BoolVar(
+		&inspectJSON,
+		"json",
+		false,
+		"Output machine-readable JSON",
+	)
+
+	snapshotCmd.AddCommand(inspectCmd)
+}
@@ -0,0 +1,141 @@
+// internal/cmd/list.go
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flarexes/gitback/internal/health"
+	"github.com/flarexes/gitback/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listJSON   bool
+	listVerify bool
+)
+
+// listCmd shows the snapshots in the output directory, oldest first.
+// It only reads, so it doesn't take the lock.
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots",
+	Args:  cobra.NoArgs,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rt, err := prepareRuntime()
+		if err != nil {
+			return err
+		}
+		defer rt.Logger.Close()
+
+		infos, err := snapshot.Describe(rt.Config.Snapshot.OutputDirectory, listVerify)
+		if err != nil {
+			return err
+		}
+
+		if listJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(infos)
+		}
+
+		if len(infos) == 0 {
+			fmt.Println("No snapshots found")
+			return nil
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(writer, "NAME\tSIZE\tAGE\tCHECKSUM\tFLAGS")
+
+		for _, info := range infos {
+
+			fmt.Fprintf(
+				writer,
+				"%s\t%s\t%s\t%s\t%s\n",
+				info.Name,
+				health.HumanSize(info.Size),
+				snapshotAge(info.CreatedAt),
+				info.Checksum,
+				snapshotFlags(info),
+			)
+		}
+
+		return writer.Flush()
+	},
+}
+
+// snapshotAge formats the time since createdAt in its largest unit,
+// e.g. "3d".
+func snapshotAge(createdAt string) string {
+
+	created, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return "-"
+	}
+
+	age := time.Since(created)
+
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+}
+
+func snapshotFlags(info snapshot.Info) string {
+
+	var flags []string
+
+	if info.Encrypted {
+		flags = append(flags, "encrypted")
+	}
+
+	if info.Incremental {
+		flags = append(flags, "incremental")
+	}
+
+	if info.Repository {
+		flags = append(flags, "repository")
+	}
+
+	if info.Signed {
+		flags = append(flags, "signed")
+	}
+
+	if len(flags) == 0 {
+		return "-"
+	}
+
+	return strings.Join(flags, ",")
+}
+
+func init() {
+
+	listCmd.Flags().BoolVar(
+		&listJSON,
+		"json",
+		false,
+		"Output machine-readable JSON",
+	)
+
+	listCmd.Flags().BoolVar(
+		&listVerify,
+		"verify",
+		false,
+		"Recompute the checksum of every snapshot",
+	)
+
+	snapshotCmd.AddCommand(listCmd)
+}
@@ -0,0 +1,124 @@
+// internal/cmd/ls.go
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/flarexes/gitback/internal/mirror"
+	"github.com/spf13/cobra"
+)
+
+var lsGistsJSON bool
+
+// lsCmd groups listings of what the mirror root holds.
+var lsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List backed up content",
+}
+
+// lsGistsCmd shows the gists in the mirror root with the metadata
+// discovery saved for them, since their directories are only IDs. It
+// only reads, so it doesn't take the lock.
+var lsGistsCmd = &cobra.Command{
+	Use:   "gists",
+	Short: "List backed up gists with their descriptions",
+	Args:  cobra.NoArgs,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rt, err := prepareRuntime()
+		if err != nil {
+			return err
+		}
+		defer rt.Logger.Close()
+
+		gists, err := mirror.ListGistMetadata(rt.Config.Storage.MirrorRoot)
+		if err != nil {
+			return err
+		}
+
+		if lsGistsJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(gists)
+		}
+
+		if len(gists) == 0 {
+			fmt.Println("No gist metadata found. Run: gitback discover")
+			return nil
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(writer, "ID\tVISIBILITY\tFILES\tCOMMENTS\tDESCRIPTION")
+
+		for _, metadata := range gists {
+
+			visibility := "secret"
+
+			if metadata.Gist.GetPublic() {
+				visibility = "public"
+			}
+
+			fmt.Fprintf(
+				writer,
+				"%s\t%s\t%s\t%d\t%s\n",
+				metadata.Gist.GetID(),
+				visibility,
+				gistFiles(metadata),
+				len(metadata.Comments),
+				singleLine(metadata.Gist.GetDescription()),
+			)
+		}
+
+		return writer.Flush()
+	},
+}
+
+// gistFiles lists the file names of a gist, sorted.
+func gistFiles(metadata *mirror.GistMetadata) string {
+
+	names := make([]string, 0, len(metadata.Gist.Files))
+
+	for name := range metadata.Gist.Files {
+		names = append(names, string(name))
+	}
+
+	if len(names) == 0 {
+		return "-"
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, ",")
+}
+
+// singleLine joins a possibly multi-line description into one line, so
+// it can't break a table.
+func singleLine(description string) string {
+
+	line := strings.Join(strings.Fields(description), " ")
+
+	if line == "" {
+		return "-"
+	}
+
+	return line
+}
+
+func init() {
+
+	lsGistsCmd.Flags().BoolVar(
+		&lsGistsJSON,
+		"json",
+		false,
+		"Output machine-readable JSON",
+	)
+
+	lsCmd.AddCommand(lsGistsCmd)
+}
@@ -0,0 +1,35 @@
+// internal/cmd/metadata.go
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var metadataCmd = &cobra.Command{
+	Use:   "metadata",
+	Short: "Export issues, pull requests and comments",
+	Args:  cobra.NoArgs,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rt, err := prepareRuntime()
+		if err != nil {
+			return err
+		}
+		defer rt.Logger.Close()
+
+		if !rt.Config.GitHub.BackupMetadata {
+			fmt.Println("Metadata backup is disabled. Set backup_metadata = true under [github]")
+			return nil
+		}
+
+		return runCancelable(func(ctx context.Context) error {
+			return withLock(rt.Logger, rt.Layout.LockFile, func() error {
+				return executeMetadata(ctx, rt)
+			})
+		})
+	},
+}
@@ -0,0 +1,135 @@
+// internal/cmd/prune.go
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/snapshot"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var pruneDryRun bool
+
+// pruneCmd applies the retention policy outside of snapshot creation,
+// mainly to preview (--dry-run) or apply a changed policy.
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Apply snapshot retention policy",
+	Args:  cobra.NoArgs,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rt, err := prepareRuntime()
+		if err != nil {
+			return err
+		}
+		defer rt.Logger.Close()
+
+		if !rt.Config.Snapshot.RetentionEnabled() {
+			fmt.Println("No retention policy configured, nothing to prune")
+			return nil
+		}
+
+		// A preview doesn't touch anything, so it doesn't need to wait
+		// for a running sync or snapshot.
+		if pruneDryRun {
+			return executePruneDryRun(rt)
+		}
+
+		return runCancelable(func(ctx context.Context) error {
+			return withLock(rt.Logger, rt.Layout.LockFile, func() error {
+
+				decisions, err := snapshot.ApplyRetention(rt.Config, rt.Layout, rt.Logger)
+				if err != nil {
+					return err
+				}
+
+				printRetention(decisions, false)
+
+				return nil
+			})
+		})
+	},
+}
+
+func executePruneDryRun(rt *Runtime) error {
+
+	snapshots, err := snapshot.List(rt.Config.Snapshot.OutputDirectory)
+	if err != nil {
+		return err
+	}
+
+	decisions, err := snapshot.PlanRetention(
+		rt.Config.Snapshot,
+		snapshots,
+		snapshot.Parents(rt.Config.Snapshot.OutputDirectory, snapshots),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	printRetention(decisions, true)
+
+	if alert, err := state.LoadSafety(rt.Layout.SafetyStateFile); err != nil || alert.Active() {
+		fmt.Println("Retention is suspended by an unacknowledged safety alert; nothing is deleted until: gitback acknowledge")
+	}
+
+	return nil
+}
+
+// printRetention lists decisions newest first, with the rules that
+// kept each surviving snapshot.
+func printRetention(decisions []snapshot.RetentionDecision, dryRun bool) {
+
+	if len(decisions) == 0 {
+		fmt.Println("No snapshots found")
+		return
+	}
+
+	deleteLabel := "[DELETED]"
+
+	if dryRun {
+		deleteLabel = "[DELETE]"
+	}
+
+	deleted := 0
+
+	for i := len(decisions) - 1; i >= 0; i-- {
+
+		decision := decisions[i]
+
+		if decision.Keep {
+			fmt.Printf("%-9s %s (%s)\n", "[KEEP]", decision.Snapshot, strings.Join(decision.Rules, ", "))
+			continue
+		}
+
+		deleted++
+		fmt.Printf("%-9s %s\n", deleteLabel, decision.Snapshot)
+	}
+
+	fmt.Println()
+
+	if dryRun {
+		fmt.Printf("%d kept, %d would be deleted (dry run)\n", len(decisions)-deleted, deleted)
+		return
+	}
+
+	fmt.Printf("%d kept, %d deleted\n", len(decisions)-deleted, deleted)
+}
+
+func init() {
+
+	pruneCmd.Flags().BoolVar(
+		&pruneDryRun,
+		"dry-run",
+		false,
+		"show what would be kept and deleted without deleting anything",
+	)
+
+	snapshotCmd.AddCommand(pruneCmd)
+}
@@ -0,0 +1,90 @@
+// internal/cmd/restore.go
+
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/restore"
+	"github.com/flarexes/gitback/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreRepositories []string
+	restoreDestination  string
+	restorePushURL      string
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <snapshot>",
+	Short: "Restore mirrors from a snapshot",
+	Args:  cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rt, err := prepareRuntime()
+		if err != nil {
+			return err
+		}
+		defer rt.Logger.Close()
+
+		opts := restore.Options{
+			Snapshot:     args[0],
+			Repositories: restoreRepositories,
+			Destination:  restoreDestination,
+			PushURL:      restorePushURL,
+		}
+
+		// Default to a directory named after the snapshot in the
+		// current working directory, never the live mirror root.
+		if opts.Destination == "" {
+			opts.Destination = snapshot.Name(filepath.Base(args[0]))
+		}
+
+		// The lock keeps retention from deleting the snapshot while
+		// it is being read.
+		return runCancelable(func(ctx context.Context) error {
+			return withLock(rt.Logger, rt.Layout.LockFile, func() error {
+				return executeRestore(ctx, rt, opts)
+			})
+		})
+	},
+}
+
+func executeRestore(ctx context.Context, rt *Runtime, opts restore.Options) error {
+	logger := rt.Logger
+
+	engine := restore.New(rt.Config, rt.Layout, logger)
+	if err := engine.Restore(ctx, opts); err != nil {
+		logger.Error(logging.Events.Restore.Failed, "", err)
+		return err
+	}
+
+	return nil
+}
+
+func init() {
+
+	restoreCmd.Flags().StringArrayVar(
+		&restoreRepositories,
+		"repo",
+		nil,
+		"restore only this repository (owner/name); may be repeated",
+	)
+
+	restoreCmd.Flags().StringVar(
+		&restoreDestination,
+		"to",
+		"",
+		"directory to extract into (default: ./<snapshot name>)",
+	)
+
+	restoreCmd.Flags().StringVar(
+		&restorePushURL,
+		"push-url",
+		"",
+		"push the branches, tags and notes of restored repositories to this URL; {owner} and {name} are substituted",
+	)
+}
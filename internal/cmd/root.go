@@ -21,8 +21,13 @@ func init() {
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(discoverCmd)
 	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(metadataCmd)
 	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(lsCmd)
 	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(verifyCmd)
 	rootCmd.AddCommand(doctorCmd)
 	rootCmd.AddCommand(healthCmd)
+	rootCmd.AddCommand(acknowledgeCmd)
 }
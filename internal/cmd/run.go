@@ -6,6 +6,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var runAlways bool
+
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run the full GitBack backup workflow",
@@ -17,3 +19,13 @@ var runCmd = &cobra.Command{
 		return runCancelable(executeRun)
 	},
 }
+
+func init() {
+
+	runCmd.Flags().BoolVar(
+		&runAlways,
+		"always",
+		false,
+		"create a snapshot even if no mirror changed since the latest one",
+	)
+}
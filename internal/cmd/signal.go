@@ -14,9 +14,9 @@ import (
 // (Ctrl+C) or SIGTERM.
 //
 // Every execute* function in this package already threads its ctx
-// parameter down into exec.CommandContext for git/tar/zstd subprocesses,
-// so once fn receives a context that is actually wired to the OS
-// signal, an in-flight subprocess is killed automatically the moment a
+// parameter down into exec.CommandContext for git subprocesses and into
+// the in-process snapshot writer, so once fn receives a context that is
+// actually wired to the OS signal, in-flight work stops the moment a
 // signal arrives — no further plumbing is needed downstream. Before
 // this, every call site passed context.Background(), which can never be
 // canceled, so that existing ctx plumbing had nothing to respond to.
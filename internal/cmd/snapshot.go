@@ -9,6 +9,7 @@ import (
 )
 
 var snapshotForce bool
+var snapshotAlways bool
 
 var snapshotCmd = &cobra.Command{
 	Use:   "snapshot",
@@ -26,7 +27,7 @@ var snapshotCmd = &cobra.Command{
 		// is also respected, not just once inside executeSnapshot.
 		return runCancelable(func(ctx context.Context) error {
 			return withLock(rt.Logger, rt.Layout.LockFile, func() error {
-				return executeSnapshot(ctx, rt, snapshotForce)
+				return executeSnapshot(ctx, rt, snapshotForce, snapshotAlways)
 			})
 		})
 	},
@@ -40,4 +41,11 @@ func init() {
 		false,
 		"continue snapshot creation when repository/mirror health checks fail",
 	)
+
+	snapshotCmd.Flags().BoolVar(
+		&snapshotAlways,
+		"always",
+		false,
+		"create a snapshot even if no mirror changed since the latest one",
+	)
 }
@@ -0,0 +1,185 @@
+// internal/cmd/verify.go
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/flarexes/gitback/internal/snapshot"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/flarexes/gitback/internal/verify"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyAll    bool
+	verifyLatest bool
+)
+
+// verifyCmd checks snapshots end to end. With no arguments it verifies
+// the latest snapshot, which is what a scheduled job usually wants.
+var verifyCmd = &cobra.Command{
+	Use:   "verify [snapshot...]",
+	Short: "Verify snapshot integrity",
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if len(args) > 0 && (verifyAll || verifyLatest) {
+			return fmt.Errorf("snapshot arguments cannot be combined with --all or --latest")
+		}
+
+		if verifyAll && verifyLatest {
+			return fmt.Errorf("--all and --latest are mutually exclusive")
+		}
+
+		rt, err := prepareRuntime()
+		if err != nil {
+			return err
+		}
+		defer rt.Logger.Close()
+
+		return runCancelable(func(ctx context.Context) error {
+			return withLock(rt.Logger, rt.Layout.LockFile, func() error {
+				return executeVerify(ctx, rt, args)
+			})
+		})
+	},
+}
+
+func executeVerify(ctx context.Context, rt *Runtime, args []string) error {
+
+	archives, err := verifyTargets(rt, args)
+	if err != nil {
+		return err
+	}
+
+	engine := verify.New(rt.Config, rt.Layout, rt.Logger)
+
+	results, err := engine.Run(ctx, archives)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+
+	for _, result := range results {
+
+		printVerification(result)
+
+		if !result.Success {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d snapshots failed verification", failed, len(results))
+	}
+
+	return nil
+}
+
+// verifyTargets resolves the snapshots to verify from arguments/flags.
+func verifyTargets(rt *Runtime, args []string) ([]string, error) {
+
+	var archives []string
+
+	for _, arg := range args {
+
+		archive, err := snapshot.Resolve(rt.Config, arg)
+		if err != nil {
+			return nil, err
+		}
+
+		archives = append(archives, archive)
+	}
+
+	if len(archives) > 0 {
+		return archives, nil
+	}
+
+	names, err := snapshot.List(rt.Config.Snapshot.OutputDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no snapshots found in %s", rt.Config.Snapshot.OutputDirectory)
+	}
+
+	if !verifyAll {
+		names = names[len(names)-1:]
+	}
+
+	for _, name := range names {
+		archives = append(
+			archives,
+			filepath.Join(rt.Config.Snapshot.OutputDirectory, name),
+		)
+	}
+
+	return archives, nil
+}
+
+func printVerification(result state.SnapshotVerification) {
+
+	if result.Success {
+
+		signed := "unsigned"
+
+		switch {
+		case result.SignatureValid && result.KeyPinned:
+			signed = "signed"
+		case result.SignatureValid:
+			signed = "unpinned key, authenticity not checked"
+		}
+
+		fmt.Printf("[OK]   %s (%d mirrors, %s)\n", result.Snapshot, result.Mirrors, signed)
+
+		for _, relative := range result.Unexpected {
+			fmt.Printf("       Not in mirror state: %s\n", relative)
+		}
+
+		return
+	}
+
+	fmt.Printf("[FAIL] %s\n", result.Snapshot)
+
+	if result.Error != "" {
+		fmt.Printf("       Reason: %s\n", result.Error)
+	}
+
+	for _, relative := range result.FsckFailed {
+		fmt.Printf("       Corrupt mirror: %s\n", relative)
+	}
+
+	for _, name := range result.Missing {
+		fmt.Printf("       Missing mirror: %s\n", name)
+	}
+
+	for _, name := range result.MissingReleases {
+		fmt.Printf("       Missing release file: %s\n", name)
+	}
+
+	for _, name := range result.CorruptReleases {
+		fmt.Printf("       Corrupt release file: %s\n", name)
+	}
+}
+
+func init() {
+
+	verifyCmd.Flags().BoolVar(
+		&verifyAll,
+		"all",
+		false,
+		"verify every snapshot in the output directory",
+	)
+
+	verifyCmd.Flags().BoolVar(
+		&verifyLatest,
+		"latest",
+		false,
+		"verify only the most recent snapshot (default)",
+	)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/flarexes/gitback/internal/filesystem"
 	"github.com/flarexes/gitback/internal/lock"
 	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/metadata"
 	"github.com/flarexes/gitback/internal/mirror"
 	"github.com/flarexes/gitback/internal/runtime"
 	"github.com/flarexes/gitback/internal/snapshot"
@@ -92,7 +93,12 @@ func executeRun(ctx context.Context) error {
 		if err := executeSync(ctx, rt); err != nil {
 			return err
 		}
-		return executeSnapshot(ctx, rt, true)
+		if rt.Config.GitHub.BackupMetadata {
+			if err := executeMetadata(ctx, rt); err != nil {
+				return err
+			}
+		}
+		return executeSnapshot(ctx, rt, true, runAlways)
 	})
 }
 
@@ -127,12 +133,25 @@ func executeSync(ctx context.Context, rt *Runtime) error {
 	return nil
 }
 
-func executeSnapshot(ctx context.Context, rt *Runtime, force bool) error {
+func executeMetadata(ctx context.Context, rt *Runtime) error {
+	engine, err := metadata.New(rt.Config, rt.Layout, rt.Logger)
+	if err != nil {
+		return err
+	}
+
+	if err := engine.Export(ctx); err != nil {
+		return fmt.Errorf("metadata export failed: %w", err)
+	}
+
+	return nil
+}
+
+func executeSnapshot(ctx context.Context, rt *Runtime, force bool, always bool) error {
 	logger := rt.Logger
 	logger.Info(logging.Events.Snapshot.Started, "")
 
 	engine := snapshot.New(rt.Config, rt.Layout, logger)
-	if err := engine.Create(ctx, force); err != nil {
+	if err := engine.Create(ctx, force, always); err != nil {
 		logger.Error(logging.Events.Snapshot.Failed, "", err)
 		return err
 	}
@@ -5,8 +5,11 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/flarexes/gitback/internal/runtime"
 	"github.com/spf13/viper"
@@ -14,35 +17,266 @@ import (
 
 type Config struct {
 	GitHub   GitHubConfig
+	Filter   FilterConfig
 	Storage  StorageConfig
 	Sync     SyncConfig
 	Snapshot SnapshotConfig
+	Safety   SafetyConfig
 	Health   HealthConfig
+
+	// Offsite lists the [[offsite]] targets new snapshots are copied to.
+	Offsite []OffsiteConfig `mapstructure:"offsite"`
 }
 
 type GitHubConfig struct {
 	BackupGists bool `mapstructure:"backup_gists"`
+	BackupWikis bool `mapstructure:"backup_wikis"`
+
+	// BackupMetadata exports issues, pull requests, their comments,
+	// labels and milestones, which a git mirror doesn't contain.
+	BackupMetadata bool `mapstructure:"backup_metadata"`
+
+	// BackupReleases downloads the notes and assets of every release.
+	// MaxReleaseAssetMB skips assets larger than this; 0 disables the
+	// limit.
+	BackupReleases    bool `mapstructure:"backup_releases"`
+	MaxReleaseAssetMB int  `mapstructure:"max_release_asset_mb"`
+
+	// BackupStarred mirrors the repositories the account starred. They
+	// belong to third parties, so they are synced with their own worker
+	// budget and their failures never stop a snapshot.
+	BackupStarred bool `mapstructure:"backup_starred"`
+
+	// Organizations lists GitHub organizations whose repositories are
+	// discovered in addition to the authenticated user's own listing.
+	Organizations []string `mapstructure:"organizations"`
+}
+
+// FilterConfig selects which discovered repositories are backed up.
+// Include/Exclude are glob patterns matched against "owner/name".
+type FilterConfig struct {
+	Include []string `mapstructure:"include"`
+	Exclude []string `mapstructure:"exclude"`
+
+	ExcludeForks    bool `mapstructure:"exclude_forks"`
+	ExcludeArchived bool `mapstructure:"exclude_archived"`
+	ExcludePrivate  bool `mapstructure:"exclude_private"`
+	ExcludePublic   bool `mapstructure:"exclude_public"`
+
+	// Topics, when set, keeps only repositories tagged with at least
+	// one of them.
+	Topics []string `mapstructure:"topics"`
+
+	// MaxSizeMB skips repositories larger than this. 0 disables the limit.
+	MaxSizeMB int `mapstructure:"max_size_mb"`
 }
 
 type StorageConfig struct {
 	MirrorRoot string `mapstructure:"mirror_root"`
+
+	// ArchiveGracePeriod, in keep_within syntax, is how long mirrors of
+	// repositories removed from the inventory stay archived before they
+	// are purged. Empty keeps them forever.
+	ArchiveGracePeriod string `mapstructure:"archive_grace_period"`
 }
 
+// Snapshot modes.
+const (
+	SnapshotModeFull        = "full"
+	SnapshotModeIncremental = "incremental"
+)
+
+// Snapshot backends.
+const (
+	SnapshotBackendArchive    = "archive"
+	SnapshotBackendRepository = "repository"
+)
+
 type SnapshotConfig struct {
 	OutputDirectory string `mapstructure:"output_directory"`
-	Retention       int    `mapstructure:"retention"`
+
+	// Backend is "archive" for self-contained .tar.zst files, or
+	// "repository" to store deduplicated chunks once under the output
+	// directory and each snapshot as a small index of them.
+	Backend string `mapstructure:"backend"`
+
+	// Mode is "full" or "incremental". Incremental snapshots only hold
+	// git bundles of what changed since the previous snapshot; every
+	// FullEvery-th snapshot is full again, which bounds restore chains.
+	Mode      string `mapstructure:"mode"`
+	FullEvery int    `mapstructure:"full_every"`
+
+	// Retention keeps the newest N snapshots. The keep_* rules below
+	// add calendar-based policies; a snapshot survives if any rule
+	// keeps it.
+	Retention   int    `mapstructure:"retention"`
+	KeepDaily   int    `mapstructure:"keep_daily"`
+	KeepWeekly  int    `mapstructure:"keep_weekly"`
+	KeepMonthly int    `mapstructure:"keep_monthly"`
+	KeepYearly  int    `mapstructure:"keep_yearly"`
+	KeepWithin  string `mapstructure:"keep_within"`
+
+	Encryption EncryptionConfig `mapstructure:"encryption"`
+	Signing    SigningConfig    `mapstructure:"signing"`
+}
+
+// SigningConfig controls how snapshot manifest signatures are checked.
+// Manifests are always signed with the key under the state directory;
+// PublicKey (base64 ed25519) pins the key `gitback verify` accepts,
+// which is how a separate backup host proves where archives came from.
+type SigningConfig struct {
+	PublicKey string `mapstructure:"public_key"`
+}
+
+// RetentionEnabled reports whether any retention rule is configured.
+// With none, snapshots are never deleted.
+func (c SnapshotConfig) RetentionEnabled() bool {
+	return c.Retention > 0 ||
+		c.KeepDaily > 0 ||
+		c.KeepWeekly > 0 ||
+		c.KeepMonthly > 0 ||
+		c.KeepYearly > 0 ||
+		c.KeepWithin != ""
+}
+
+// ParseKeepWithin parses a keep_within value such as "14d". Supported
+// units are h (hours), d (days), w (weeks), m (30-day months), and
+// y (365-day years).
+func ParseKeepWithin(value string) (time.Duration, error) {
+
+	value = strings.TrimSpace(value)
+
+	if len(value) < 2 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := map[byte]time.Duration{
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+		'm': 30 * 24 * time.Hour,
+		'y': 365 * 24 * time.Hour,
+	}
+
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid duration %q: unit must be one of h, d, w, m, y", value)
+	}
+
+	count, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	return time.Duration(count) * unit, nil
+}
+
+// EncryptionConfig enables age encryption of snapshots. Snapshots are
+// encrypted either to X25519 Recipients or with the passphrase stored in
+// PassphraseFile, never both.
+//
+// IdentityFile is only needed to read encrypted snapshots back (restore,
+// verify) and usually lives on a different machine than the recipients.
+type EncryptionConfig struct {
+	Recipients     []string `mapstructure:"recipients"`
+	PassphraseFile string   `mapstructure:"passphrase_file"`
+	IdentityFile   string   `mapstructure:"identity_file"`
+}
+
+// Enabled reports whether new snapshots are encrypted.
+func (c EncryptionConfig) Enabled() bool {
+	return len(c.Recipients) > 0 || c.PassphraseFile != ""
+}
+
+// Offsite target types.
+const (
+	OffsiteS3   = "s3"
+	OffsiteSFTP = "sftp"
+)
+
+// OffsiteConfig describes one [[offsite]] replication target. Which
+// fields apply depends on Type.
+type OffsiteConfig struct {
+	// Name identifies the target in output, logs, and state. It
+	// defaults to a description derived from the other fields.
+	Name string `mapstructure:"name"`
+	Type string `mapstructure:"type"`
+
+	// S3-compatible object storage. Endpoint is a URL such as
+	// "https://s3.amazonaws.com" or "http://localhost:9000". Credentials
+	// fall back to AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY.
+	Endpoint            string `mapstructure:"endpoint"`
+	Region              string `mapstructure:"region"`
+	Bucket              string `mapstructure:"bucket"`
+	Prefix              string `mapstructure:"prefix"`
+	AccessKeyID         string `mapstructure:"access_key_id"`
+	SecretAccessKeyFile string `mapstructure:"secret_access_key_file"`
+
+	// PartSizeMB is the multipart upload part size; 0 uses the default.
+	PartSizeMB int `mapstructure:"part_size_mb"`
+
+	// SFTP over SSH. Host may include a port ("backup.example.com:2222").
+	// The host key must be listed in KnownHostsFile, which defaults to
+	// ~/.ssh/known_hosts.
+	Host           string `mapstructure:"host"`
+	User           string `mapstructure:"user"`
+	IdentityFile   string `mapstructure:"identity_file"`
+	KnownHostsFile string `mapstructure:"known_hosts_file"`
+	Directory      string `mapstructure:"directory"`
+}
+
+// DisplayName returns Name, or a description of the target when unset.
+func (c OffsiteConfig) DisplayName() string {
+
+	if c.Name != "" {
+		return c.Name
+	}
+
+	switch c.Type {
+	case OffsiteS3:
+		return "s3://" + path.Join(c.Bucket, c.Prefix)
+	case OffsiteSFTP:
+		return "sftp://" + c.User + "@" + c.Host + "/" + strings.TrimPrefix(c.Directory, "/")
+	}
+
+	return c.Type
 }
 
 type SyncConfig struct {
 	Workers       int `mapstructure:"workers"`
 	RetryAttempts int `mapstructure:"retry_attempts"`
+
+	// PreserveRefs keeps refs that an update deletes or rewrites
+	// (force-push) under refs/gitback/preserved/, so the history they
+	// pointed to survives in the mirror. PreservedRefsKeepWithin, in
+	// keep_within syntax, expires them; empty keeps them forever.
+	PreserveRefs            bool   `mapstructure:"preserve_refs"`
+	PreservedRefsKeepWithin string `mapstructure:"preserved_refs_keep_within"`
+
+	// LFS fetches the Git LFS objects of mirrors whose .gitattributes
+	// track files with LFS, which a plain mirror clone leaves out.
+	LFS bool `mapstructure:"lfs"`
+
+	// StarredWorkers and StarredRetryAttempts replace Workers and
+	// RetryAttempts for starred repositories.
+	StarredWorkers       int `mapstructure:"starred_workers"`
+	StarredRetryAttempts int `mapstructure:"starred_retry_attempts"`
+}
+
+// SafetyConfig bounds how much a single sync may remove or rewrite.
+// Beyond either limit, sync stops pruning, retention stops deleting
+// snapshots, and health reports critical until the alert is
+// acknowledged. A limit of 0 disables that check.
+type SafetyConfig struct {
+	MaxRemovedRepositories int `mapstructure:"max_removed_repositories"`
+	MaxRewrittenRefs       int `mapstructure:"max_rewritten_refs"`
 }
 
 type HealthConfig struct {
 	MinimumFreeDiskPercent uint8 `mapstructure:"minimum_free_disk_percent"`
 }
 
-// RepositoryMirrorRoot, GistMirrorRoot, and QuarantineDir are DERIVED from
+// RepositoryMirrorRoot, GistMirrorRoot, WikiMirrorRoot, StarredMirrorRoot, MetadataRoot, ReleaseRoot, ArchiveDir, and QuarantineDir are DERIVED from
 // the user-configured MirrorRoot.
 func (c Config) RepositoryMirrorRoot() string {
 	return filepath.Join(c.Storage.MirrorRoot, "repositories")
@@ -52,6 +286,32 @@ func (c Config) GistMirrorRoot() string {
 	return filepath.Join(c.Storage.MirrorRoot, "gists")
 }
 
+func (c Config) WikiMirrorRoot() string {
+	return filepath.Join(c.Storage.MirrorRoot, "wikis")
+}
+
+func (c Config) StarredMirrorRoot() string {
+	return filepath.Join(c.Storage.MirrorRoot, "starred")
+}
+
+// MetadataRoot holds exported issues and pull requests, inside the
+// mirror root so snapshots include them.
+func (c Config) MetadataRoot() string {
+	return filepath.Join(c.Storage.MirrorRoot, "metadata")
+}
+
+// ReleaseRoot holds downloaded release notes and assets, inside the
+// mirror root for the same reason.
+func (c Config) ReleaseRoot() string {
+	return filepath.Join(c.Storage.MirrorRoot, "releases")
+}
+
+// ArchiveDir lies inside the mirror root, unlike QuarantineDir, so
+// archived mirrors are still part of every snapshot.
+func (c Config) ArchiveDir() string {
+	return filepath.Join(c.Storage.MirrorRoot, "archived")
+}
+
 func (c Config) QuarantineDir() string {
 	return filepath.Join(filepath.Dir(c.Storage.MirrorRoot), "quarantine")
 }
@@ -66,11 +326,21 @@ func Default(layout runtime.Layout) Config {
 		},
 		Snapshot: SnapshotConfig{
 			OutputDirectory: filepath.Join(layout.DataDir, "snapshots"),
+			Backend:         SnapshotBackendArchive,
+			Mode:            SnapshotModeFull,
+			FullEvery:       7,
 			Retention:       0,
 		},
 		Sync: SyncConfig{
 			Workers:       3,
 			RetryAttempts: 3,
+
+			StarredWorkers:       1,
+			StarredRetryAttempts: 1,
+		},
+		Safety: SafetyConfig{
+			MaxRemovedRepositories: 10,
+			MaxRewrittenRefs:       50,
 		},
 		Health: HealthConfig{
 			MinimumFreeDiskPercent: 20,
@@ -84,33 +354,174 @@ func Write(path string, cfg Config) error {
 
 [github]
 backup_gists = %t
+backup_wikis = %t
+backup_metadata = %t
+backup_releases = %t
+max_release_asset_mb = %d
+backup_starred = %t
+organizations = %s
+
+[filter]
+include = %s
+exclude = %s
+exclude_forks = %t
+exclude_archived = %t
+exclude_private = %t
+exclude_public = %t
+topics = %s
+max_size_mb = %d
 
 [storage]
 mirror_root = %q
+archive_grace_period = %q
 
 [snapshot]
 output_directory = %q
+backend = %q
+mode = %q
+full_every = %d
 retention = %d
+keep_daily = %d
+keep_weekly = %d
+keep_monthly = %d
+keep_yearly = %d
+keep_within = %q
+
+[snapshot.encryption]
+recipients = %s
+passphrase_file = %q
+identity_file = %q
+
+[snapshot.signing]
+public_key = %q
 
 [sync]
 workers = %d
 retry_attempts = %d
+preserve_refs = %t
+preserved_refs_keep_within = %q
+lfs = %t
+starred_workers = %d
+starred_retry_attempts = %d
+
+[safety]
+max_removed_repositories = %d
+max_rewritten_refs = %d
 
 [health]
 minimum_free_disk_percent = %d
 `,
 		cfg.GitHub.BackupGists,
+		cfg.GitHub.BackupWikis,
+		cfg.GitHub.BackupMetadata,
+		cfg.GitHub.BackupReleases,
+		cfg.GitHub.MaxReleaseAssetMB,
+		cfg.GitHub.BackupStarred,
+		tomlStringArray(cfg.GitHub.Organizations),
+		tomlStringArray(cfg.Filter.Include),
+		tomlStringArray(cfg.Filter.Exclude),
+		cfg.Filter.ExcludeForks,
+		cfg.Filter.ExcludeArchived,
+		cfg.Filter.ExcludePrivate,
+		cfg.Filter.ExcludePublic,
+		tomlStringArray(cfg.Filter.Topics),
+		cfg.Filter.MaxSizeMB,
 		cfg.Storage.MirrorRoot,
+		cfg.Storage.ArchiveGracePeriod,
 		cfg.Snapshot.OutputDirectory,
+		cfg.Snapshot.Backend,
+		cfg.Snapshot.Mode,
+		cfg.Snapshot.FullEvery,
 		cfg.Snapshot.Retention,
+		cfg.Snapshot.KeepDaily,
+		cfg.Snapshot.KeepWeekly,
+		cfg.Snapshot.KeepMonthly,
+		cfg.Snapshot.KeepYearly,
+		cfg.Snapshot.KeepWithin,
+		tomlStringArray(cfg.Snapshot.Encryption.Recipients),
+		cfg.Snapshot.Encryption.PassphraseFile,
+		cfg.Snapshot.Encryption.IdentityFile,
+		cfg.Snapshot.Signing.PublicKey,
 		cfg.Sync.Workers,
 		cfg.Sync.RetryAttempts,
+		cfg.Sync.PreserveRefs,
+		cfg.Sync.PreservedRefsKeepWithin,
+		cfg.Sync.LFS,
+		cfg.Sync.StarredWorkers,
+		cfg.Sync.StarredRetryAttempts,
+		cfg.Safety.MaxRemovedRepositories,
+		cfg.Safety.MaxRewrittenRefs,
 		cfg.Health.MinimumFreeDiskPercent,
 	)
 
+	for _, target := range cfg.Offsite {
+		content += tomlOffsite(target)
+	}
+
 	return os.WriteFile(path, []byte(content), 0600)
 }
 
+// tomlOffsite renders one [[offsite]] table with the fields its type uses.
+func tomlOffsite(target OffsiteConfig) string {
+
+	content := fmt.Sprintf(`
+[[offsite]]
+name = %q
+type = %q
+`,
+		target.Name,
+		target.Type,
+	)
+
+	switch target.Type {
+	case OffsiteS3:
+		content += fmt.Sprintf(`endpoint = %q
+region = %q
+bucket = %q
+prefix = %q
+access_key_id = %q
+secret_access_key_file = %q
+part_size_mb = %d
+`,
+			target.Endpoint,
+			target.Region,
+			target.Bucket,
+			target.Prefix,
+			target.AccessKeyID,
+			target.SecretAccessKeyFile,
+			target.PartSizeMB,
+		)
+
+	case OffsiteSFTP:
+		content += fmt.Sprintf(`host = %q
+user = %q
+identity_file = %q
+known_hosts_file = %q
+directory = %q
+`,
+			target.Host,
+			target.User,
+			target.IdentityFile,
+			target.KnownHostsFile,
+			target.Directory,
+		)
+	}
+
+	return content
+}
+
+// tomlStringArray renders items as an inline TOML array of strings.
+func tomlStringArray(items []string) string {
+
+	quoted := make([]string, 0, len(items))
+
+	for _, item := range items {
+		quoted = append(quoted, fmt.Sprintf("%q", item))
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
 // Load reads and validates configuration using the given Layout to locate
 // config.toml. It never falls back to defaults — a missing config file is
 // a hard error, since GitBack shouldn't silently run on unconfigured
@@ -5,13 +5,62 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"path"
 	"strings"
+
+	"filippo.io/age"
+	"github.com/flarexes/gitback/internal/signing"
 )
 
 func (c *Config) Validate() error {
 
 	var issues []string
 
+	for _, org := range c.GitHub.Organizations {
+
+		if strings.TrimSpace(org) == "" || strings.Contains(org, "/") {
+			issues = append(
+				issues,
+				fmt.Sprintf("github.organizations contains an invalid name: %q", org),
+			)
+		}
+	}
+
+	for _, patterns := range [][]string{c.Filter.Include, c.Filter.Exclude} {
+
+		for _, pattern := range patterns {
+
+			if _, err := path.Match(pattern, ""); err != nil {
+				issues = append(
+					issues,
+					fmt.Sprintf("filter pattern %q is invalid: %v", pattern, err),
+				)
+			}
+		}
+	}
+
+	if c.Filter.ExcludePrivate && c.Filter.ExcludePublic {
+		issues = append(
+			issues,
+			"filter.exclude_private and filter.exclude_public cannot both be enabled",
+		)
+	}
+
+	if c.Filter.MaxSizeMB < 0 {
+		issues = append(
+			issues,
+			"filter.max_size_mb must be >= 0",
+		)
+	}
+
+	if c.GitHub.MaxReleaseAssetMB < 0 {
+		issues = append(
+			issues,
+			"github.max_release_asset_mb must be >= 0",
+		)
+	}
+
 	if c.Storage.MirrorRoot == "" {
 		issues = append(
 			issues,
@@ -19,6 +68,16 @@ func (c *Config) Validate() error {
 		)
 	}
 
+	if c.Storage.ArchiveGracePeriod != "" {
+
+		if _, err := ParseKeepWithin(c.Storage.ArchiveGracePeriod); err != nil {
+			issues = append(
+				issues,
+				fmt.Sprintf("storage.archive_grace_period: %v", err),
+			)
+		}
+	}
+
 	if c.Snapshot.OutputDirectory == "" {
 		issues = append(
 			issues,
@@ -26,6 +85,163 @@ func (c *Config) Validate() error {
 		)
 	}
 
+	if c.Snapshot.Backend != SnapshotBackendArchive && c.Snapshot.Backend != SnapshotBackendRepository {
+		issues = append(
+			issues,
+			fmt.Sprintf("snapshot.backend must be %q or %q", SnapshotBackendArchive, SnapshotBackendRepository),
+		)
+	}
+
+	// The repository already deduplicates across snapshots, and its
+	// chunks are plain files that targets and age can't handle yet.
+	if c.Snapshot.Backend == SnapshotBackendRepository {
+
+		if c.Snapshot.Mode == SnapshotModeIncremental {
+			issues = append(
+				issues,
+				"snapshot.mode = \"incremental\" requires snapshot.backend = \"archive\"",
+			)
+		}
+
+		if c.Snapshot.Encryption.Enabled() {
+			issues = append(
+				issues,
+				"snapshot.encryption requires snapshot.backend = \"archive\"",
+			)
+		}
+
+		if len(c.Offsite) > 0 {
+			issues = append(
+				issues,
+				"offsite targets require snapshot.backend = \"archive\"",
+			)
+		}
+	}
+
+	if c.Snapshot.Mode != SnapshotModeFull && c.Snapshot.Mode != SnapshotModeIncremental {
+		issues = append(
+			issues,
+			fmt.Sprintf("snapshot.mode must be %q or %q", SnapshotModeFull, SnapshotModeIncremental),
+		)
+	}
+
+	if c.Snapshot.FullEvery < 1 {
+		issues = append(
+			issues,
+			"snapshot.full_every must be >= 1",
+		)
+	}
+
+	keep := map[string]int{
+		"snapshot.keep_daily":   c.Snapshot.KeepDaily,
+		"snapshot.keep_weekly":  c.Snapshot.KeepWeekly,
+		"snapshot.keep_monthly": c.Snapshot.KeepMonthly,
+		"snapshot.keep_yearly":  c.Snapshot.KeepYearly,
+	}
+
+	for _, key := range []string{"snapshot.keep_daily", "snapshot.keep_weekly", "snapshot.keep_monthly", "snapshot.keep_yearly"} {
+
+		if keep[key] < 0 {
+			issues = append(
+				issues,
+				fmt.Sprintf("%s must be >= 0", key),
+			)
+		}
+	}
+
+	if c.Snapshot.KeepWithin != "" {
+
+		if _, err := ParseKeepWithin(c.Snapshot.KeepWithin); err != nil {
+			issues = append(
+				issues,
+				fmt.Sprintf("snapshot.keep_within: %v", err),
+			)
+		}
+	}
+
+	if len(c.Snapshot.Encryption.Recipients) > 0 && c.Snapshot.Encryption.PassphraseFile != "" {
+		issues = append(
+			issues,
+			"snapshot.encryption.recipients and snapshot.encryption.passphrase_file are mutually exclusive",
+		)
+	}
+
+	for _, recipient := range c.Snapshot.Encryption.Recipients {
+
+		if _, err := age.ParseX25519Recipient(recipient); err != nil {
+			issues = append(
+				issues,
+				fmt.Sprintf("snapshot.encryption.recipients contains an invalid recipient %q: %v", recipient, err),
+			)
+		}
+	}
+
+	if c.Snapshot.Signing.PublicKey != "" {
+
+		if _, err := signing.ParsePublicKey(c.Snapshot.Signing.PublicKey); err != nil {
+			issues = append(
+				issues,
+				fmt.Sprintf("snapshot.signing.public_key is invalid: %v", err),
+			)
+		}
+	}
+
+	names := make(map[string]bool)
+
+	for i, target := range c.Offsite {
+
+		key := fmt.Sprintf("offsite[%d]", i)
+
+		if names[target.DisplayName()] {
+			issues = append(
+				issues,
+				fmt.Sprintf("%s: duplicate target %q; set a unique name", key, target.DisplayName()),
+			)
+		}
+
+		names[target.DisplayName()] = true
+
+		switch target.Type {
+		case OffsiteS3:
+
+			if target.Endpoint == "" {
+				issues = append(issues, fmt.Sprintf("%s: endpoint is required", key))
+			} else if u, err := url.Parse(target.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				issues = append(issues, fmt.Sprintf("%s: endpoint must be an http(s) URL", key))
+			}
+
+			if target.Bucket == "" {
+				issues = append(issues, fmt.Sprintf("%s: bucket is required", key))
+			}
+
+			if target.PartSizeMB != 0 && target.PartSizeMB < 5 {
+				issues = append(issues, fmt.Sprintf("%s: part_size_mb must be >= 5", key))
+			}
+
+		case OffsiteSFTP:
+
+			required := []struct{ field, value string }{
+				{"host", target.Host},
+				{"user", target.User},
+				{"identity_file", target.IdentityFile},
+				{"directory", target.Directory},
+			}
+
+			for _, r := range required {
+
+				if r.value == "" {
+					issues = append(issues, fmt.Sprintf("%s: %s is required", key, r.field))
+				}
+			}
+
+		default:
+			issues = append(
+				issues,
+				fmt.Sprintf("%s: unsupported type %q", key, target.Type),
+			)
+		}
+	}
+
 	if c.Sync.Workers < 1 {
 		issues = append(
 			issues,
@@ -40,6 +256,44 @@ func (c *Config) Validate() error {
 		)
 	}
 
+	if c.Sync.StarredWorkers < 1 {
+		issues = append(
+			issues,
+			"sync.starred_workers must be >= 1",
+		)
+	}
+
+	if c.Sync.StarredRetryAttempts < 1 {
+		issues = append(
+			issues,
+			"sync.starred_retry_attempts must be >= 1",
+		)
+	}
+
+	if c.Sync.PreservedRefsKeepWithin != "" {
+
+		if _, err := ParseKeepWithin(c.Sync.PreservedRefsKeepWithin); err != nil {
+			issues = append(
+				issues,
+				fmt.Sprintf("sync.preserved_refs_keep_within: %v", err),
+			)
+		}
+	}
+
+	if c.Safety.MaxRemovedRepositories < 0 {
+		issues = append(
+			issues,
+			"safety.max_removed_repositories must be >= 0",
+		)
+	}
+
+	if c.Safety.MaxRewrittenRefs < 0 {
+		issues = append(
+			issues,
+			"safety.max_rewritten_refs must be >= 0",
+		)
+	}
+
 	if c.Health.MinimumFreeDiskPercent > 100 {
 
 		issues = append(
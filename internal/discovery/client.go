@@ -3,9 +3,8 @@
 package discovery
 
 import (
-	"fmt"
-
 	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/githubapi"
 	"github.com/flarexes/gitback/internal/logging"
 	"github.com/flarexes/gitback/internal/runtime"
 	"github.com/google/go-github/v88/github"
@@ -19,12 +18,7 @@ type Client struct {
 }
 
 func New(cfg *config.Config, layout runtime.Layout, logger *logging.Logger) (*Client, error) {
-	token, err := config.ReadToken(layout)
-	if err != nil {
-		return nil, fmt.Errorf("read github token: %w", err)
-	}
-
-	api, err := github.NewClient(github.WithAuthToken(token))
+	api, err := githubapi.NewClient(layout)
 	if err != nil {
 		return nil, err
 	}
@@ -5,14 +5,25 @@ package discovery
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/flarexes/gitback/internal/filter"
 	"github.com/flarexes/gitback/internal/logging"
 	"github.com/flarexes/gitback/internal/state"
 	"github.com/google/go-github/v88/github"
 )
 
 type DiscoverResult struct {
-	URLs      []string
+	URLs []string
+
+	// Repositories holds the full API objects for repository listings,
+	// so filter rules can inspect more than the clone URL.
+	Repositories []*github.Repository
+
+	// Gists holds the full API objects for gist listings, so their
+	// metadata can be saved next to the mirrors.
+	Gists []*github.Gist
+
 	RateLimit github.Rate
 }
 
@@ -25,8 +36,30 @@ func (c *Client) Discover(ctx context.Context) error {
 		return err
 	}
 
+	// Organization repositories are merged into the same inventory so
+	// sync treats them exactly like the user's own repositories.
+	result, err = c.mergeOrganizationRepositories(ctx, result)
+
+	if err != nil {
+		return err
+	}
+
+	// Filter rules are applied before the inventory is written, so
+	// excluded repositories are never synced or snapshotted.
+	included, excluded := c.applyFilter(result.Repositories)
+
+	for _, repo := range included {
+		result.URLs = append(result.URLs, repo.GetCloneURL())
+	}
+
 	repoCount := len(result.URLs)
 
+	// Compare against every repository seen before, while the previous
+	// inventory is still on disk.
+	if err := c.recordInventory(included, result.Repositories, time.Now()); err != nil {
+		return fmt.Errorf("record inventory history: %w", err)
+	}
+
 	// Save repository URLs to inventory file
 	if err := state.WriteInventory(
 		c.layout.RepositoryInventoryFile,
@@ -39,6 +72,28 @@ func (c *Client) Discover(ctx context.Context) error {
 	// Log discovery completion
 	c.logDiscovery("repositories", repoCount, c.layout.RepositoryInventoryFile, result.RateLimit)
 
+	// Wiki
+	wikiCount := 0
+
+	if c.cfg.GitHub.BackupWikis {
+
+		wikis := wikiURLs(included)
+		wikiCount = len(wikis)
+
+		// Save wiki URLs to inventory file
+		if err := state.WriteInventory(
+			c.layout.WikiInventoryFile,
+			wikis,
+		); err != nil {
+
+			return err
+		}
+
+		// Wikis are derived from the repository listing, so no extra
+		// API calls were made and the repository rate limit applies.
+		c.logDiscovery("wikis", wikiCount, c.layout.WikiInventoryFile, result.RateLimit)
+	}
+
 	// Gist
 	gistCount := 0
 
@@ -63,15 +118,43 @@ func (c *Client) Discover(ctx context.Context) error {
 
 		// Log gist completion
 		c.logDiscovery("gists", gistCount, c.layout.GistInventoryFile, result.RateLimit)
+
+		// A gist whose metadata can't be fetched keeps the file saved
+		// before, so it never stops discovery.
+		c.exportGistMetadata(ctx, result.Gists)
+	}
+
+	// Starred
+	starredCount := 0
+
+	if c.cfg.GitHub.BackupStarred {
+
+		starredCount, err = c.discoverStarredInventory(ctx, result.URLs)
+
+		if err != nil {
+			return err
+		}
 	}
 
 	fmt.Println()
 	fmt.Println("Repository: ", repoCount)
 
+	if excluded > 0 {
+		fmt.Println("Excluded:   ", excluded)
+	}
+
+	if c.cfg.GitHub.BackupWikis {
+		fmt.Println("Wiki:       ", wikiCount)
+	}
+
 	if c.cfg.GitHub.BackupGists {
 		fmt.Println("Gist:       ", gistCount)
 	}
 
+	if c.cfg.GitHub.BackupStarred {
+		fmt.Println("Starred:    ", starredCount)
+	}
+
 	c.logger.Emit(
 		logging.Entry{
 			Level: logging.Info,
@@ -79,8 +162,11 @@ func (c *Client) Discover(ctx context.Context) error {
 
 			Details: map[string]any{
 				"repositories": repoCount,
+				"excluded":     excluded,
+				"wikis":        wikiCount,
 				"gists":        gistCount,
-				"total":        repoCount + gistCount,
+				"starred":      starredCount,
+				"total":        repoCount + wikiCount + gistCount + starredCount,
 			},
 		},
 	)
@@ -88,6 +174,45 @@ func (c *Client) Discover(ctx context.Context) error {
 	return nil
 }
 
+// applyFilter evaluates the configured [filter] rules and returns the
+// repositories to back up, along with the number of repositories
+// excluded. Every exclusion is logged with its reason.
+func (c *Client) applyFilter(repos []*github.Repository) ([]*github.Repository, int) {
+
+	f := filter.New(c.cfg.Filter)
+
+	var included []*github.Repository
+	excluded := 0
+
+	for _, repo := range repos {
+
+		if ok, reason := f.Evaluate(repo); !ok {
+
+			excluded++
+
+			fmt.Printf("[SKIP] %s: %s\n", repo.GetFullName(), reason)
+
+			c.logger.Emit(
+				logging.Entry{
+					Level: logging.Info,
+					Event: logging.Events.GitHub.RepositoryExcluded,
+					Repo:  repo.GetFullName(),
+
+					Details: map[string]any{
+						"reason": reason,
+					},
+				},
+			)
+
+			continue
+		}
+
+		included = append(included, repo)
+	}
+
+	return included, excluded
+}
+
 func (c *Client) logDiscovery(
 	resource string,
 	count int,
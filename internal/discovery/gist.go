@@ -4,15 +4,19 @@ package discovery
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
 
 	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/mirror"
 	"github.com/google/go-github/v88/github"
 )
 
 func (c *Client) discoverGists(ctx context.Context) (DiscoverResult, error) {
 
 	var all []string
+	var listed []*github.Gist
 	var lastResponse *github.Response
 
 	opt := &github.GistListOptions{
@@ -51,6 +55,8 @@ func (c *Client) discoverGists(ctx context.Context) (DiscoverResult, error) {
 			)
 		}
 
+		listed = append(listed, gists...)
+
 		c.logger.Emit(
 			logging.Entry{
 				Level: logging.Info,
@@ -75,6 +81,105 @@ func (c *Client) discoverGists(ctx context.Context) (DiscoverResult, error) {
 
 	return DiscoverResult{
 		URLs:      all,
+		Gists:     listed,
 		RateLimit: lastResponse.Rate,
 	}, nil
 }
+
+// exportGistMetadata saves the description, visibility, files, forks
+// and comments of every listed gist to gists/<id>.json in the mirror root, since
+// none of them are part of the gist's git repository.
+func (c *Client) exportGistMetadata(ctx context.Context, gists []*github.Gist) {
+
+	for _, listed := range gists {
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		err := c.exportGist(ctx, listed)
+
+		if err == nil {
+			continue
+		}
+
+		c.logger.Emit(
+			logging.Entry{
+				Level: logging.Warn,
+				Event: logging.Events.GitHub.GistMetadataFailed,
+				Repo:  listed.GetID(),
+				Error: err.Error(),
+			},
+		)
+
+		fmt.Printf("[WARN] Gist %s metadata: %v\n", listed.GetID(), err)
+
+		// Every other gist would fail the same way.
+		var rateErr *github.RateLimitError
+
+		if errors.As(err, &rateErr) {
+			return
+		}
+	}
+}
+
+// exportGist fetches and saves the metadata of one gist, with the
+// forks and comments the listing only counts.
+func (c *Client) exportGist(ctx context.Context, gist *github.Gist) error {
+
+	forks, err := listGistPages(func(opt *github.ListOptions) ([]*github.GistFork, *github.Response, error) {
+		return c.api.Gists.ListForks(ctx, gist.GetID(), opt)
+	})
+	if err != nil {
+		return fmt.Errorf("list forks: %w", err)
+	}
+
+	comments, err := listGistPages(func(opt *github.ListOptions) ([]*github.GistComment, *github.Response, error) {
+		return c.api.Gists.ListComments(ctx, gist.GetID(), opt)
+	})
+	if err != nil {
+		return fmt.Errorf("list comments: %w", err)
+	}
+
+	starred, _, err := c.api.Gists.IsStarred(ctx, gist.GetID())
+	if err != nil {
+		return fmt.Errorf("check star: %w", err)
+	}
+
+	return mirror.WriteGistMetadata(
+		filepath.Join(
+			c.cfg.Storage.MirrorRoot,
+			filepath.FromSlash(mirror.GistMetadataPath(gist.GetGitPullURL())),
+		),
+		mirror.GistMetadata{
+			Gist:     gist,
+			Forks:    forks,
+			Comments: comments,
+			Starred:  starred,
+		},
+	)
+}
+
+// listGistPages collects every page list returns.
+func listGistPages[T any](list func(*github.ListOptions) ([]T, *github.Response, error)) ([]T, error) {
+
+	var all []T
+
+	opt := &github.ListOptions{PerPage: 100}
+
+	for {
+
+		items, resp, err := list(opt)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, items...)
+
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+
+		opt.Page = resp.NextPage
+	}
+}
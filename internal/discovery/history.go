@@ -0,0 +1,377 @@
+// internal/discovery/history.go
+
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/githubapi"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/metadata"
+	"github.com/flarexes/gitback/internal/mirror"
+	"github.com/flarexes/gitback/internal/release"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/google/go-github/v88/github"
+)
+
+// recordInventory compares the repositories about to be written to the
+// inventory with every repository seen before. Repositories that left
+// the inventory become tombstones and their mirrors are archived;
+// repositories that came back are restored from the archive. Archived
+// mirrors past storage.archive_grace_period are purged.
+//
+// Records follow a repository's GitHub ID, so a renamed or transferred
+// repository keeps its record under the new URL instead of leaving a
+// tombstone; sync then moves its mirror.
+//
+// It runs before the new inventory is written, so the previous one can
+// date repositories discovered before the history existed.
+func (c *Client) recordInventory(included []*github.Repository, listed []*github.Repository, now time.Time) error {
+
+	history, err := state.LoadInventoryHistory(c.layout.InventoryHistoryFile)
+	if err != nil {
+		return err
+	}
+
+	records := make(map[string]state.RepositoryRecord, len(history.Repositories))
+
+	for _, record := range history.Repositories {
+		records[record.Name] = record
+	}
+
+	if err := c.seedHistory(records); err != nil {
+		return err
+	}
+
+	stamp := now.UTC().Format(time.RFC3339)
+
+	byID := make(map[int64]string, len(records))
+
+	for name, record := range records {
+
+		if record.ID != 0 && !record.Removed() {
+			byID[record.ID] = name
+		}
+	}
+
+	// Move the records of renamed repositories first: another one may
+	// already have taken over the old name.
+	renamed := make(map[string]state.RepositoryRecord)
+
+	for _, repo := range included {
+
+		previous, ok := byID[repo.GetID()]
+
+		if !ok || repo.GetID() == 0 || previous == repo.GetCloneURL() {
+			continue
+		}
+
+		renamed[repo.GetCloneURL()] = records[previous]
+
+		fmt.Printf("[RENAMED] %s -> %s\n", githubapi.RepositoryName(previous), githubapi.RepositoryName(repo.GetCloneURL()))
+	}
+
+	for _, record := range renamed {
+		delete(records, record.Name)
+	}
+
+	for url, record := range renamed {
+		record.Name = url
+		records[url] = record
+	}
+
+	current := make(map[string]struct{}, len(included))
+
+	for _, repo := range included {
+
+		url := repo.GetCloneURL()
+		current[url] = struct{}{}
+
+		record, ok := records[url]
+
+		if !ok {
+			record = state.RepositoryRecord{
+				Name:      url,
+				FirstSeen: stamp,
+			}
+		}
+
+		if record.Removed() {
+			c.returnRepository(&record)
+		}
+
+		record.ID = repo.GetID()
+		record.LastSeen = stamp
+		records[url] = record
+	}
+
+	// Filter rules see every listed repository; one still listed but
+	// no longer included was excluded rather than lost.
+	stillListed := make(map[string]struct{}, len(listed))
+
+	for _, repo := range listed {
+		stillListed[repo.GetCloneURL()] = struct{}{}
+	}
+
+	for name, record := range records {
+
+		if _, ok := current[name]; ok || record.Removed() {
+			continue
+		}
+
+		record.RemovedAt = stamp
+		record.RemovalReason = state.RemovalMissing
+
+		if _, ok := stillListed[name]; ok {
+			record.RemovalReason = state.RemovalExcluded
+		}
+
+		c.removeRepository(&record, now)
+		records[name] = record
+	}
+
+	c.purgeArchived(records, now)
+
+	history.GeneratedAt = stamp
+	history.Repositories = make([]state.RepositoryRecord, 0, len(records))
+
+	for _, record := range records {
+		history.Repositories = append(history.Repositories, record)
+	}
+
+	sort.Slice(history.Repositories, func(i, j int) bool {
+		return history.Repositories[i].Name < history.Repositories[j].Name
+	})
+
+	return state.SaveInventoryHistory(c.layout.InventoryHistoryFile, *history)
+}
+
+// seedHistory adds the repositories of the previous inventory that the
+// history doesn't know yet, dated by when that inventory was written.
+func (c *Client) seedHistory(records map[string]state.RepositoryRecord) error {
+
+	previous, err := state.ReadInventory(c.layout.RepositoryInventoryFile)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(c.layout.RepositoryInventoryFile)
+	if err != nil {
+		return err
+	}
+
+	seen := info.ModTime().UTC().Format(time.RFC3339)
+
+	for _, url := range previous {
+
+		if _, ok := records[url]; ok {
+			continue
+		}
+
+		records[url] = state.RepositoryRecord{
+			Name:      url,
+			FirstSeen: seen,
+			LastSeen:  seen,
+		}
+	}
+
+	return nil
+}
+
+// removeRepository archives the mirrors of a repository that left the
+// inventory, with its release and metadata directories. A mirror that
+// can't be moved stays in place, where health reports it as orphaned.
+func (c *Client) removeRepository(record *state.RepositoryRecord, now time.Time) {
+
+	record.Archived = append(record.Archived, c.archive(record.Name, mirror.RepositoryMirrors(record.Name), now)...)
+
+	record.ArchivedFiles = append(
+		record.ArchivedFiles,
+		c.archive(
+			record.Name,
+			[]string{
+				filepath.FromSlash(release.RelativePath(record.Name)),
+				metadata.RelativePath(record.Name),
+			},
+			now,
+		)...,
+	)
+
+	c.logger.Emit(
+		logging.Entry{
+			Level: logging.Warn,
+			Event: logging.Events.GitHub.RepositoryRemoved,
+			Repo:  githubapi.RepositoryName(record.Name),
+
+			Details: map[string]any{
+				"reason":         record.RemovalReason,
+				"first_seen":     record.FirstSeen,
+				"last_seen":      record.LastSeen,
+				"archived":       record.Archived,
+				"archived_files": record.ArchivedFiles,
+			},
+		},
+	)
+
+	fmt.Printf("[REMOVED] %s (%s)\n", githubapi.RepositoryName(record.Name), record.RemovalReason)
+}
+
+// archive moves the paths of the repository with clone URL repoURL that
+// exist below the mirror root into the archive, and returns where they
+// went.
+func (c *Client) archive(repoURL string, paths []string, now time.Time) []string {
+
+	root := c.cfg.Storage.MirrorRoot
+
+	var moved []string
+
+	for _, relative := range paths {
+
+		if _, err := os.Stat(filepath.Join(root, relative)); err != nil {
+			continue
+		}
+
+		archived, err := mirror.Archive(root, relative, now)
+		if err != nil {
+
+			c.logger.Error(
+				logging.Events.GitHub.ArchiveFailed,
+				githubapi.RepositoryName(repoURL),
+				err,
+			)
+
+			fmt.Printf("[FAIL] %s: %v\n", githubapi.RepositoryName(repoURL), err)
+
+			continue
+		}
+
+		moved = append(moved, filepath.ToSlash(archived))
+	}
+
+	return moved
+}
+
+// returnRepository clears the tombstone of a repository that is back in
+// the inventory and moves its archived mirrors back, so sync updates
+// them instead of cloning from scratch.
+func (c *Client) returnRepository(record *state.RepositoryRecord) {
+
+	if record.PurgedAt == "" {
+
+		for _, archived := range append(record.Archived, record.ArchivedFiles...) {
+
+			if _, err := mirror.Unarchive(c.cfg.Storage.MirrorRoot, archived); err != nil {
+
+				c.logger.Error(
+					logging.Events.GitHub.ArchiveFailed,
+					githubapi.RepositoryName(record.Name),
+					err,
+				)
+			}
+		}
+	}
+
+	c.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.GitHub.RepositoryReturned,
+			Repo:  githubapi.RepositoryName(record.Name),
+
+			Details: map[string]any{
+				"removed_at": record.RemovedAt,
+				"archived":   record.Archived,
+				"purged_at":  record.PurgedAt,
+			},
+		},
+	)
+
+	fmt.Printf("[RETURNED] %s\n", githubapi.RepositoryName(record.Name))
+
+	record.RemovedAt = ""
+	record.RemovalReason = ""
+	record.Archived = nil
+	record.ArchivedFiles = nil
+	record.PurgedAt = ""
+}
+
+// purgeArchived deletes archived mirrors removed longer ago than the
+// grace period; the tombstone stays. Nothing is purged while a safety
+// alert is unacknowledged.
+func (c *Client) purgeArchived(records map[string]state.RepositoryRecord, now time.Time) {
+
+	if c.cfg.Storage.ArchiveGracePeriod == "" {
+		return
+	}
+
+	grace, err := config.ParseKeepWithin(c.cfg.Storage.ArchiveGracePeriod)
+	if err != nil {
+		return
+	}
+
+	if alert, err := state.LoadSafety(c.layout.SafetyStateFile); err != nil || alert.Active() {
+		return
+	}
+
+	for name, record := range records {
+
+		if !record.Removed() || record.PurgedAt != "" || len(record.Archived)+len(record.ArchivedFiles) == 0 {
+			continue
+		}
+
+		removedAt, err := time.Parse(time.RFC3339, record.RemovedAt)
+		if err != nil || now.Sub(removedAt) < grace {
+			continue
+		}
+
+		var failed bool
+
+		for _, archived := range append(record.Archived, record.ArchivedFiles...) {
+
+			path := filepath.Join(c.cfg.Storage.MirrorRoot, filepath.FromSlash(archived))
+
+			if err := os.RemoveAll(path); err != nil {
+
+				c.logger.Error(
+					logging.Events.GitHub.ArchiveFailed,
+					githubapi.RepositoryName(name),
+					err,
+				)
+
+				failed = true
+			}
+		}
+
+		if failed {
+			continue
+		}
+
+		record.PurgedAt = now.UTC().Format(time.RFC3339)
+		records[name] = record
+
+		c.logger.Emit(
+			logging.Entry{
+				Level: logging.Info,
+				Event: logging.Events.GitHub.RepositoryPurged,
+				Repo:  githubapi.RepositoryName(name),
+
+				Details: map[string]any{
+					"removed_at":   record.RemovedAt,
+					"archived":     record.Archived,
+					"grace_period": c.cfg.Storage.ArchiveGracePeriod,
+				},
+			},
+		)
+
+		fmt.Printf("[PURGED] %s\n", githubapi.RepositoryName(name))
+	}
+}
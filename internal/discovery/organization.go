@@ -0,0 +1,132 @@
+// internal/discovery/organization.go
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/google/go-github/v88/github"
+)
+
+// discoverOrganizationRepositories lists every repository belonging to
+// org, regardless of the authenticated user's affiliation with it.
+func (c *Client) discoverOrganizationRepositories(ctx context.Context, org string) (DiscoverResult, error) {
+
+	var all []*github.Repository
+	var lastResponse *github.Response
+
+	opt := &github.RepositoryListByOrgOptions{
+		Type: "all",
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+
+	for {
+
+		page := opt.Page + 1
+
+		fmt.Printf("Fetching %s repositories (page %d)\n", org, page)
+
+		repos, resp, err := c.api.Repositories.ListByOrg(
+			ctx,
+			org,
+			opt,
+		)
+
+		if err != nil {
+
+			return DiscoverResult{}, fmt.Errorf("list organization %s repositories page=%d: %w",
+				org,
+				opt.Page,
+				err,
+			)
+		}
+
+		lastResponse = resp
+
+		all = append(all, repos...)
+
+		c.logger.Emit(
+			logging.Entry{
+				Level: logging.Info,
+				Event: logging.Events.GitHub.PageFetched,
+
+				Details: map[string]any{
+					"resource":     "organization_repositories",
+					"organization": org,
+					"page":         page,
+					"items":        len(repos),
+					"total_so_far": len(all),
+				},
+			},
+		)
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		opt.Page = resp.NextPage
+	}
+
+	return DiscoverResult{
+		Repositories: all,
+		RateLimit:    lastResponse.Rate,
+	}, nil
+}
+
+// mergeOrganizationRepositories appends repositories from every
+// configured organization to result, skipping any clone URL already
+// present from the user listing or an earlier organization.
+func (c *Client) mergeOrganizationRepositories(ctx context.Context, result DiscoverResult) (DiscoverResult, error) {
+
+	seen := make(map[string]struct{}, len(result.Repositories))
+
+	for _, repo := range result.Repositories {
+		seen[repo.GetCloneURL()] = struct{}{}
+	}
+
+	for _, org := range c.cfg.GitHub.Organizations {
+
+		orgResult, err := c.discoverOrganizationRepositories(ctx, org)
+
+		if err != nil {
+			return DiscoverResult{}, err
+		}
+
+		added := 0
+
+		for _, repo := range orgResult.Repositories {
+
+			url := repo.GetCloneURL()
+
+			if _, ok := seen[url]; ok {
+				continue
+			}
+
+			seen[url] = struct{}{}
+			result.Repositories = append(result.Repositories, repo)
+			added++
+		}
+
+		// The most recent response carries the freshest rate limit.
+		result.RateLimit = orgResult.RateLimit
+
+		c.logger.Emit(
+			logging.Entry{
+				Level: logging.Info,
+				Event: logging.Events.GitHub.OrganizationDiscovered,
+
+				Details: map[string]any{
+					"organization": org,
+					"count":        len(orgResult.Repositories),
+					"new":          added,
+				},
+			},
+		)
+	}
+
+	return result, nil
+}
@@ -12,7 +12,7 @@ import (
 
 func (c *Client) discoverRepositories(ctx context.Context) (DiscoverResult, error) {
 
-	var all []string
+	var all []*github.Repository
 	var lastResponse *github.Response
 
 	opt := &github.RepositoryListByAuthenticatedUserOptions{
@@ -43,13 +43,7 @@ func (c *Client) discoverRepositories(ctx context.Context) (DiscoverResult, erro
 
 		lastResponse = resp
 
-		for _, repo := range repos {
-
-			all = append(
-				all,
-				repo.GetCloneURL(),
-			)
-		}
+		all = append(all, repos...)
 
 		c.logger.Emit(
 			logging.Entry{
@@ -73,7 +67,7 @@ func (c *Client) discoverRepositories(ctx context.Context) (DiscoverResult, erro
 	}
 
 	return DiscoverResult{
-		URLs:      all,
-		RateLimit: lastResponse.Rate,
+		Repositories: all,
+		RateLimit:    lastResponse.Rate,
 	}, nil
 }
@@ -0,0 +1,200 @@
+// internal/discovery/starred.go
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/flarexes/gitback/internal/githubapi"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/mirror"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/google/go-github/v88/github"
+)
+
+// discoverStarred lists the repositories the authenticated account
+// starred, leaving out those already in own, the inventory of the
+// account's own repositories, which are mirrored there.
+func (c *Client) discoverStarred(ctx context.Context, own []string) (DiscoverResult, error) {
+
+	skip := make(map[string]struct{}, len(own))
+
+	for _, url := range own {
+		skip[url] = struct{}{}
+	}
+
+	var all []string
+	var lastResponse *github.Response
+
+	opt := &github.ActivityListStarredOptions{
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+
+	for {
+
+		page := opt.Page + 1
+
+		fmt.Printf("Fetching starred       (page %d)\n", page)
+
+		starred, resp, err := c.api.Activity.ListStarred(
+			ctx,
+			"",
+			opt,
+		)
+
+		if err != nil {
+			return DiscoverResult{}, fmt.Errorf("list starred repositories page=%d: %w",
+				opt.Page,
+				err,
+			)
+		}
+
+		lastResponse = resp
+
+		for _, star := range starred {
+
+			url := star.GetRepository().GetCloneURL()
+
+			if _, ok := skip[url]; ok || url == "" {
+				continue
+			}
+
+			all = append(all, url)
+		}
+
+		c.logger.Emit(
+			logging.Entry{
+				Level: logging.Info,
+				Event: logging.Events.GitHub.PageFetched,
+
+				Details: map[string]any{
+					"resource":     "starred",
+					"page":         page,
+					"items":        len(starred),
+					"total_so_far": len(all),
+				},
+			},
+		)
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		opt.Page = resp.NextPage
+	}
+
+	return DiscoverResult{
+		URLs:      all,
+		RateLimit: lastResponse.Rate,
+	}, nil
+}
+
+// discoverStarredInventory writes the starred inventory and returns
+// the number of starred repositories in it. A listing that fails only
+// warns and keeps the previous inventory: third-party repositories
+// must not stop the account's own from being backed up.
+func (c *Client) discoverStarredInventory(ctx context.Context, own []string) (int, error) {
+
+	result, err := c.discoverStarred(ctx, own)
+
+	if err != nil {
+
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		c.logger.Error(
+			logging.Events.GitHub.StarredListFailed,
+			"",
+			err,
+		)
+
+		fmt.Printf("[WARN] Starred repositories: %v\n", err)
+
+		previous, _ := state.ReadInventory(c.layout.StarredInventoryFile)
+
+		return len(previous), nil
+	}
+
+	c.archiveUnstarred(result.URLs, time.Now())
+
+	if err := state.WriteInventory(
+		c.layout.StarredInventoryFile,
+		result.URLs,
+	); err != nil {
+
+		return 0, err
+	}
+
+	c.logDiscovery("starred", len(result.URLs), c.layout.StarredInventoryFile, result.RateLimit)
+
+	return len(result.URLs), nil
+}
+
+// archiveUnstarred archives the mirrors of repositories that were in
+// the previous starred inventory but no longer are, so they stay in
+// snapshots without being synced. It runs before the new inventory is
+// written. A mirror that can't be moved stays in place, where health
+// reports it as orphaned.
+func (c *Client) archiveUnstarred(starred []string, now time.Time) {
+
+	previous, err := state.ReadInventory(c.layout.StarredInventoryFile)
+	if err != nil {
+		return
+	}
+
+	current := make(map[string]struct{}, len(starred))
+
+	for _, url := range starred {
+		current[url] = struct{}{}
+	}
+
+	root := c.cfg.Storage.MirrorRoot
+
+	for _, url := range previous {
+
+		if _, ok := current[url]; ok {
+			continue
+		}
+
+		relative := mirror.StarredMirror(url)
+
+		if _, err := os.Stat(filepath.Join(root, relative)); err != nil {
+			continue
+		}
+
+		archived, err := mirror.Archive(root, relative, now)
+		if err != nil {
+
+			c.logger.Error(
+				logging.Events.GitHub.ArchiveFailed,
+				githubapi.RepositoryName(url),
+				err,
+			)
+
+			fmt.Printf("[FAIL] %s: %v\n", githubapi.RepositoryName(url), err)
+
+			continue
+		}
+
+		c.logger.Emit(
+			logging.Entry{
+				Level: logging.Info,
+				Event: logging.Events.GitHub.StarredRemoved,
+				Repo:  githubapi.RepositoryName(url),
+
+				Details: map[string]any{
+					"archived": filepath.ToSlash(archived),
+				},
+			},
+		)
+
+		fmt.Printf("[UNSTARRED] %s\n", githubapi.RepositoryName(url))
+	}
+}
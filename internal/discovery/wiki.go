@@ -0,0 +1,34 @@
+// internal/discovery/wiki.go
+
+package discovery
+
+import (
+	"strings"
+
+	"github.com/google/go-github/v88/github"
+)
+
+// wikiURLs derives the wiki remote for every repository that has the
+// wiki feature enabled. GitHub serves a wiki as a separate repository at
+// "<repo>.wiki.git"; there is no API listing for them.
+//
+// has_wiki only says the feature is switched on, not that any page
+// exists, so sync is responsible for telling empty wikis apart.
+func wikiURLs(repos []*github.Repository) []string {
+
+	var urls []string
+
+	for _, repo := range repos {
+
+		if !repo.GetHasWiki() {
+			continue
+		}
+
+		urls = append(
+			urls,
+			strings.TrimSuffix(repo.GetCloneURL(), ".git")+".wiki.git",
+		)
+	}
+
+	return urls
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 
 	"github.com/flarexes/gitback/internal/config"
 	rt "github.com/flarexes/gitback/internal/runtime"
@@ -77,6 +78,21 @@ func Generate(layout rt.Layout) (*Report, error) {
 		)
 	}
 
+	// ------------------------------------------------------------------
+	// Features
+	//
+	// Requirements of optional features are only failures once the
+	// config turns the feature on.
+	// ------------------------------------------------------------------
+
+	report.AddCheck(
+		checkGitVersion(cfg),
+	)
+
+	report.AddCheck(
+		checkLFS(cfg),
+	)
+
 	// ------------------------------------------------------------------
 	// Filesystem
 	//
@@ -171,17 +187,23 @@ func checkEnvironment() []Check {
 			"git",
 			"Install Git.",
 		),
-		checkExecutable(
-			"tar",
-			"Install tar.",
-		),
-		checkExecutable(
-			"zstd",
-			"Install zstd.",
-		),
 	}
 }
 
+// checkLFS checks that git-lfs is installed, which only matters when
+// sync.lfs is on: mirrors that use LFS then fail to sync without it.
+func checkLFS(cfg *config.Config) Check {
+
+	check := checkExecutable(
+		"git-lfs",
+		"Install Git LFS 3.2 or newer, or set sync.lfs = false.",
+	)
+
+	check.Optional = cfg == nil || !cfg.Sync.LFS
+
+	return check
+}
+
 func checkExecutable(name string, recommendation string) Check {
 
 	_, err := exec.LookPath(name)
@@ -199,6 +221,46 @@ func checkExecutable(name string, recommendation string) Check {
 	return check
 }
 
+// preserveRefsGitVersion is the first git release supporting the
+// negative refspec that keeps updates from pruning preserved refs.
+var preserveRefsGitVersion = [2]int{2, 29}
+
+// checkGitVersion checks that git is new enough to preserve refs, which
+// only matters when sync.preserve_refs is on.
+func checkGitVersion(cfg *config.Config) Check {
+
+	check := Check{
+		Name:           "git version",
+		Optional:       cfg == nil || !cfg.Sync.PreserveRefs,
+		Recommendation: "Install git 2.29 or newer to use sync.preserve_refs.",
+	}
+
+	output, err := exec.Command("git", "version").Output()
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	// "git version 2.43.0", with a platform suffix on some systems.
+	var major, minor int
+
+	if _, err := fmt.Sscanf(string(output), "git version %d.%d", &major, &minor); err != nil {
+		check.Message = fmt.Sprintf("unrecognized git version %q", strings.TrimSpace(string(output)))
+		return check
+	}
+
+	check.Success = major > preserveRefsGitVersion[0] ||
+		major == preserveRefsGitVersion[0] && minor >= preserveRefsGitVersion[1]
+
+	if !check.Success {
+		check.Message = fmt.Sprintf("git %d.%d is older than 2.29", major, minor)
+	} else {
+		check.Recommendation = ""
+	}
+
+	return check
+}
+
 func checkFile(name string, path string, recommendation string) Check {
 
 	_, err := os.Stat(path)
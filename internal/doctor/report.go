@@ -6,6 +6,10 @@ type Check struct {
 	Success        bool   `json:"success"`
 	Message        string `json:"message,omitempty"`
 	Recommendation string `json:"recommendation,omitempty"`
+
+	// Optional marks a check for something only some installations
+	// need; failing it is a warning rather than a failure.
+	Optional bool `json:"optional,omitempty"`
 }
 
 // Report contains the complete result of a Doctor run.
@@ -0,0 +1,106 @@
+// internal/filter/filter.go
+// Package filter decides which discovered repositories are backed up.
+
+package filter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/google/go-github/v88/github"
+)
+
+// Filter evaluates the [filter] rules from config against repositories
+// returned by the GitHub API.
+type Filter struct {
+	rules config.FilterConfig
+}
+
+func New(rules config.FilterConfig) *Filter {
+	return &Filter{rules: rules}
+}
+
+// Evaluate reports whether repo should be backed up. When it should not,
+// the returned reason explains which rule excluded it.
+//
+// Patterns are matched case-insensitively against "owner/name", since
+// GitHub itself treats owner and repository names case-insensitively.
+func (f *Filter) Evaluate(repo *github.Repository) (bool, string) {
+
+	r := f.rules
+	name := strings.ToLower(repo.GetFullName())
+
+	if len(r.Include) > 0 {
+
+		if _, ok := matchAny(r.Include, name); !ok {
+			return false, "not matched by any include pattern"
+		}
+	}
+
+	if pattern, ok := matchAny(r.Exclude, name); ok {
+		return false, fmt.Sprintf("matched exclude pattern %q", pattern)
+	}
+
+	if r.ExcludeForks && repo.GetFork() {
+		return false, "repository is a fork"
+	}
+
+	if r.ExcludeArchived && repo.GetArchived() {
+		return false, "repository is archived"
+	}
+
+	if r.ExcludePrivate && repo.GetPrivate() {
+		return false, "repository is private"
+	}
+
+	if r.ExcludePublic && !repo.GetPrivate() {
+		return false, "repository is public"
+	}
+
+	if len(r.Topics) > 0 && !hasTopic(repo.Topics, r.Topics) {
+		return false, "repository has none of the required topics"
+	}
+
+	// GitHub reports repository size in kilobytes.
+	if r.MaxSizeMB > 0 && repo.GetSize() > r.MaxSizeMB*1024 {
+		return false, fmt.Sprintf(
+			"repository size %d MB exceeds limit of %d MB",
+			repo.GetSize()/1024,
+			r.MaxSizeMB,
+		)
+	}
+
+	return true, ""
+}
+
+// matchAny returns the first pattern matching name.
+func matchAny(patterns []string, name string) (string, bool) {
+
+	for _, pattern := range patterns {
+
+		// Patterns are validated by config.Validate, so a match error
+		// cannot occur here.
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return pattern, true
+		}
+	}
+
+	return "", false
+}
+
+func hasTopic(topics []string, wanted []string) bool {
+
+	for _, topic := range topics {
+
+		for _, w := range wanted {
+
+			if strings.EqualFold(topic, w) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
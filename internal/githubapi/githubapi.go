@@ -0,0 +1,55 @@
+// internal/githubapi/githubapi.go
+// Package githubapi holds what the packages talking to the GitHub REST
+// API share: the authenticated client and the mapping from clone URLs
+// to repository names.
+
+package githubapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/runtime"
+	"github.com/google/go-github/v88/github"
+)
+
+// PerPage is the largest page the GitHub REST API returns.
+const PerPage = 100
+
+// NewClient returns a REST API client authenticated with the stored
+// token.
+func NewClient(layout runtime.Layout) (*github.Client, error) {
+
+	token, err := config.ReadToken(layout)
+	if err != nil {
+		return nil, fmt.Errorf("read github token: %w", err)
+	}
+
+	return github.NewClient(github.WithAuthToken(token))
+}
+
+// SplitURL returns the owner and name of a clone URL.
+func SplitURL(repoURL string) (string, string) {
+
+	parts := strings.Split(strings.TrimSuffix(repoURL, ".git"), "/")
+
+	if len(parts) < 2 {
+		return "", parts[0]
+	}
+
+	return parts[len(parts)-2], parts[len(parts)-1]
+}
+
+// RepositoryName returns "owner/name" for a clone URL, or the URL as it
+// is when it has no owner.
+func RepositoryName(repoURL string) string {
+
+	owner, name := SplitURL(repoURL)
+
+	if owner == "" {
+		return repoURL
+	}
+
+	return owner + "/" + name
+}
@@ -1,6 +1,7 @@
 package health
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,7 +11,9 @@ import (
 	"time"
 
 	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/mirror"
 	"github.com/flarexes/gitback/internal/runtime"
+	"github.com/flarexes/gitback/internal/snapshot"
 	"github.com/flarexes/gitback/internal/state"
 )
 
@@ -24,8 +27,13 @@ func Generate(cfg *config.Config, layout runtime.Layout) (*HealthReport, error)
 		Status: "healthy",
 
 		Retention: RetentionHealth{
-			Enabled: cfg.Snapshot.Retention > 0,
+			Enabled: cfg.Snapshot.RetentionEnabled(),
 			Keep:    cfg.Snapshot.Retention,
+			Daily:   cfg.Snapshot.KeepDaily,
+			Weekly:  cfg.Snapshot.KeepWeekly,
+			Monthly: cfg.Snapshot.KeepMonthly,
+			Yearly:  cfg.Snapshot.KeepYearly,
+			Within:  cfg.Snapshot.KeepWithin,
 		},
 	}
 
@@ -34,9 +42,14 @@ func Generate(cfg *config.Config, layout runtime.Layout) (*HealthReport, error)
 	// returns an error. This keeps the report complete even when one
 	// section can't be gathered.
 	populateAssets(cfg, layout, report)
+	populateMetadata(cfg, layout, report)
 	populateQuarantine(cfg, report)
 	populateSnapshots(cfg, report)
 	populateDisk(cfg, report)
+	populateVerification(layout, report)
+	populateOffsite(cfg, layout, report)
+	populateSafety(layout, report)
+	populateArchive(cfg, layout, report)
 
 	populateWarnings(cfg, report)
 	populateRecommendations(cfg, layout, report)
@@ -72,9 +85,12 @@ func populateAssets(cfg *config.Config, layout runtime.Layout, report *HealthRep
 
 	report.Sync.StartedAt = data.SyncStartedAt
 	report.Sync.CompletedAt = data.SyncCompletedAt
+	report.Sync.LastChangeAt = data.LastChangeAt
 
 	for _, repo := range data.Repositories {
 		report.Repositories.Total++
+		report.Repositories.LFSObjects += repo.LFSObjects
+		report.Repositories.LFSBytes += repo.LFSBytes
 		if repo.LastSuccess {
 			report.Repositories.Healthy++
 		} else {
@@ -82,6 +98,23 @@ func populateAssets(cfg *config.Config, layout runtime.Layout, report *HealthRep
 		}
 	}
 
+	// Wikis are optional as well. Empty wikis count as healthy, but are
+	// tracked separately so the report can show them.
+	if cfg.GitHub.BackupWikis {
+		for _, wiki := range data.Wikis {
+			report.Wikis.Total++
+			switch {
+			case wiki.Empty:
+				report.Wikis.Healthy++
+				report.Wikis.Empty++
+			case wiki.LastSuccess:
+				report.Wikis.Healthy++
+			default:
+				report.Wikis.Failed++
+			}
+		}
+	}
+
 	// Gists are optional per config, so only count them if the user
 	// has gist backup enabled — otherwise report.Gists stays zeroed
 	// and PrintReport skips the section entirely.
@@ -95,6 +128,58 @@ func populateAssets(cfg *config.Config, layout runtime.Layout, report *HealthRep
 			}
 		}
 	}
+
+	// Starred repositories are optional too.
+	if cfg.GitHub.BackupStarred {
+		for _, repo := range data.Starred {
+			report.Starred.Total++
+			if repo.LastSuccess {
+				report.Starred.Healthy++
+			} else {
+				report.Starred.Failed++
+			}
+		}
+	}
+
+	// Release files, and repositories whose releases couldn't be
+	// listed, count the same way.
+	if cfg.GitHub.BackupReleases {
+		for _, release := range data.Releases {
+			report.Releases.Total++
+			if release.LastSuccess {
+				report.Releases.Healthy++
+			} else {
+				report.Releases.Failed++
+			}
+		}
+	}
+}
+
+// populateMetadata counts the repositories whose metadata export
+// succeeded or failed in the last run, if metadata backup is enabled.
+func populateMetadata(cfg *config.Config, layout runtime.Layout, report *HealthReport) {
+
+	if !cfg.GitHub.BackupMetadata {
+		return
+	}
+
+	data, err := state.LoadMetadata(layout.MetadataStateFile)
+	if err != nil {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf("metadata state file is unreadable: %v", err),
+		)
+		return
+	}
+
+	for _, record := range data.Repositories {
+		report.Metadata.Total++
+		if record.LastSuccess {
+			report.Metadata.Healthy++
+		} else {
+			report.Metadata.Failed++
+		}
+	}
 }
 
 // populateQuarantine counts mirrors that remain quarantined after
@@ -109,6 +194,14 @@ func populateQuarantine(cfg *config.Config, report *HealthReport) {
 		)
 	}
 
+	wikis, err := countQuarantinedWikis(cfg)
+	if err != nil {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf("could not inspect quarantined wikis: %v", err),
+		)
+	}
+
 	gists, err := countQuarantinedGists(cfg)
 	if err != nil {
 		report.Warnings = append(
@@ -117,8 +210,18 @@ func populateQuarantine(cfg *config.Config, report *HealthReport) {
 		)
 	}
 
+	starred, err := countQuarantinedStarred(cfg)
+	if err != nil {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf("could not inspect quarantined starred repositories: %v", err),
+		)
+	}
+
 	report.Quarantine.Repositories = repositories
+	report.Quarantine.Wikis = wikis
 	report.Quarantine.Gists = gists
+	report.Quarantine.Starred = starred
 }
 
 // populateSnapshots scans the snapshot output directory and records the
@@ -149,7 +252,7 @@ func populateSnapshots(cfg *config.Config, report *HealthReport) {
 
 		// Only count GitBack's own snapshot archives; ignore any
 		// other files a user might have placed in this directory.
-		if !strings.HasSuffix(name, ".tar.zst") {
+		if !snapshot.IsArchive(name) {
 			continue
 		}
 
@@ -169,6 +272,13 @@ func populateSnapshots(cfg *config.Config, report *HealthReport) {
 		return
 	}
 
+	// Repository snapshots are small indexes; the data they refer to
+	// lives in the shared chunk store.
+	chunks, err := snapshot.RepositorySize(cfg.Snapshot.OutputDirectory)
+	if err == nil {
+		totalSize += chunks
+	}
+
 	report.Snapshots.Size = totalSize
 
 	// Snapshot filenames are timestamp-prefixed, so a lexicographic
@@ -221,13 +331,157 @@ func populateDisk(cfg *config.Config, report *HealthReport) {
 	}
 }
 
+// populateVerification summarizes the last `gitback verify` run. Never
+// having verified is not a warning; it only produces a recommendation.
+func populateVerification(layout runtime.Layout, report *HealthReport) {
+
+	data, err := state.LoadVerification(layout.VerificationStateFile)
+	if err != nil {
+
+		if !errors.Is(err, os.ErrNotExist) {
+			report.Warnings = append(
+				report.Warnings,
+				fmt.Sprintf("verification state file is unreadable: %v", err),
+			)
+		}
+
+		return
+	}
+
+	report.Verification.LastVerifiedAt = data.GeneratedAt
+
+	for _, result := range data.Snapshots {
+
+		report.Verification.Verified++
+
+		if result.Success {
+			report.Verification.Passed++
+			continue
+		}
+
+		report.Verification.Failed++
+		report.Verification.FailedSnapshots = append(
+			report.Verification.FailedSnapshots,
+			result.Snapshot,
+		)
+	}
+}
+
+// populateOffsite reports every configured offsite target, including
+// ones that have never been uploaded to.
+func populateOffsite(cfg *config.Config, layout runtime.Layout, report *HealthReport) {
+
+	if len(cfg.Offsite) == 0 {
+		return
+	}
+
+	data, err := state.LoadOffsite(layout.OffsiteStateFile)
+	if err != nil {
+
+		if !errors.Is(err, os.ErrNotExist) {
+			report.Warnings = append(
+				report.Warnings,
+				fmt.Sprintf("offsite state file is unreadable: %v", err),
+			)
+		}
+
+		data = &state.OffsiteState{}
+	}
+
+	for _, target := range cfg.Offsite {
+
+		entry := OffsiteHealth{
+			Name: target.DisplayName(),
+			Type: target.Type,
+		}
+
+		if result := data.Target(entry.Name); result != nil {
+			entry.LastSnapshot = result.LastSnapshot
+			entry.LastSuccessAt = result.LastSuccessAt
+			entry.LastAttemptAt = result.LastAttemptAt
+			entry.LastError = result.LastError
+		}
+
+		report.Offsite = append(report.Offsite, entry)
+	}
+}
+
+// populateSafety reports an unacknowledged safety alert, which stays
+// critical until an operator acknowledges it.
+func populateSafety(layout runtime.Layout, report *HealthReport) {
+
+	data, err := state.LoadSafety(layout.SafetyStateFile)
+	if err != nil {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf("safety state file is unreadable: %v", err),
+		)
+		return
+	}
+
+	if !data.Active() {
+		return
+	}
+
+	report.Safety = &SafetyHealth{
+		RaisedAt:            data.RaisedAt,
+		Reasons:             data.Reasons,
+		RemovedRepositories: len(data.RemovedRepositories),
+		RewrittenRefs:       len(data.RewrittenRefs),
+	}
+}
+
+// populateArchive counts the mirrors of removed repositories kept in
+// the archive, and orphaned mirrors: ones below the mirror root that no
+// inventory lists and that were never archived.
+func populateArchive(cfg *config.Config, layout runtime.Layout, report *HealthReport) {
+
+	history, err := state.LoadInventoryHistory(layout.InventoryHistoryFile)
+	if err != nil {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf("inventory history is unreadable: %v", err),
+		)
+	} else {
+		for _, record := range history.Repositories {
+			if record.Removed() && record.PurgedAt == "" {
+				report.Archive.Archived += len(record.Archived)
+			}
+		}
+	}
+
+	// Without a repository inventory every mirror would look orphaned;
+	// populateAssets already asks for a sync in that case.
+	repositories, err := state.ReadInventory(layout.RepositoryInventoryFile)
+	if err != nil {
+		return
+	}
+
+	// The wiki, gist and starred inventories are missing when those
+	// backups were never enabled.
+	wikis, _ := state.ReadInventory(layout.WikiInventoryFile)
+	gists, _ := state.ReadInventory(layout.GistInventoryFile)
+	starred, _ := state.ReadInventory(layout.StarredInventoryFile)
+
+	orphans, err := mirror.Orphans(cfg.Storage.MirrorRoot, repositories, wikis, gists, starred)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf("could not inspect mirrors for orphans: %v", err),
+		)
+		return
+	}
+
+	report.Archive.Orphaned = len(orphans)
+}
+
 // populateWarnings appends human-readable warnings derived from counts
 // already gathered by the populate* functions above. This is where
 // thresholds (disk space, retention) are evaluated against config.
 func populateWarnings(cfg *config.Config, report *HealthReport) {
 
-	// Failed assets (repositories + gists)
-	failedAssets := report.Repositories.Failed + report.Gists.Failed
+	// Failed assets (repositories + wikis + gists + releases)
+	failedAssets := report.Repositories.Failed + report.Wikis.Failed + report.Gists.Failed + report.Releases.Failed
 	if failedAssets > 0 {
 		report.Warnings = append(
 			report.Warnings,
@@ -238,8 +492,30 @@ func populateWarnings(cfg *config.Config, report *HealthReport) {
 		)
 	}
 
-	// Quarantine (repositories + gists)
-	quarantined := report.Quarantine.Repositories + report.Quarantine.Gists
+	// Starred repositories
+	if report.Starred.Failed > 0 {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf(
+				"%d starred repositories failed to sync",
+				report.Starred.Failed,
+			),
+		)
+	}
+
+	// Metadata exports
+	if report.Metadata.Failed > 0 {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf(
+				"%d metadata exports failed",
+				report.Metadata.Failed,
+			),
+		)
+	}
+
+	// Quarantine (repositories + wikis + gists + starred)
+	quarantined := report.Quarantine.Repositories + report.Quarantine.Wikis + report.Quarantine.Gists + report.Quarantine.Starred
 	if quarantined > 0 {
 
 		report.Warnings = append(
@@ -251,6 +527,53 @@ func populateWarnings(cfg *config.Config, report *HealthReport) {
 		)
 	}
 
+	// Safety alert
+	if report.Safety != nil {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf(
+				"unacknowledged safety alert raised at %s; pruning and retention are suspended",
+				report.Safety.RaisedAt,
+			),
+		)
+	}
+
+	// Orphaned mirrors
+	if report.Archive.Orphaned > 0 {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf(
+				"%d orphaned mirrors are no longer in any inventory",
+				report.Archive.Orphaned,
+			),
+		)
+	}
+
+	// Snapshot verification
+	if report.Verification.Failed > 0 {
+		report.Warnings = append(
+			report.Warnings,
+			fmt.Sprintf(
+				"%d snapshots failed verification",
+				report.Verification.Failed,
+			),
+		)
+	}
+
+	// Offsite replication
+	for _, target := range report.Offsite {
+
+		if target.LastError != "" {
+			report.Warnings = append(
+				report.Warnings,
+				fmt.Sprintf(
+					"last upload to offsite target %s failed",
+					target.Name,
+				),
+			)
+		}
+	}
+
 	// Disk space
 	for _, disk := range report.Disks {
 		if disk.FreePercent < cfg.Health.MinimumFreeDiskPercent {
@@ -264,8 +587,15 @@ func populateWarnings(cfg *config.Config, report *HealthReport) {
 		}
 	}
 
-	// Snapshot retention
-	if cfg.Snapshot.Retention == 1 {
+	// Snapshot retention; calendar rules always keep more than the
+	// newest snapshot once they have history to work with
+	onlyLast := cfg.Snapshot.KeepDaily == 0 &&
+		cfg.Snapshot.KeepWeekly == 0 &&
+		cfg.Snapshot.KeepMonthly == 0 &&
+		cfg.Snapshot.KeepYearly == 0 &&
+		cfg.Snapshot.KeepWithin == ""
+
+	if cfg.Snapshot.Retention == 1 && onlyLast {
 
 		report.Warnings = append(
 			report.Warnings,
@@ -281,7 +611,7 @@ func populateWarnings(cfg *config.Config, report *HealthReport) {
 func populateRecommendations(cfg *config.Config, layout runtime.Layout, report *HealthReport) {
 
 	// Failed assets
-	if report.Repositories.Failed > 0 || report.Gists.Failed > 0 {
+	if report.Repositories.Failed > 0 || report.Wikis.Failed > 0 || report.Gists.Failed > 0 || report.Releases.Failed > 0 {
 		report.Recommendations = append(
 			report.Recommendations,
 			fmt.Sprintf(
@@ -291,8 +621,27 @@ func populateRecommendations(cfg *config.Config, layout runtime.Layout, report *
 		)
 	}
 
+	// Starred repositories
+	if report.Starred.Failed > 0 {
+		report.Recommendations = append(
+			report.Recommendations,
+			"run `gitback sync` to retry failed starred repositories; until then snapshots keep their last mirrors",
+		)
+	}
+
+	// Metadata exports
+	if report.Metadata.Failed > 0 {
+		report.Recommendations = append(
+			report.Recommendations,
+			fmt.Sprintf(
+				"run `gitback metadata` and inspect %s",
+				layout.MetadataStateFile,
+			),
+		)
+	}
+
 	// Quarantine
-	if report.Quarantine.Repositories > 0 || report.Quarantine.Gists > 0 {
+	if report.Quarantine.Repositories > 0 || report.Quarantine.Wikis > 0 || report.Quarantine.Gists > 0 || report.Quarantine.Starred > 0 {
 
 		report.Recommendations = append(
 			report.Recommendations,
@@ -303,6 +652,64 @@ func populateRecommendations(cfg *config.Config, layout runtime.Layout, report *
 		)
 	}
 
+	// Safety alert
+	if report.Safety != nil {
+		report.Recommendations = append(
+			report.Recommendations,
+			"review the removed repositories and rewritten refs, then run `gitback acknowledge`",
+		)
+	}
+
+	// Orphaned mirrors
+	if report.Archive.Orphaned > 0 {
+		report.Recommendations = append(
+			report.Recommendations,
+			fmt.Sprintf(
+				"run `gitback discover` to archive mirrors of removed repositories, or move orphaned mirrors out of %s",
+				cfg.Storage.MirrorRoot,
+			),
+		)
+	}
+
+	// Snapshot verification
+	if report.Verification.Failed > 0 {
+		report.Recommendations = append(
+			report.Recommendations,
+			fmt.Sprintf(
+				"inspect failed snapshots (%s) and create a fresh snapshot",
+				strings.Join(report.Verification.FailedSnapshots, ", "),
+			),
+		)
+	} else if report.Verification.Verified == 0 && report.Snapshots.Count > 0 {
+		report.Recommendations = append(
+			report.Recommendations,
+			"run `gitback verify` to check snapshot integrity",
+		)
+	}
+
+	// Offsite replication
+	for _, target := range report.Offsite {
+
+		if target.LastError != "" {
+			report.Recommendations = append(
+				report.Recommendations,
+				fmt.Sprintf(
+					"check connectivity and credentials for offsite target %s (%s)",
+					target.Name,
+					target.LastError,
+				),
+			)
+		} else if target.LastSuccessAt == "" && report.Snapshots.Count > 0 {
+			report.Recommendations = append(
+				report.Recommendations,
+				fmt.Sprintf(
+					"no snapshot has been uploaded to offsite target %s yet; create a snapshot",
+					target.Name,
+				),
+			)
+		}
+	}
+
 	// Disk space
 	for _, disk := range report.Disks {
 		if disk.FreePercent < cfg.Health.MinimumFreeDiskPercent {
@@ -333,20 +740,42 @@ func updateStatus(cfg *config.Config, report *HealthReport) {
 
 	report.Status = "healthy"
 
-	if report.Repositories.Failed > 0 || report.Gists.Failed > 0 {
+	if report.Repositories.Failed > 0 || report.Wikis.Failed > 0 || report.Gists.Failed > 0 || report.Releases.Failed > 0 || report.Metadata.Failed > 0 {
+		report.Status = "warning"
+	}
+
+	if report.Quarantine.Repositories > 0 || report.Quarantine.Wikis > 0 || report.Quarantine.Gists > 0 || report.Quarantine.Starred > 0 {
 		report.Status = "warning"
 	}
 
-	if report.Quarantine.Repositories > 0 || report.Quarantine.Gists > 0 {
+	if report.Archive.Orphaned > 0 {
 		report.Status = "warning"
 	}
 
+	for _, target := range report.Offsite {
+		if target.LastError != "" {
+			report.Status = "warning"
+		}
+	}
+
 	for _, disk := range report.Disks {
 		if disk.FreePercent < cfg.Health.MinimumFreeDiskPercent {
 			report.Status = "critical"
 			break
 		}
 	}
+
+	// A snapshot that fails verification may not be restorable, which
+	// is as severe as being unable to write new ones.
+	if report.Verification.Failed > 0 {
+		report.Status = "critical"
+	}
+
+	// A mass deletion or rewrite may be an attack in progress; it stays
+	// critical until someone has looked at it.
+	if report.Safety != nil {
+		report.Status = "critical"
+	}
 }
 
 // diskUsage reports free/total space for the filesystem backing path,
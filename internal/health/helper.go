@@ -12,10 +12,32 @@ import (
 
 // countQuarantinedRepositories returns the number of quarantined repository mirrors.
 func countQuarantinedRepositories(cfg *config.Config) (int, error) {
+	return countQuarantinedOwnerMirrors(
+		filepath.Join(cfg.QuarantineDir(), "repositories"),
+	)
+}
+
+// countQuarantinedWikis returns the number of quarantined wiki mirrors.
+func countQuarantinedWikis(cfg *config.Config) (int, error) {
+	return countQuarantinedOwnerMirrors(
+		filepath.Join(cfg.QuarantineDir(), "wikis"),
+	)
+}
+
+// countQuarantinedStarred returns the number of quarantined starred
+// repository mirrors.
+func countQuarantinedStarred(cfg *config.Config) (int, error) {
+	return countQuarantinedOwnerMirrors(
+		filepath.Join(cfg.QuarantineDir(), "starred"),
+	)
+}
 
-	root := filepath.Join(cfg.QuarantineDir(), "repositories")
+// countQuarantinedOwnerMirrors counts mirrors stored as
+// <root>/<owner>/<name>.git, the layout shared by repositories, wikis
+// and starred repositories.
+func countQuarantinedOwnerMirrors(root string) (int, error) {
 
-	// Missing directory simply means no repositories are quarantined.
+	// Missing directory simply means nothing is quarantined.
 	owners, err := os.ReadDir(root)
 	if os.IsNotExist(err) {
 		return 0, nil
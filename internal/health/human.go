@@ -6,10 +6,35 @@ func PrintReport(report *HealthReport) {
 
 	fmt.Printf("Status: %s\n\n", report.Status)
 
+	if report.Safety != nil {
+		fmt.Println("Safety")
+		fmt.Printf("  Alert raised: %s\n", report.Safety.RaisedAt)
+
+		for _, reason := range report.Safety.Reasons {
+			fmt.Printf("  - %s\n", reason)
+		}
+
+		fmt.Println()
+	}
+
 	fmt.Println("Repositories")
 	fmt.Printf("  Healthy: %d\n", report.Repositories.Healthy)
 	fmt.Printf("  Failed:  %d\n", report.Repositories.Failed)
-	fmt.Printf("  Total:   %d\n\n", report.Repositories.Total)
+	fmt.Printf("  Total:   %d\n", report.Repositories.Total)
+
+	if report.Repositories.LFSObjects > 0 {
+		fmt.Printf("  LFS:     %d objects, %s\n", report.Repositories.LFSObjects, HumanSize(report.Repositories.LFSBytes))
+	}
+
+	fmt.Println()
+
+	if report.Wikis.Total > 0 {
+		fmt.Println("Wikis")
+		fmt.Printf("  Healthy: %d\n", report.Wikis.Healthy)
+		fmt.Printf("  Empty:   %d\n", report.Wikis.Empty)
+		fmt.Printf("  Failed:  %d\n", report.Wikis.Failed)
+		fmt.Printf("  Total:   %d\n\n", report.Wikis.Total)
+	}
 
 	if report.Gists.Total > 0 {
 		fmt.Println("Gists")
@@ -18,22 +43,84 @@ func PrintReport(report *HealthReport) {
 		fmt.Printf("  Total:   %d\n\n", report.Gists.Total)
 	}
 
-	if report.Quarantine.Repositories > 0 || report.Quarantine.Gists > 0 {
+	if report.Starred.Total > 0 {
+		fmt.Println("Starred")
+		fmt.Printf("  Healthy: %d\n", report.Starred.Healthy)
+		fmt.Printf("  Failed:  %d\n", report.Starred.Failed)
+		fmt.Printf("  Total:   %d\n\n", report.Starred.Total)
+	}
+
+	if report.Releases.Total > 0 {
+		fmt.Println("Releases")
+		fmt.Printf("  Healthy: %d\n", report.Releases.Healthy)
+		fmt.Printf("  Failed:  %d\n", report.Releases.Failed)
+		fmt.Printf("  Total:   %d\n\n", report.Releases.Total)
+	}
+
+	if report.Metadata.Total > 0 {
+		fmt.Println("Metadata")
+		fmt.Printf("  Healthy: %d\n", report.Metadata.Healthy)
+		fmt.Printf("  Failed:  %d\n", report.Metadata.Failed)
+		fmt.Printf("  Total:   %d\n\n", report.Metadata.Total)
+	}
+
+	if report.Quarantine.Repositories > 0 || report.Quarantine.Wikis > 0 || report.Quarantine.Gists > 0 || report.Quarantine.Starred > 0 {
 		fmt.Println("Quarantine")
 		fmt.Printf("  Repositories: %d\n", report.Quarantine.Repositories)
-		fmt.Printf("  Gists:        %d\n\n", report.Quarantine.Gists)
+		fmt.Printf("  Wikis:        %d\n", report.Quarantine.Wikis)
+		fmt.Printf("  Gists:        %d\n", report.Quarantine.Gists)
+		fmt.Printf("  Starred:      %d\n\n", report.Quarantine.Starred)
+	}
+
+	if report.Archive.Archived > 0 || report.Archive.Orphaned > 0 {
+		fmt.Println("Archive")
+		fmt.Printf("  Archived: %d\n", report.Archive.Archived)
+		fmt.Printf("  Orphaned: %d\n\n", report.Archive.Orphaned)
 	}
 
 	fmt.Println("Snapshots")
 	fmt.Printf("  Count:  %d\n", report.Snapshots.Count)
 
 	if report.Snapshots.Count > 0 {
-		fmt.Printf("  Size:   %s\n", humanSize(int64(report.Snapshots.Size)))
+		fmt.Printf("  Size:   %s\n", HumanSize(int64(report.Snapshots.Size)))
 		fmt.Printf("  Latest: %s\n", report.Snapshots.Latest)
 	}
 
+	if report.Sync.LastChangeAt != "" {
+		fmt.Printf("  Last change: %s\n", report.Sync.LastChangeAt)
+	}
+
 	fmt.Println()
 
+	if report.Verification.Verified > 0 {
+		fmt.Println("Verification")
+		fmt.Printf("  Last run: %s\n", report.Verification.LastVerifiedAt)
+		fmt.Printf("  Passed:   %d\n", report.Verification.Passed)
+		fmt.Printf("  Failed:   %d\n\n", report.Verification.Failed)
+	}
+
+	if len(report.Offsite) > 0 {
+
+		fmt.Println("Offsite")
+
+		for _, target := range report.Offsite {
+
+			fmt.Printf("  %s\n", target.Name)
+
+			if target.LastSuccessAt == "" {
+				fmt.Println("    Last upload: never")
+			} else {
+				fmt.Printf("    Last upload: %s (%s)\n", target.LastSuccessAt, target.LastSnapshot)
+			}
+
+			if target.LastError != "" {
+				fmt.Printf("    Last error:  %s\n", target.LastError)
+			}
+		}
+
+		fmt.Println()
+	}
+
 	fmt.Println("Storage")
 
 	for _, disk := range report.Disks {
@@ -41,13 +128,13 @@ func PrintReport(report *HealthReport) {
 		fmt.Printf("  %s\n", disk.Path)
 		fmt.Printf(
 			"    Free:  %s (%d%%)\n",
-			humanSize(int64(disk.Free)),
+			HumanSize(int64(disk.Free)),
 			disk.FreePercent,
 		)
 
 		fmt.Printf(
 			"    Total: %s\n",
-			humanSize(int64(disk.Total)),
+			HumanSize(int64(disk.Total)),
 		)
 	}
 
@@ -74,7 +161,8 @@ func PrintReport(report *HealthReport) {
 	}
 }
 
-func humanSize(b int64) string {
+// HumanSize formats a byte count with binary units, e.g. "11.3 KB".
+func HumanSize(b int64) string {
 
 	// Unit names in order.
 	units := []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
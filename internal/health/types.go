@@ -8,15 +8,30 @@ type HealthReport struct {
 	Status string `json:"status"`
 
 	Repositories AssetHealth `json:"repositories"`
+	Wikis        AssetHealth `json:"wikis"`
 	Gists        AssetHealth `json:"gists"`
+	Metadata     AssetHealth `json:"metadata"`
+	Releases     AssetHealth `json:"releases"`
+
+	// Starred failures are reported, but never raise the status: the
+	// repositories belong to third parties.
+	Starred AssetHealth `json:"starred"`
 
 	Quarantine QuarantineHealth `json:"quarantine"`
+	Archive    ArchiveHealth    `json:"archive"`
 
 	Sync      SyncHealth      `json:"sync"`
 	Snapshots SnapshotHealth  `json:"snapshots"`
 	Disks     []DiskHealth    `json:"disks"`
 	Retention RetentionHealth `json:"retention"`
 
+	Verification VerificationHealth `json:"verification"`
+
+	Offsite []OffsiteHealth `json:"offsite,omitempty"`
+
+	// Safety is set while a safety alert is unacknowledged.
+	Safety *SafetyHealth `json:"safety,omitempty"`
+
 	Warnings        []string `json:"warnings,omitempty"`
 	Recommendations []string `json:"recommendations,omitempty"`
 }
@@ -25,11 +40,26 @@ type AssetHealth struct {
 	Total   int `json:"total"`
 	Healthy int `json:"healthy"`
 	Failed  int `json:"failed"`
+	Empty   int `json:"empty,omitempty"`
+
+	// LFSObjects and LFSBytes total the Git LFS objects stored in the
+	// mirrors.
+	LFSObjects int   `json:"lfs_objects,omitempty"`
+	LFSBytes   int64 `json:"lfs_bytes,omitempty"`
 }
 
 type QuarantineHealth struct {
 	Repositories int `json:"repositories"`
+	Wikis        int `json:"wikis"`
 	Gists        int `json:"gists"`
+	Starred      int `json:"starred"`
+}
+
+// ArchiveHealth counts mirrors of repositories that left the inventory:
+// archived ones are kept on purpose, orphaned ones were left behind.
+type ArchiveHealth struct {
+	Archived int `json:"archived"`
+	Orphaned int `json:"orphaned"`
 }
 
 type SnapshotHealth struct {
@@ -49,9 +79,46 @@ type DiskHealth struct {
 type SyncHealth struct {
 	StartedAt   string `json:"started_at,omitempty"`
 	CompletedAt string `json:"completed_at,omitempty"`
+
+	// LastChangeAt is when a sync last found any mirror changed. It
+	// is reported next to the latest snapshot, since snapshots are
+	// skipped while nothing changes.
+	LastChangeAt string `json:"last_change_at,omitempty"`
+}
+
+// VerificationHealth summarizes the most recent `gitback verify` run.
+type VerificationHealth struct {
+	LastVerifiedAt  string   `json:"last_verified_at,omitempty"`
+	Verified        int      `json:"verified"`
+	Passed          int      `json:"passed"`
+	Failed          int      `json:"failed"`
+	FailedSnapshots []string `json:"failed_snapshots,omitempty"`
+}
+
+// OffsiteHealth reports the last upload to one configured offsite target.
+type OffsiteHealth struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	LastSnapshot  string `json:"last_snapshot,omitempty"`
+	LastSuccessAt string `json:"last_success_at,omitempty"`
+	LastAttemptAt string `json:"last_attempt_at,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// SafetyHealth describes an unacknowledged safety alert.
+type SafetyHealth struct {
+	RaisedAt            string   `json:"raised_at"`
+	Reasons             []string `json:"reasons"`
+	RemovedRepositories int      `json:"removed_repositories"`
+	RewrittenRefs       int      `json:"rewritten_refs"`
 }
 
 type RetentionHealth struct {
-	Enabled bool `json:"enabled"`
-	Keep    int  `json:"keep"`
+	Enabled bool   `json:"enabled"`
+	Keep    int    `json:"keep"`
+	Daily   int    `json:"keep_daily,omitempty"`
+	Weekly  int    `json:"keep_weekly,omitempty"`
+	Monthly int    `json:"keep_monthly,omitempty"`
+	Yearly  int    `json:"keep_yearly,omitempty"`
+	Within  string `json:"keep_within,omitempty"`
 }
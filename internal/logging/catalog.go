@@ -10,6 +10,20 @@ type GitHubEvents struct {
 
 	PageFetched string
 
+	OrganizationDiscovered string
+
+	RepositoryExcluded string
+
+	RepositoryRemoved  string
+	RepositoryReturned string
+	RepositoryPurged   string
+	ArchiveFailed      string
+
+	GistMetadataFailed string
+
+	StarredListFailed string
+	StarredRemoved    string
+
 	InventoryLoaded string
 
 	RateLimit string
@@ -46,6 +60,18 @@ type MirrorEvents struct {
 	RecoverySucceeded  string
 	RecoveryFailed     string
 
+	RefRewritten             string
+	PreservedRefsExpired     string
+	PreservedRefsCarryFailed string
+
+	Relocated      string
+	RelocateFailed string
+
+	LFSFetchStarted   string
+	LFSFetchCompleted string
+	LFSFetchFailed    string
+	LFSObjectsMissing string
+
 	StateSaveFailed string
 }
 
@@ -61,22 +87,56 @@ type SnapshotEvents struct {
 	ArchiveStarted   string
 	ArchiveCompleted string
 
-	CompressionStarted   string
-	CompressionCompleted string
-
 	ChecksumStarted   string
 	ChecksumCompleted string
 
+	ManifestSigned string
+
 	Summary string
+	Skipped string
 
 	RetentionDisabled  string
 	RetentionStarted   string
 	RetentionCompleted string
 	RetentionFailed    string
 
+	GarbageCollected        string
+	GarbageCollectionFailed string
+
 	CollisionDetected string
 }
 
+type VerifyEvents struct {
+	Started   string
+	Completed string
+	Failed    string
+
+	ChecksumFailed   string
+	SignatureFailed  string
+	ArchiveFailed    string
+	FsckFailed       string
+	ManifestMismatch string
+	ReleaseMismatch  string
+
+	Summary string
+}
+
+type OffsiteEvents struct {
+	UploadStarted   string
+	UploadCompleted string
+	UploadFailed    string
+	UploadResumed   string
+	UploadAborted   string
+	AbortFailed     string
+
+	Retry string
+
+	RetentionCompleted string
+	RetentionFailed    string
+
+	StateSaveFailed string
+}
+
 type LockEvents struct {
 	Acquired string
 	Released string
@@ -94,6 +154,13 @@ type RestoreEvents struct {
 	Started   string
 	Completed string
 	Failed    string
+
+	ChecksumVerified string
+	Extracted        string
+
+	PushStarted   string
+	PushCompleted string
+	PushFailed    string
 }
 
 type SyncEvents struct {
@@ -105,6 +172,32 @@ type SyncEvents struct {
 	Summary string
 }
 
+type MetadataEvents struct {
+	ExportStarted   string
+	ExportCompleted string
+	ExportFailed    string
+
+	Relocated string
+	Summary   string
+}
+
+type ReleaseEvents struct {
+	ListFailed string
+
+	AssetDownloaded     string
+	AssetDownloadFailed string
+	AssetSkipped        string
+
+	Relocated string
+}
+
+type SafetyEvents struct {
+	ThresholdExceeded string
+	AlertActive       string
+	RetentionBlocked  string
+	Acknowledged      string
+}
+
 type FilesystemEvents struct {
 	DirectoryRecreated string
 }
@@ -118,10 +211,15 @@ type EventCatalog struct {
 	Inventory  InventoryEvents
 	Mirror     MirrorEvents
 	Snapshot   SnapshotEvents
+	Verify     VerifyEvents
+	Offsite    OffsiteEvents
 	Lock       LockEvents
 	Health     HealthEvents
 	Restore    RestoreEvents
 	Sync       SyncEvents
+	Metadata   MetadataEvents
+	Release    ReleaseEvents
+	Safety     SafetyEvents
 	Filesystem FilesystemEvents
 	Doctor     DoctorEvents
 }
@@ -136,6 +234,20 @@ var Events = EventCatalog{
 
 		PageFetched: "github_page_fetched",
 
+		OrganizationDiscovered: "github_organization_discovered",
+
+		RepositoryExcluded: "github_repository_excluded",
+
+		RepositoryRemoved:  "github_repository_removed",
+		RepositoryReturned: "github_repository_returned",
+		RepositoryPurged:   "github_repository_purged",
+		ArchiveFailed:      "github_repository_archive_failed",
+
+		GistMetadataFailed: "github_gist_metadata_failed",
+
+		StarredListFailed: "github_starred_list_failed",
+		StarredRemoved:    "github_starred_removed",
+
 		InventoryLoaded: "inventory_loaded",
 
 		RateLimit: "github_rate_limit",
@@ -171,6 +283,18 @@ var Events = EventCatalog{
 		RecoverySucceeded:  "mirror_recovery_succeeded",
 		RecoveryFailed:     "mirror_recovery_failed",
 
+		RefRewritten:             "mirror_ref_rewritten",
+		PreservedRefsExpired:     "mirror_preserved_refs_expired",
+		PreservedRefsCarryFailed: "mirror_preserved_refs_carry_failed",
+
+		Relocated:      "mirror_relocated",
+		RelocateFailed: "mirror_relocate_failed",
+
+		LFSFetchStarted:   "mirror_lfs_fetch_started",
+		LFSFetchCompleted: "mirror_lfs_fetch_completed",
+		LFSFetchFailed:    "mirror_lfs_fetch_failed",
+		LFSObjectsMissing: "mirror_lfs_objects_missing",
+
 		StateSaveFailed: "mirror_state_save_failed",
 	},
 
@@ -194,22 +318,56 @@ var Events = EventCatalog{
 		ArchiveStarted:   "snapshot_archive_started",
 		ArchiveCompleted: "snapshot_archive_completed",
 
-		CompressionStarted:   "snapshot_compression_started",
-		CompressionCompleted: "snapshot_compression_completed",
-
 		ChecksumStarted:   "snapshot_checksum_started",
 		ChecksumCompleted: "snapshot_checksum_completed",
 
+		ManifestSigned: "snapshot_manifest_signed",
+
 		Summary: "snapshot_summary",
+		Skipped: "snapshot_skipped",
 
 		RetentionDisabled:  "snapshot_retention_disabled",
 		RetentionStarted:   "snapshot_retention_started",
 		RetentionCompleted: "snapshot_retention_completed",
 		RetentionFailed:    "snapshot_retention_failed",
 
+		GarbageCollected:        "snapshot_garbage_collected",
+		GarbageCollectionFailed: "snapshot_garbage_collection_failed",
+
 		CollisionDetected: "snapshot_collision_detected",
 	},
 
+	Verify: VerifyEvents{
+		Started:   "verify_started",
+		Completed: "verify_completed",
+		Failed:    "verify_failed",
+
+		ChecksumFailed:   "verify_checksum_failed",
+		SignatureFailed:  "verify_signature_failed",
+		ArchiveFailed:    "verify_archive_failed",
+		FsckFailed:       "verify_fsck_failed",
+		ManifestMismatch: "verify_manifest_mismatch",
+		ReleaseMismatch:  "verify_release_mismatch",
+
+		Summary: "verify_summary",
+	},
+
+	Offsite: OffsiteEvents{
+		UploadStarted:   "offsite_upload_started",
+		UploadCompleted: "offsite_upload_completed",
+		UploadFailed:    "offsite_upload_failed",
+		UploadResumed:   "offsite_upload_resumed",
+		UploadAborted:   "offsite_upload_aborted",
+		AbortFailed:     "offsite_abort_failed",
+
+		Retry: "offsite_retry",
+
+		RetentionCompleted: "offsite_retention_completed",
+		RetentionFailed:    "offsite_retention_failed",
+
+		StateSaveFailed: "offsite_state_save_failed",
+	},
+
 	Lock: LockEvents{
 		Acquired: "lock_acquired",
 		Released: "lock_released",
@@ -227,6 +385,39 @@ var Events = EventCatalog{
 		Started:   "restore_started",
 		Completed: "restore_completed",
 		Failed:    "restore_failed",
+
+		ChecksumVerified: "restore_checksum_verified",
+		Extracted:        "restore_extracted",
+
+		PushStarted:   "restore_push_started",
+		PushCompleted: "restore_push_completed",
+		PushFailed:    "restore_push_failed",
+	},
+
+	Metadata: MetadataEvents{
+		ExportStarted:   "metadata_export_started",
+		ExportCompleted: "metadata_export_completed",
+		ExportFailed:    "metadata_export_failed",
+
+		Relocated: "metadata_relocated",
+		Summary:   "metadata_summary",
+	},
+
+	Release: ReleaseEvents{
+		ListFailed: "release_list_failed",
+
+		AssetDownloaded:     "release_asset_downloaded",
+		AssetDownloadFailed: "release_asset_download_failed",
+		AssetSkipped:        "release_asset_skipped",
+
+		Relocated: "release_relocated",
+	},
+
+	Safety: SafetyEvents{
+		ThresholdExceeded: "safety_threshold_exceeded",
+		AlertActive:       "safety_alert_active",
+		RetentionBlocked:  "safety_retention_blocked",
+		Acknowledged:      "safety_acknowledged",
 	},
 
 	Filesystem: FilesystemEvents{
@@ -38,6 +38,11 @@ func New(logFile string) (*Logger, error) {
 	}, nil
 }
 
+// RunID returns the identifier attached to every entry of this run.
+func (l *Logger) RunID() string {
+	return l.runID
+}
+
 func (l *Logger) Close() error {
 
 	if l.file == nil {
@@ -0,0 +1,133 @@
+// internal/metadata/document.go
+
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/flarexes/gitback/internal/filesystem"
+)
+
+// FormatVersion is the layout version of the exported files. A file
+// written with another version is exported again from scratch.
+const FormatVersion = 1
+
+// Files exported for every repository, below its metadata directory.
+const (
+	IssuesFile         = "issues.json"
+	PullRequestsFile   = "pull_requests.json"
+	IssueCommentsFile  = "issue_comments.json"
+	ReviewCommentsFile = "review_comments.json"
+	LabelsFile         = "labels.json"
+	MilestonesFile     = "milestones.json"
+)
+
+// document is the format of every exported file: the items as the
+// GitHub REST API returns them, ordered by number or ID.
+type document[T any] struct {
+	Version    int    `json:"version"`
+	Repository string `json:"repository"`
+	Items      []T    `json:"items"`
+}
+
+// loadDocument reads the items of an exported file. ok is false when
+// the file is missing or has another format version, in which case the
+// repository needs a full export.
+func loadDocument[T any](path string) (items []T, ok bool, err error) {
+
+	file, err := os.Open(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer file.Close()
+
+	var data document[T]
+
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return nil, false, fmt.Errorf("load %s: %w", path, err)
+	}
+
+	if data.Version != FormatVersion {
+		return nil, false, nil
+	}
+
+	return data.Items, true, nil
+}
+
+// writeDocument writes items to path and returns the SHA-256 of what
+// was written.
+func writeDocument[T any](path string, repository string, items []T) (string, error) {
+
+	if items == nil {
+		items = []T{}
+	}
+
+	content, err := json.MarshalIndent(
+		document[T]{
+			Version:    FormatVersion,
+			Repository: repository,
+			Items:      items,
+		},
+		"",
+		"  ",
+	)
+	if err != nil {
+		return "", fmt.Errorf("encode %s: %w", filepath.Base(path), err)
+	}
+
+	if err := filesystem.AtomicWriteFile(
+		path,
+		0600,
+		func(w io.Writer) error {
+			_, err := w.Write(append(content, '\n'))
+			return err
+		},
+	); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// merge replaces the items in existing that updated has a newer copy
+// of, adds the new ones, and orders the result by key.
+func merge[T any](existing []T, updated []T, key func(T) int64) []T {
+
+	byKey := make(map[int64]T, len(existing)+len(updated))
+
+	for _, item := range existing {
+		byKey[key(item)] = item
+	}
+
+	for _, item := range updated {
+		byKey[key(item)] = item
+	}
+
+	merged := make([]T, 0, len(byKey))
+
+	for _, item := range byKey {
+		merged = append(merged, item)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return key(merged[i]) < key(merged[j])
+	})
+
+	return merged
+}
@@ -0,0 +1,309 @@
+// internal/metadata/engine.go
+
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/githubapi"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/runtime"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/google/go-github/v88/github"
+)
+
+// Engine exports the GitHub metadata a git mirror doesn't contain:
+// issues, pull requests, their comments, labels and milestones.
+type Engine struct {
+	cfg    *config.Config
+	layout runtime.Layout
+	logger *logging.Logger
+	api    *github.Client
+}
+
+func New(cfg *config.Config, layout runtime.Layout, logger *logging.Logger) (*Engine, error) {
+	api, err := githubapi.NewClient(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{cfg: cfg, layout: layout, logger: logger, api: api}, nil
+}
+
+// RelativePath maps a clone URL to its metadata directory relative to
+// the mirror root: metadata/<owner>/<name>.
+func RelativePath(repoURL string) string {
+
+	owner, name := githubapi.SplitURL(repoURL)
+
+	return filepath.Join("metadata", owner, name)
+}
+
+// Export brings the metadata of every repository in the inventory up
+// to date. A repository that fails keeps its previous export, and the
+// next run asks for everything updated since the last one succeeded.
+func (e *Engine) Export(ctx context.Context) error {
+
+	startedAt := time.Now()
+
+	repositories, err := state.ReadInventory(e.layout.RepositoryInventoryFile)
+
+	if os.IsNotExist(err) {
+
+		fmt.Println("[WARN] Repository inventory missing. Run: gitback discover")
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf(
+			"read repository inventory %s: %w",
+			e.layout.RepositoryInventoryFile,
+			err,
+		)
+	}
+
+	previous, err := state.LoadMetadata(e.layout.MetadataStateFile)
+	if err != nil {
+		return err
+	}
+
+	history, err := state.LoadInventoryHistory(e.layout.InventoryHistoryFile)
+	if err != nil {
+		return err
+	}
+
+	ids := history.RepositoryIDs()
+
+	records := make(map[string]state.MetadataRecord, len(previous.Repositories))
+	byID := make(map[int64]state.MetadataRecord, len(previous.Repositories))
+
+	for _, record := range previous.Repositories {
+
+		records[record.Name] = record
+
+		if record.ID != 0 {
+			byID[record.ID] = record
+		}
+	}
+
+	var exported []state.MetadataRecord
+
+	for i, repo := range repositories {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		record, ok := records[repo]
+
+		// A renamed or transferred repository keeps its export and
+		// continues incrementally under the new path.
+		if moved, found := byID[ids[repo]]; !ok && found {
+
+			record = moved
+
+			e.relocate(moved.Name, repo, ids[repo])
+		}
+
+		record.Name = repo
+		record.ID = ids[repo]
+
+		record, err = e.exportRecord(ctx, record)
+
+		exported = append(exported, record)
+
+		// Every other repository would fail the same way.
+		var rateErr *github.RateLimitError
+
+		if errors.As(err, &rateErr) {
+
+			fmt.Printf("[WARN] GitHub rate limit reached, resets at %s\n", rateErr.Rate.Reset.UTC().Format(time.RFC3339))
+
+			// The rest keep their previous export until the next run.
+			for _, skipped := range repositories[i+1:] {
+				if record, ok := records[skipped]; ok {
+					exported = append(exported, record)
+				}
+			}
+
+			break
+		}
+	}
+
+	sort.Slice(exported, func(i, j int) bool {
+		return exported[i].Name < exported[j].Name
+	})
+
+	if err := state.SaveMetadata(
+		e.layout.MetadataStateFile,
+		state.MetadataState{
+			GeneratedAt:  time.Now().UTC().Format(time.RFC3339),
+			Repositories: exported,
+		},
+	); err != nil {
+		return fmt.Errorf("save metadata state: %w", err)
+	}
+
+	e.printSummary(exported)
+	e.logSummary(startedAt, exported)
+
+	return nil
+}
+
+// exportRecord exports one repository and returns its updated record,
+// along with the error that failed it.
+func (e *Engine) exportRecord(ctx context.Context, record state.MetadataRecord) (state.MetadataRecord, error) {
+
+	start := time.Now()
+
+	owner, name := githubapi.SplitURL(record.Name)
+	repoName := owner + "/" + name
+
+	fmt.Printf("[META] %s\n", repoName)
+
+	e.logger.Info(
+		logging.Events.Metadata.ExportStarted,
+		repoName,
+	)
+
+	// Without a previous successful export, since stays zero and
+	// everything is fetched.
+	since, _ := time.Parse(time.RFC3339, record.Since)
+
+	fingerprint, err := e.exportRepository(
+		ctx,
+		owner,
+		name,
+		filepath.Join(e.cfg.Storage.MirrorRoot, RelativePath(record.Name)),
+		since,
+	)
+
+	if err != nil {
+
+		e.logger.Error(
+			logging.Events.Metadata.ExportFailed,
+			repoName,
+			err,
+		)
+
+		record.LastSuccess = false
+		record.Error = err.Error()
+		record.Fingerprint = ""
+
+		return record, err
+	}
+
+	e.logger.Duration(
+		logging.Events.Metadata.ExportCompleted,
+		repoName,
+		time.Since(start),
+	)
+
+	record.Since = start.UTC().Format(time.RFC3339)
+	record.LastSuccess = true
+	record.Error = ""
+	record.Fingerprint = fingerprint
+
+	return record, nil
+}
+
+// relocate moves the metadata directory of a repository that was
+// renamed or transferred. If it can't, the repository is exported in
+// full at its new path and the old directory stays behind.
+func (e *Engine) relocate(from string, to string, id int64) {
+
+	source := filepath.Join(e.cfg.Storage.MirrorRoot, RelativePath(from))
+	target := filepath.Join(e.cfg.Storage.MirrorRoot, RelativePath(to))
+
+	if _, err := os.Stat(source); err != nil {
+		return
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return
+	}
+
+	if err := os.Rename(source, target); err != nil {
+		return
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Metadata.Relocated,
+			Repo:  path.Join(githubapi.SplitURL(to)),
+
+			Details: map[string]any{
+				"id":   id,
+				"from": RelativePath(from),
+				"to":   RelativePath(to),
+			},
+		},
+	)
+}
+
+func (e *Engine) printSummary(records []state.MetadataRecord) {
+
+	var failed []string
+
+	for _, record := range records {
+		if !record.LastSuccess {
+			failed = append(failed, record.Name)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Metadata")
+
+	fmt.Printf("  Total:   %d\n", len(records))
+	fmt.Printf("  Healthy: %d\n", len(records)-len(failed))
+	fmt.Printf("  Failed:  %d\n", len(failed))
+
+	if len(failed) > 0 {
+
+		fmt.Println()
+		fmt.Println("  Failed repositories:")
+
+		for _, name := range failed {
+			fmt.Printf("    - %s\n", name)
+		}
+	}
+}
+
+func (e *Engine) logSummary(startedAt time.Time, records []state.MetadataRecord) {
+
+	var failed int
+
+	for _, record := range records {
+		if !record.LastSuccess {
+			failed++
+		}
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level:      logging.Info,
+			Event:      logging.Events.Metadata.Summary,
+			DurationMS: time.Since(startedAt).Milliseconds(),
+
+			Details: map[string]any{
+				"repositories_total":   len(records),
+				"repositories_healthy": len(records) - failed,
+				"repositories_failed":  failed,
+			},
+		},
+	)
+}
@@ -0,0 +1,257 @@
+// internal/metadata/export.go
+
+package metadata
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/githubapi"
+	"github.com/google/go-github/v88/github"
+)
+
+// exportRepository brings the exported files of owner/name in dir up to
+// date. With a non-zero since, only issues, pull requests and comments
+// updated after it are fetched and merged into the existing files;
+// labels and milestones are always fetched in full. It returns the
+// fingerprint of the files written.
+func (e *Engine) exportRepository(ctx context.Context, owner string, name string, dir string, since time.Time) (string, error) {
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("create metadata directory: %w", err)
+	}
+
+	repository := owner + "/" + name
+
+	// Any file missing or in an older format means the others can't be
+	// trusted to be complete either.
+	existingIssues, ok, err := loadDocument[*github.Issue](filepath.Join(dir, IssuesFile))
+	if err != nil {
+		return "", err
+	}
+
+	complete := ok
+
+	existingPulls, ok, err := loadDocument[*github.PullRequest](filepath.Join(dir, PullRequestsFile))
+	if err != nil {
+		return "", err
+	}
+
+	complete = complete && ok
+
+	existingIssueComments, ok, err := loadDocument[*github.IssueComment](filepath.Join(dir, IssueCommentsFile))
+	if err != nil {
+		return "", err
+	}
+
+	complete = complete && ok
+
+	existingReviewComments, ok, err := loadDocument[*github.PullRequestComment](filepath.Join(dir, ReviewCommentsFile))
+	if err != nil {
+		return "", err
+	}
+
+	complete = complete && ok
+
+	if !complete {
+		since = time.Time{}
+		existingIssues = nil
+		existingPulls = nil
+		existingIssueComments = nil
+		existingReviewComments = nil
+	}
+
+	// The issues endpoint lists pull requests too; they are kept in
+	// their own file with the fields only pull requests have.
+	issues, err := listAll(ctx, func(opts github.ListOptions) ([]*github.Issue, *github.Response, error) {
+		return e.api.Issues.ListByRepo(ctx, owner, name, &github.IssueListByRepoOptions{
+			State:       "all",
+			Sort:        "updated",
+			Direction:   "asc",
+			Since:       since,
+			ListOptions: opts,
+		})
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("list issues: %w", err)
+	}
+
+	var onlyIssues []*github.Issue
+
+	for _, issue := range issues {
+		if !issue.IsPullRequest() {
+			onlyIssues = append(onlyIssues, issue)
+		}
+	}
+
+	// Pull requests can't be filtered by update time, so they are
+	// listed newest update first until one predates since.
+	pulls, err := listAll(ctx, func(opts github.ListOptions) ([]*github.PullRequest, *github.Response, error) {
+		return e.api.PullRequests.List(ctx, owner, name, &github.PullRequestListOptions{
+			State:       "all",
+			Sort:        "updated",
+			Direction:   "desc",
+			ListOptions: opts,
+		})
+	}, func(pull *github.PullRequest) bool {
+		return !since.IsZero() && pull.GetUpdatedAt().Before(since)
+	})
+	if err != nil {
+		return "", fmt.Errorf("list pull requests: %w", err)
+	}
+
+	issueCommentOptions := &github.IssueListCommentsOptions{
+		Sort:      github.Ptr("updated"),
+		Direction: github.Ptr("asc"),
+	}
+
+	if !since.IsZero() {
+		issueCommentOptions.Since = &since
+	}
+
+	issueComments, err := listAll(ctx, func(opts github.ListOptions) ([]*github.IssueComment, *github.Response, error) {
+		issueCommentOptions.ListOptions = opts
+		return e.api.Issues.ListComments(ctx, owner, name, 0, issueCommentOptions)
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("list issue comments: %w", err)
+	}
+
+	reviewComments, err := listAll(ctx, func(opts github.ListOptions) ([]*github.PullRequestComment, *github.Response, error) {
+		return e.api.PullRequests.ListComments(ctx, owner, name, 0, &github.PullRequestListCommentsOptions{
+			Sort:        "updated",
+			Direction:   "asc",
+			Since:       since,
+			ListOptions: opts,
+		})
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("list review comments: %w", err)
+	}
+
+	labels, err := listAll(ctx, func(opts github.ListOptions) ([]*github.Label, *github.Response, error) {
+		return e.api.Issues.ListLabels(ctx, owner, name, &opts)
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("list labels: %w", err)
+	}
+
+	milestones, err := listAll(ctx, func(opts github.ListOptions) ([]*github.Milestone, *github.Response, error) {
+		return e.api.Issues.ListMilestones(ctx, owner, name, &github.MilestoneListOptions{
+			State:       "all",
+			ListOptions: opts,
+		})
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("list milestones: %w", err)
+	}
+
+	files := []struct {
+		name  string
+		write func(path string) (string, error)
+	}{
+		{IssuesFile, func(path string) (string, error) {
+			return writeDocument(path, repository, merge(existingIssues, onlyIssues, func(issue *github.Issue) int64 {
+				return int64(issue.GetNumber())
+			}))
+		}},
+		{PullRequestsFile, func(path string) (string, error) {
+			return writeDocument(path, repository, merge(existingPulls, pulls, func(pull *github.PullRequest) int64 {
+				return int64(pull.GetNumber())
+			}))
+		}},
+		{IssueCommentsFile, func(path string) (string, error) {
+			return writeDocument(path, repository, merge(existingIssueComments, issueComments, func(comment *github.IssueComment) int64 {
+				return comment.GetID()
+			}))
+		}},
+		{ReviewCommentsFile, func(path string) (string, error) {
+			return writeDocument(path, repository, merge(existingReviewComments, reviewComments, func(comment *github.PullRequestComment) int64 {
+				return comment.GetID()
+			}))
+		}},
+		{LabelsFile, func(path string) (string, error) {
+			return writeDocument(path, repository, merge(nil, labels, func(label *github.Label) int64 {
+				return label.GetID()
+			}))
+		}},
+		{MilestonesFile, func(path string) (string, error) {
+			return writeDocument(path, repository, merge(nil, milestones, func(milestone *github.Milestone) int64 {
+				return int64(milestone.GetNumber())
+			}))
+		}},
+	}
+
+	var sums []string
+
+	for _, file := range files {
+
+		sum, err := file.write(filepath.Join(dir, file.name))
+		if err != nil {
+			return "", fmt.Errorf("write %s: %w", file.name, err)
+		}
+
+		sums = append(sums, file.name+" "+sum)
+	}
+
+	fingerprint := sha256.Sum256([]byte(strings.Join(sums, "\n")))
+
+	return hex.EncodeToString(fingerprint[:]), nil
+}
+
+// listAll fetches every page list returns and collects the items, up
+// to the first for which stop, if given, reports true. A repository
+// with the feature disabled (410 Gone) lists nothing.
+func listAll[T any](
+	ctx context.Context,
+	list func(github.ListOptions) ([]T, *github.Response, error),
+	stop func(T) bool,
+) ([]T, error) {
+
+	var all []T
+
+	opts := github.ListOptions{PerPage: githubapi.PerPage}
+
+	for {
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		items, resp, err := list(opts)
+
+		if err != nil {
+
+			var apiErr *github.ErrorResponse
+
+			if errors.As(err, &apiErr) && apiErr.Response != nil && apiErr.Response.StatusCode == http.StatusGone {
+				return nil, nil
+			}
+
+			return nil, err
+		}
+
+		for _, item := range items {
+
+			if stop != nil && stop(item) {
+				return all, nil
+			}
+
+			all = append(all, item)
+		}
+
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,284 @@
+// internal/metadata/export_test.go
+
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/runtime"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/google/go-github/v88/github"
+)
+
+const testRepository = "https://github.com/octo/widgets.git"
+
+// fakeGitHub serves the endpoints an export lists for octo/widgets. The
+// first run sees the repository as it was, later runs the updates made
+// since, and review comments are disabled (410 Gone) throughout.
+type fakeGitHub struct {
+	run atomic.Int32
+
+	// issuesSince and commentsSince record whether the second run
+	// asked only for what was updated since the first.
+	issuesSince   atomic.Bool
+	commentsSince atomic.Bool
+}
+
+var (
+	longAgo = github.Timestamp{Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	future  = github.Timestamp{Time: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}
+)
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	second := f.run.Load() > 1
+
+	switch r.URL.Path {
+
+	case "/repos/octo/widgets/issues":
+
+		if !second {
+
+			// Two pages, the second holding a pull request, which the
+			// issues endpoint lists too.
+			if r.URL.Query().Get("page") == "" {
+
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=2>; rel="next"`, r.Host, r.URL.Path))
+
+				writeJSON(w, []*github.Issue{
+					{Number: github.Ptr(1), Title: github.Ptr("Crash on start"), UpdatedAt: &longAgo},
+				})
+
+				return
+			}
+
+			writeJSON(w, []*github.Issue{
+				{
+					Number:           github.Ptr(2),
+					Title:            github.Ptr("Fix crash"),
+					UpdatedAt:        &longAgo,
+					PullRequestLinks: &github.PullRequestLinks{URL: github.Ptr("https://api.github.com/repos/octo/widgets/pulls/2")},
+				},
+			})
+
+			return
+		}
+
+		f.issuesSince.Store(r.URL.Query().Get("since") != "")
+
+		writeJSON(w, []*github.Issue{
+			{Number: github.Ptr(1), Title: github.Ptr("Crash on start (regression)"), UpdatedAt: &future},
+		})
+
+	case "/repos/octo/widgets/pulls":
+
+		// Newest update first; the export stops at the first pull
+		// request that predates its since.
+		pulls := []*github.PullRequest{
+			{Number: github.Ptr(2), Title: github.Ptr("Fix crash"), UpdatedAt: &longAgo},
+		}
+
+		if second {
+			pulls = append([]*github.PullRequest{
+				{Number: github.Ptr(3), Title: github.Ptr("Add tests"), UpdatedAt: &future},
+			}, pulls...)
+		}
+
+		writeJSON(w, pulls)
+
+	case "/repos/octo/widgets/issues/comments":
+
+		if !second {
+			writeJSON(w, []*github.IssueComment{{ID: github.Ptr(int64(10)), Body: github.Ptr("Seen it too")}})
+			return
+		}
+
+		f.commentsSince.Store(r.URL.Query().Get("since") != "")
+
+		writeJSON(w, []*github.IssueComment{{ID: github.Ptr(int64(11)), Body: github.Ptr("Still broken")}})
+
+	case "/repos/octo/widgets/pulls/comments":
+
+		w.WriteHeader(http.StatusGone)
+		writeJSON(w, map[string]string{"message": "Pull request review comments are disabled"})
+
+	case "/repos/octo/widgets/labels":
+		writeJSON(w, []*github.Label{{ID: github.Ptr(int64(100)), Name: github.Ptr("bug")}})
+
+	case "/repos/octo/widgets/milestones":
+		writeJSON(w, []*github.Milestone{{Number: github.Ptr(1), Title: github.Ptr("v1.0")}})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(v)
+}
+
+// newTestEngine returns an Engine exporting testRepository from fake
+// into a temporary mirror root.
+func newTestEngine(t *testing.T, fake http.Handler) *Engine {
+
+	t.Helper()
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	layout := runtime.NewWithRoot(t.TempDir())
+
+	if err := layout.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := state.WriteInventory(layout.RepositoryInventoryFile, []string{testRepository}); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := logging.New(layout.LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { logger.Close() })
+
+	base := server.URL + "/"
+
+	api, err := github.NewClient(github.WithURLs(&base, &base))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Storage.MirrorRoot = filepath.Join(t.TempDir(), "mirrors")
+
+	return &Engine{cfg: cfg, layout: layout, logger: logger, api: api}
+}
+
+func TestExportFullThenIncremental(t *testing.T) {
+
+	fake := &fakeGitHub{}
+	engine := newTestEngine(t, fake)
+	ctx := context.Background()
+
+	dir := filepath.Join(engine.cfg.Storage.MirrorRoot, RelativePath(testRepository))
+
+	fake.run.Store(1)
+
+	if err := engine.Export(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	first := loadRecord(t, engine)
+
+	if !first.LastSuccess || first.Since == "" || first.Fingerprint == "" {
+		t.Fatalf("first export recorded %+v", first)
+	}
+
+	assertNumbers(t, filepath.Join(dir, IssuesFile), func(issue *github.Issue) int64 { return int64(issue.GetNumber()) }, 1)
+	assertNumbers(t, filepath.Join(dir, PullRequestsFile), func(pull *github.PullRequest) int64 { return int64(pull.GetNumber()) }, 2)
+	assertNumbers(t, filepath.Join(dir, IssueCommentsFile), (*github.IssueComment).GetID, 10)
+	assertNumbers(t, filepath.Join(dir, ReviewCommentsFile), (*github.PullRequestComment).GetID)
+	assertNumbers(t, filepath.Join(dir, LabelsFile), (*github.Label).GetID, 100)
+	assertNumbers(t, filepath.Join(dir, MilestonesFile), func(milestone *github.Milestone) int64 { return int64(milestone.GetNumber()) }, 1)
+
+	fake.run.Store(2)
+
+	if err := engine.Export(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !fake.issuesSince.Load() || !fake.commentsSince.Load() {
+		t.Fatal("second export didn't ask for updates since the first")
+	}
+
+	second := loadRecord(t, engine)
+
+	if !second.LastSuccess || second.Fingerprint == first.Fingerprint {
+		t.Fatalf("second export recorded %+v", second)
+	}
+
+	issues := assertNumbers(t, filepath.Join(dir, IssuesFile), func(issue *github.Issue) int64 { return int64(issue.GetNumber()) }, 1)
+
+	if issues[0].GetTitle() != "Crash on start (regression)" {
+		t.Fatalf("issue 1 not updated: %q", issues[0].GetTitle())
+	}
+
+	assertNumbers(t, filepath.Join(dir, PullRequestsFile), func(pull *github.PullRequest) int64 { return int64(pull.GetNumber()) }, 2, 3)
+	assertNumbers(t, filepath.Join(dir, IssueCommentsFile), (*github.IssueComment).GetID, 10, 11)
+	assertNumbers(t, filepath.Join(dir, ReviewCommentsFile), (*github.PullRequestComment).GetID)
+}
+
+func TestListAllGone(t *testing.T) {
+
+	engine := newTestEngine(t, &fakeGitHub{})
+
+	comments, err := listAll(context.Background(), func(opts github.ListOptions) ([]*github.PullRequestComment, *github.Response, error) {
+		return engine.api.PullRequests.ListComments(context.Background(), "octo", "widgets", 0, &github.PullRequestListCommentsOptions{ListOptions: opts})
+	}, nil)
+	if err != nil {
+		t.Fatalf("410 Gone returned %v", err)
+	}
+
+	if len(comments) != 0 {
+		t.Fatalf("410 Gone listed %d comments", len(comments))
+	}
+}
+
+func loadRecord(t *testing.T, engine *Engine) state.MetadataRecord {
+
+	t.Helper()
+
+	data, err := state.LoadMetadata(engine.layout.MetadataStateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data.Repositories) != 1 || data.Repositories[0].Name != testRepository {
+		t.Fatalf("metadata state holds %+v", data.Repositories)
+	}
+
+	return data.Repositories[0]
+}
+
+// assertNumbers checks that the exported file at path holds exactly the
+// items with the given keys, in order, and returns them.
+func assertNumbers[T any](t *testing.T, path string, key func(T) int64, want ...int64) []T {
+
+	t.Helper()
+
+	items, ok, err := loadDocument[T](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Fatalf("%s missing", filepath.Base(path))
+	}
+
+	got := make([]int64, 0, len(items))
+
+	for _, item := range items {
+		got = append(got, key(item))
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("%s holds %v, want %v", filepath.Base(path), got, want)
+	}
+
+	return items
+}
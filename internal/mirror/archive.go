@@ -0,0 +1,148 @@
+// internal/mirror/archive.go
+
+package mirror
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ArchiveDirectory holds the mirrors of repositories that left the
+// inventory, below the mirror root and with the same layout, so they
+// stay in snapshots without being synced.
+const ArchiveDirectory = "archived"
+
+// RepositoryMirrors returns the mirror paths, relative to the mirror
+// root, that belong to the repository with clone URL repoURL: its own
+// and its wiki's.
+func RepositoryMirrors(repoURL string) []string {
+
+	return []string{
+		repositoryRelativePath(repoURL),
+		wikiRelativePath(repositoryWikiURL(repoURL)),
+	}
+}
+
+// repositoryWikiURL returns the clone URL of the wiki belonging to the
+// repository with clone URL repoURL.
+func repositoryWikiURL(repoURL string) string {
+	return strings.TrimSuffix(repoURL, ".git") + ".wiki.git"
+}
+
+// IsArchived reports whether relative, a path below the mirror root,
+// lies in the archive.
+func IsArchived(relative string) bool {
+	return strings.HasPrefix(filepath.ToSlash(relative), ArchiveDirectory+"/")
+}
+
+// Archive moves the mirror, or other directory, at relative below root
+// into the archive and returns its new relative path. If that place is
+// taken by an earlier archived copy, the new one gets a timestamp, as
+// in quarantine.
+func Archive(root string, relative string, now time.Time) (string, error) {
+
+	archived := filepath.Join(ArchiveDirectory, relative)
+
+	if _, err := os.Stat(filepath.Join(root, archived)); err == nil {
+
+		suffix := filepath.Ext(archived)
+
+		if suffix != ".git" {
+			suffix = ""
+		}
+
+		archived = strings.TrimSuffix(archived, suffix) +
+			"." + now.UTC().Format("20060102T150405Z") + suffix
+	}
+
+	target := filepath.Join(root, archived)
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return "", fmt.Errorf("create archive directory: %w", err)
+	}
+
+	if err := os.Rename(filepath.Join(root, relative), target); err != nil {
+		return "", fmt.Errorf("archive %s: %w", relative, err)
+	}
+
+	return archived, nil
+}
+
+// archiveStamp matches the timestamp Archive adds on a collision.
+var archiveStamp = regexp.MustCompile(`\.\d{8}T\d{6}Z(\.git)?$`)
+
+// Unarchive moves the archived mirror at archived, relative to root,
+// back to where it was archived from and returns that path. It never
+// replaces a mirror already there.
+func Unarchive(root string, archived string) (string, error) {
+
+	relative := archiveStamp.ReplaceAllString(
+		strings.TrimPrefix(filepath.ToSlash(archived), ArchiveDirectory+"/"),
+		"$1",
+	)
+
+	target := filepath.Join(root, filepath.FromSlash(relative))
+
+	if _, err := os.Stat(target); err == nil {
+		return "", fmt.Errorf("restore %s: a mirror already exists at %s", archived, relative)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(filepath.Join(root, filepath.FromSlash(archived)), target); err != nil {
+		return "", fmt.Errorf("restore %s: %w", archived, err)
+	}
+
+	return relative, nil
+}
+
+// Orphans returns the mirrors below root, relative to it, that none of
+// the inventories lists and that aren't archived: left behind by a
+// repository that disappeared before removals were tracked, or whose
+// archiving failed.
+func Orphans(root string, repositories []string, wikis []string, gists []string, starred []string) ([]string, error) {
+
+	listed := make(map[string]struct{})
+
+	for _, url := range repositories {
+		listed[repositoryRelativePath(url)] = struct{}{}
+	}
+
+	for _, url := range wikis {
+		listed[wikiRelativePath(url)] = struct{}{}
+	}
+
+	for _, url := range gists {
+		listed[gistRelativePath(url)] = struct{}{}
+	}
+
+	for _, url := range starred {
+		listed[starredRelativePath(url)] = struct{}{}
+	}
+
+	mirrors, err := Find(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []string
+
+	for _, relative := range mirrors {
+
+		if IsArchived(relative) {
+			continue
+		}
+
+		if _, ok := listed[relative]; !ok {
+			orphans = append(orphans, relative)
+		}
+	}
+
+	return orphans, nil
+}
@@ -0,0 +1,47 @@
+// internal/mirror/archive_test.go
+
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchiveRoundTripsDirectoriesOnCollision(t *testing.T) {
+
+	root := t.TempDir()
+
+	for _, relative := range []string{
+		filepath.Join("releases", "octocat", "hello"),
+		filepath.Join("repositories", "octocat", "hello.git"),
+	} {
+
+		// An earlier copy already takes the plain archive path.
+		for _, dir := range []string{relative, filepath.Join(ArchiveDirectory, relative)} {
+
+			if err := os.MkdirAll(filepath.Join(root, dir), 0700); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		archived, err := Archive(root, relative, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if archived == filepath.Join(ArchiveDirectory, relative) {
+			t.Fatalf("%s archived over the earlier copy", relative)
+		}
+
+		restored, err := Unarchive(root, archived)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if restored != filepath.ToSlash(relative) {
+			t.Fatalf("%s came back as %s", archived, restored)
+		}
+	}
+}
@@ -16,6 +16,7 @@ type Engine struct {
 	cfg    *config.Config
 	layout runtime.Layout
 	logger *logging.Logger
+	safety *safetyGuard
 }
 
 func New(cfg *config.Config, layout runtime.Layout, logger *logging.Logger) *Engine {
@@ -30,6 +31,16 @@ func (e *Engine) Sync(ctx context.Context) error {
 
 	syncStartedAt := time.Now()
 
+	// Check for mass removal before any mirror is updated, so pruning
+	// is already suspended if it trips.
+	ids := e.repositoryIDs()
+
+	e.safety = e.startSafety(ids)
+
+	// Move the mirrors of renamed and transferred repositories before
+	// the workers would clone them again under their new name.
+	e.relocateRepositories(ctx, ids)
+
 	// Sync repositories
 	repositories, err := e.syncRepositories(
 		ctx,
@@ -39,6 +50,22 @@ func (e *Engine) Sync(ctx context.Context) error {
 		return err
 	}
 
+	for i := range repositories {
+		repositories[i].ID = ids[repositories[i].Name]
+	}
+
+	// Sync wikis
+	var wikis []state.Asset
+
+	if e.cfg.GitHub.BackupWikis {
+
+		wikis, err = e.syncWikis(ctx)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	// Sync Gists
 	var gists []state.Asset
 
@@ -51,21 +78,96 @@ func (e *Engine) Sync(ctx context.Context) error {
 		}
 	}
 
+	// Sync starred repositories
+	var starred []state.Asset
+
+	if e.cfg.GitHub.BackupStarred {
+
+		starred = e.syncStarred(ctx)
+	}
+
+	// Download releases
+	var releases []state.Asset
+
+	if e.cfg.GitHub.BackupReleases {
+
+		releases, err = e.syncReleases(ctx, ids)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// Refs deleted upstream are only pruned once every update has been
+	// counted against the safety limits.
+	e.pruneMirrors(ctx)
+
 	printSyncSummary("Repositories", repositories)
 
+	if e.cfg.GitHub.BackupWikis {
+		printSyncSummary("Wikis", wikis)
+	}
+
 	if e.cfg.GitHub.BackupGists {
 		printSyncSummary("Gists", gists)
 	}
 
+	if e.cfg.GitHub.BackupStarred {
+		printSyncSummary("Starred", starred)
+	}
+
+	if e.cfg.GitHub.BackupReleases {
+		printSyncSummary("Releases", releases)
+	}
+
 	syncCompletedAt := time.Now()
 
+	if err := e.finishSafety(syncCompletedAt); err != nil {
+
+		e.logger.Error(
+			logging.Events.Mirror.StateSaveFailed,
+			"",
+			err,
+		)
+
+		return err
+	}
+
+	// Record what every mirror looks like now, so snapshots can tell
+	// whether anything changed since the last one.
+	e.recordFingerprints(ctx, repositories, repositoryRelativePath)
+	e.recordFingerprints(ctx, wikis, wikiRelativePath)
+	e.recordFingerprints(ctx, gists, gistRelativePath)
+	e.recordFingerprints(ctx, starred, starredRelativePath)
+
+	e.recordLFS(repositories, repositoryRelativePath)
+	e.recordLFS(wikis, wikiRelativePath)
+	e.recordLFS(starred, starredRelativePath)
+
+	e.recordGistMetadata(gists)
+
+	lastChangeAt := e.lastChange(
+		syncCompletedAt,
+		&state.MirrorState{
+			Repositories: repositories,
+			Wikis:        wikis,
+			Gists:        gists,
+			Releases:     releases,
+			Starred:      starred,
+		},
+	)
+
 	// Save assets metadata such URL with their failed/success status
 	if err := state.SaveMirrors(
 		e.layout.MirrorsStateFile,
 		syncStartedAt,
 		syncCompletedAt,
+		lastChangeAt,
 		repositories,
 		gists,
+		wikis,
+		releases,
+		starred,
 	); err != nil {
 
 		e.logger.Error(
@@ -78,21 +180,53 @@ func (e *Engine) Sync(ctx context.Context) error {
 	}
 
 	// Log sync summary
-	e.logSyncSummary(syncStartedAt, repositories, gists)
+	e.logSyncSummary(syncStartedAt, repositories, wikis, gists, releases, starred)
 
 	return nil
 }
 
+// lastChange returns when the mirrors last changed: the previous sync's
+// time if current matches what it recorded, otherwise now.
+func (e *Engine) lastChange(now time.Time, current *state.MirrorState) time.Time {
+
+	previous, err := state.LoadMirrors(e.layout.MirrorsStateFile)
+	if err != nil || previous.LastChangeAt == "" {
+		return now
+	}
+
+	fingerprint := current.Fingerprint()
+
+	if fingerprint == "" || fingerprint != previous.Fingerprint() {
+		return now
+	}
+
+	changedAt, err := time.Parse(time.RFC3339, previous.LastChangeAt)
+	if err != nil {
+		return now
+	}
+
+	return changedAt
+}
+
 func (e *Engine) logSyncSummary(
 	syncStartedAt time.Time,
 	repositories []state.Asset,
+	wikis []state.Asset,
 	gists []state.Asset,
+	releases []state.Asset,
+	starred []state.Asset,
 ) {
 	var repositoryHealthy int
 	var repositoryFailed int
 
+	var lfsObjects int
+	var lfsBytes int64
+
 	for _, repo := range repositories {
 
+		lfsObjects += repo.LFSObjects
+		lfsBytes += repo.LFSBytes
+
 		if repo.LastSuccess {
 			repositoryHealthy++
 		} else {
@@ -100,6 +234,22 @@ func (e *Engine) logSyncSummary(
 		}
 	}
 
+	var wikiHealthy int
+	var wikiEmpty int
+	var wikiFailed int
+
+	for _, wiki := range wikis {
+
+		switch {
+		case wiki.Empty:
+			wikiEmpty++
+		case wiki.LastSuccess:
+			wikiHealthy++
+		default:
+			wikiFailed++
+		}
+	}
+
 	var gistHealthy int
 	var gistFailed int
 
@@ -112,6 +262,30 @@ func (e *Engine) logSyncSummary(
 		}
 	}
 
+	var releaseHealthy int
+	var releaseFailed int
+
+	for _, release := range releases {
+
+		if release.LastSuccess {
+			releaseHealthy++
+		} else {
+			releaseFailed++
+		}
+	}
+
+	var starredHealthy int
+	var starredFailed int
+
+	for _, repo := range starred {
+
+		if repo.LastSuccess {
+			starredHealthy++
+		} else {
+			starredFailed++
+		}
+	}
+
 	// Run-level summary event.
 	e.logger.Emit(
 		logging.Entry{
@@ -124,10 +298,29 @@ func (e *Engine) logSyncSummary(
 				"repositories_healthy": repositoryHealthy,
 				"repositories_failed":  repositoryFailed,
 
+				"lfs_objects": lfsObjects,
+				"lfs_bytes":   lfsBytes,
+
+				"wikis_enabled": e.cfg.GitHub.BackupWikis,
+				"wikis_total":   len(wikis),
+				"wikis_healthy": wikiHealthy,
+				"wikis_empty":   wikiEmpty,
+				"wikis_failed":  wikiFailed,
+
 				"gists_enabled": e.cfg.GitHub.BackupGists,
 				"gists_total":   len(gists),
 				"gists_healthy": gistHealthy,
 				"gists_failed":  gistFailed,
+
+				"releases_enabled": e.cfg.GitHub.BackupReleases,
+				"releases_total":   len(releases),
+				"releases_healthy": releaseHealthy,
+				"releases_failed":  releaseFailed,
+
+				"starred_enabled": e.cfg.GitHub.BackupStarred,
+				"starred_total":   len(starred),
+				"starred_healthy": starredHealthy,
+				"starred_failed":  starredFailed,
 			},
 		},
 	)
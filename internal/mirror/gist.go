@@ -14,13 +14,6 @@ import (
 	"github.com/flarexes/gitback/internal/state"
 )
 
-func (e *Engine) gistMirrorRoot() string {
-	return filepath.Join(
-		e.cfg.Storage.MirrorRoot,
-		"gists",
-	)
-}
-
 func (e *Engine) extractGistName(gistURL string) string {
 
 	return strings.TrimSuffix(
@@ -31,13 +24,22 @@ func (e *Engine) extractGistName(gistURL string) string {
 
 func (e *Engine) gistMirrorPath(gistURL string) string {
 
+	return filepath.Join(
+		e.cfg.Storage.MirrorRoot,
+		gistRelativePath(gistURL),
+	)
+}
+
+// gistRelativePath maps a gist pull URL to gists/<id>.git.
+func gistRelativePath(gistURL string) string {
+
 	id := strings.TrimSuffix(
 		filepath.Base(gistURL),
 		".git",
 	)
 
 	return filepath.Join(
-		e.gistMirrorRoot(),
+		"gists",
 		id+".git",
 	)
 }
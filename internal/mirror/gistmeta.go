@@ -0,0 +1,174 @@
+// internal/mirror/gistmeta.go
+
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/filesystem"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/google/go-github/v88/github"
+)
+
+// GistMetadataVersion is the layout version of gist metadata files.
+const GistMetadataVersion = 1
+
+// GistMetadata is what a gist's git repository doesn't hold: its
+// description, visibility, file names, forks and comments, as the
+// GitHub REST API returns them. It is kept in gists/<id>.json, next to
+// the mirror.
+type GistMetadata struct {
+	Version int `json:"version"`
+
+	Gist     *github.Gist          `json:"gist"`
+	Forks    []*github.GistFork    `json:"forks"`
+	Comments []*github.GistComment `json:"comments"`
+
+	// Starred reports whether the backed up account starred the gist.
+	Starred bool `json:"starred"`
+}
+
+// GistMetadataPath maps a gist pull URL to gists/<id>.json, relative to
+// the mirror root. Like release files, it always uses forward slashes.
+func GistMetadataPath(gistURL string) string {
+
+	id := strings.TrimSuffix(
+		path.Base(gistURL),
+		".git",
+	)
+
+	return path.Join(
+		"gists",
+		id+".json",
+	)
+}
+
+// WriteGistMetadata writes metadata to target.
+func WriteGistMetadata(target string, metadata GistMetadata) error {
+
+	if metadata.Comments == nil {
+		metadata.Comments = []*github.GistComment{}
+	}
+
+	if metadata.Forks == nil {
+		metadata.Forks = []*github.GistFork{}
+	}
+
+	metadata.Version = GistMetadataVersion
+
+	content, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode gist metadata: %w", err)
+	}
+
+	content = append(content, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return fmt.Errorf("create gist directory: %w", err)
+	}
+
+	return filesystem.AtomicWriteFile(
+		target,
+		0600,
+		func(w io.Writer) error {
+			_, err := w.Write(content)
+			return err
+		},
+	)
+}
+
+// LoadGistMetadata reads a gist metadata file.
+func LoadGistMetadata(file string) (*GistMetadata, error) {
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata GistMetadata
+
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+
+	if metadata.Version != GistMetadataVersion || metadata.Gist == nil {
+		return nil, fmt.Errorf("%s: unsupported gist metadata version %d", file, metadata.Version)
+	}
+
+	return &metadata, nil
+}
+
+// ListGistMetadata reads every gist metadata file below root, ordered
+// by gist ID.
+func ListGistMetadata(root string) ([]*GistMetadata, error) {
+
+	entries, err := os.ReadDir(filepath.Join(root, "gists"))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var all []*GistMetadata
+
+	for _, entry := range entries {
+
+		if !entry.Type().IsRegular() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		metadata, err := LoadGistMetadata(filepath.Join(root, "gists", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, metadata)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Gist.GetID() < all[j].Gist.GetID()
+	})
+
+	return all, nil
+}
+
+// recordGistMetadata stores the description and the SHA-256 of every
+// gist's metadata file in its asset, so a snapshot notices edits that
+// don't touch the gist's refs.
+func (e *Engine) recordGistMetadata(assets []state.Asset) {
+
+	for i, asset := range assets {
+
+		file := filepath.Join(e.cfg.Storage.MirrorRoot, filepath.FromSlash(GistMetadataPath(asset.Name)))
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		var metadata GistMetadata
+
+		if err := json.Unmarshal(content, &metadata); err != nil || metadata.Gist == nil {
+			continue
+		}
+
+		sum := sha256.Sum256(content)
+
+		assets[i].Description = metadata.Gist.GetDescription()
+		assets[i].Metadata = hex.EncodeToString(sum[:])
+	}
+}
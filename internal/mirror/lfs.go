@@ -0,0 +1,376 @@
+// internal/mirror/lfs.go
+
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// lfsBatch bounds how many branch tips a single git grep searches, so
+// repositories with thousands of branches stay within argument limits.
+const lfsBatch = 100
+
+// ErrLFSUnavailable is returned for a mirror that uses Git LFS when the
+// git-lfs binary isn't installed.
+var ErrLFSUnavailable = errors.New("mirror uses Git LFS but git-lfs is not installed")
+
+// LFSAvailable reports whether the git-lfs binary is installed.
+func LFSAvailable() bool {
+
+	_, err := exec.LookPath("git-lfs")
+
+	return err == nil
+}
+
+// LFSObjectsDir is where git-lfs keeps the objects of a bare mirror.
+func LFSObjectsDir(gitDir string) string {
+	return filepath.Join(gitDir, "lfs", "objects")
+}
+
+// usesLFS reports whether a .gitattributes file on any branch of the
+// mirror at gitDir tracks files with Git LFS.
+func usesLFS(ctx context.Context, gitDir string) (bool, error) {
+
+	output, err := exec.CommandContext(
+		ctx,
+		"git",
+		"-C",
+		gitDir,
+		"for-each-ref",
+		"--format=%(objectname)",
+		"refs/heads",
+	).Output()
+
+	if err != nil {
+		return false, fmt.Errorf("list branches of %s: %w", gitDir, err)
+	}
+
+	tips := strings.Fields(string(output))
+
+	// Branches often share a tip; each only needs searching once.
+	sort.Strings(tips)
+
+	var unique []string
+
+	for i, tip := range tips {
+		if i == 0 || tip != tips[i-1] {
+			unique = append(unique, tip)
+		}
+	}
+
+	for start := 0; start < len(unique); start += lfsBatch {
+
+		end := min(start+lfsBatch, len(unique))
+
+		args := []string{"-C", gitDir, "grep", "-q", "-F", "filter=lfs"}
+		args = append(args, unique[start:end]...)
+		args = append(args, "--", ":(glob)**/.gitattributes")
+
+		err := exec.CommandContext(ctx, "git", args...).Run()
+
+		if err == nil {
+			return true, nil
+		}
+
+		// git grep exits with 1 when nothing matched.
+		var exitErr *exec.ExitError
+
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return false, fmt.Errorf("search .gitattributes of %s: %w", gitDir, err)
+		}
+	}
+
+	return false, nil
+}
+
+// fetchLFS downloads the LFS objects referenced by every ref of the
+// mirror at gitDir, if it uses LFS, with the same credentials as the
+// git commands in env.
+func (e *Engine) fetchLFS(ctx context.Context, repoName string, gitDir string, env []string) error {
+
+	if !e.cfg.Sync.LFS {
+		return nil
+	}
+
+	uses, err := usesLFS(ctx, gitDir)
+	if err != nil {
+		return err
+	}
+
+	if !uses {
+		return nil
+	}
+
+	if !LFSAvailable() {
+
+		e.logger.Error(
+			logging.Events.Mirror.LFSFetchFailed,
+			repoName,
+			ErrLFSUnavailable,
+		)
+
+		return ErrLFSUnavailable
+	}
+
+	start := time.Now()
+
+	e.logger.Info(
+		logging.Events.Mirror.LFSFetchStarted,
+		repoName,
+	)
+
+	output, err := e.runGit(
+		ctx,
+		repoName,
+		env,
+
+		"-C",
+		gitDir,
+		"lfs",
+		"fetch",
+		"--all",
+	)
+
+	if err != nil {
+
+		fetchErr := fmt.Errorf("git lfs fetch: %s", gitErrorMessage(output, err))
+
+		e.logger.Error(
+			logging.Events.Mirror.LFSFetchFailed,
+			repoName,
+			fetchErr,
+		)
+
+		return fetchErr
+	}
+
+	e.logger.Duration(
+		logging.Events.Mirror.LFSFetchCompleted,
+		repoName,
+		time.Since(start),
+	)
+
+	return nil
+}
+
+// lfsPointer is an LFS object referenced from the mirror's history, as
+// `git lfs ls-files --json` lists it.
+type lfsPointer struct {
+	Name string `json:"name"`
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// missingLFSObjects returns the LFS objects referenced by any ref of the
+// mirror at gitDir that aren't stored in it, or stored with the wrong
+// size.
+func missingLFSObjects(ctx context.Context, gitDir string) ([]lfsPointer, error) {
+
+	output, err := exec.CommandContext(
+		ctx,
+		"git",
+		"-C",
+		gitDir,
+		"lfs",
+		"ls-files",
+		"--all",
+		"--json",
+	).Output()
+
+	if err != nil {
+		return nil, fmt.Errorf("list LFS objects of %s: %w", gitDir, err)
+	}
+
+	var listing struct {
+		Files []lfsPointer `json:"files"`
+	}
+
+	if err := json.Unmarshal(output, &listing); err != nil {
+		return nil, fmt.Errorf("parse LFS objects of %s: %w", gitDir, err)
+	}
+
+	var missing []lfsPointer
+
+	seen := make(map[string]struct{}, len(listing.Files))
+
+	for _, pointer := range listing.Files {
+
+		if _, ok := seen[pointer.OID]; ok || len(pointer.OID) < 4 {
+			continue
+		}
+
+		seen[pointer.OID] = struct{}{}
+
+		info, err := os.Stat(filepath.Join(gitDir, LFSObjectPath(pointer.OID)))
+
+		if err != nil || info.Size() != pointer.Size {
+			missing = append(missing, pointer)
+		}
+	}
+
+	return missing, nil
+}
+
+// checkLFS logs the LFS objects the mirror at gitDir is missing. They
+// aren't treated as corruption: the fetch that follows every update
+// downloads them again, and fails the sync if it can't.
+func (e *Engine) checkLFS(ctx context.Context, repoName string, gitDir string) {
+
+	if !e.cfg.Sync.LFS || !LFSAvailable() {
+		return
+	}
+
+	uses, err := usesLFS(ctx, gitDir)
+	if err != nil || !uses {
+		return
+	}
+
+	missing, err := missingLFSObjects(ctx, gitDir)
+
+	if err != nil {
+
+		e.logger.Warn(
+			logging.Events.Mirror.LFSObjectsMissing,
+			repoName,
+			err.Error(),
+		)
+
+		return
+	}
+
+	if len(missing) == 0 {
+		return
+	}
+
+	var examples []string
+
+	for _, pointer := range missing[:min(len(missing), 10)] {
+		examples = append(examples, pointer.Name)
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Warn,
+			Event: logging.Events.Mirror.LFSObjectsMissing,
+			Repo:  repoName,
+
+			Details: map[string]any{
+				"missing":  len(missing),
+				"examples": examples,
+			},
+		},
+	)
+}
+
+// LFSUsage counts the LFS objects stored in the mirror at gitDir and
+// their total size.
+func LFSUsage(gitDir string) (int, int64, error) {
+
+	var objects int
+	var size int64
+
+	err := filepath.WalkDir(LFSObjectsDir(gitDir), func(path string, entry fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		objects++
+		size += info.Size()
+
+		return nil
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, nil
+	}
+
+	return objects, size, err
+}
+
+// LFSObjects returns the IDs of the LFS objects stored in the mirror at
+// gitDir, sorted.
+func LFSObjects(gitDir string) ([]string, error) {
+
+	var oids []string
+
+	err := filepath.WalkDir(LFSObjectsDir(gitDir), func(path string, entry fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if entry.Type().IsRegular() {
+			oids = append(oids, entry.Name())
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(oids)
+
+	return oids, nil
+}
+
+// LFSObjectPath returns where the LFS object oid is stored, relative to
+// the mirror.
+func LFSObjectPath(oid string) string {
+
+	if len(oid) < 4 {
+		return filepath.Join("lfs", "objects", oid)
+	}
+
+	return filepath.Join("lfs", "objects", oid[0:2], oid[2:4], oid)
+}
+
+// recordLFS stores the LFS object counts of every synced mirror in its
+// asset, like recordFingerprints does for refs.
+func (e *Engine) recordLFS(assets []state.Asset, relative func(string) string) {
+
+	for i, asset := range assets {
+
+		if !asset.LastSuccess || asset.Empty {
+			continue
+		}
+
+		objects, size, err := LFSUsage(
+			filepath.Join(e.cfg.Storage.MirrorRoot, relative(asset.Name)),
+		)
+		if err != nil {
+			continue
+		}
+
+		assets[i].LFSObjects = objects
+		assets[i].LFSBytes = size
+	}
+}
@@ -19,9 +19,15 @@ func printSyncSummary(label string, assets []state.Asset) {
 
 	var failed []string
 	var healthy int
+	var empty int
 
 	for _, asset := range assets {
 
+		if asset.Empty {
+			empty++
+			continue
+		}
+
 		if asset.LastSuccess {
 			healthy++
 			continue
@@ -35,6 +41,10 @@ func printSyncSummary(label string, assets []state.Asset) {
 
 	fmt.Printf("  Total:   %d\n", len(assets))
 	fmt.Printf("  Healthy: %d\n", healthy)
+
+	if empty > 0 {
+		fmt.Printf("  Empty:   %d\n", empty)
+	}
 	fmt.Printf("  Failed:  %d\n", len(failed))
 
 	if len(failed) > 0 {
@@ -106,7 +116,7 @@ func (e *Engine) cloneMirror(ctx context.Context, repo string, target string) er
 		time.Since(start),
 	)
 
-	return nil
+	return e.fetchLFS(ctx, repoName, target, e.gitEnv(askPass))
 }
 
 func (e *Engine) updateMirror(ctx context.Context, target string) error {
@@ -129,16 +139,67 @@ func (e *Engine) updateMirror(ctx context.Context, target string) error {
 
 	defer os.Remove(askPass)
 
-	output, err := e.runGit(
-		ctx,
-		repoName,
-		e.gitEnv(askPass),
+	// Record the tips before the update, so refs it deletes or rewrites
+	// can be reported and, with preserve_refs, kept.
+	var before map[string]string
+
+	if e.cfg.Sync.PreserveRefs {
+		before, err = e.preparePreservation(ctx, target)
+	} else {
+		before, err = ReadRefs(ctx, target)
+	}
+
+	if err != nil {
+
+		e.logger.Error(
+			logging.Events.Mirror.UpdateFailed,
+			repoName,
+			err,
+		)
 
+		return err
+	}
+
+	args := []string{
 		"-C",
 		target,
 		"remote",
 		"update",
-		"--prune",
+	}
+
+	// Under a safety guard, updates don't prune: the refs upstream
+	// deleted are compared against its listing first, and pruneMirrors
+	// deletes them once the whole run is counted.
+	var remote map[string]string
+
+	if e.safety == nil {
+		args = append(args, "--prune")
+	} else {
+
+		remote, err = e.remoteRefs(ctx, repoName, target, e.gitEnv(askPass))
+
+		if err != nil {
+
+			e.logger.Error(
+				logging.Events.Mirror.UpdateFailed,
+				repoName,
+				err,
+			)
+
+			return err
+		}
+	}
+
+	if e.cfg.Sync.PreserveRefs {
+		args = append(append([]string{}, noGC...), args...)
+	}
+
+	output, err := e.runGit(
+		ctx,
+		repoName,
+		e.gitEnv(askPass),
+
+		args...,
 	)
 
 	if err != nil {
@@ -152,13 +213,24 @@ func (e *Engine) updateMirror(ctx context.Context, target string) error {
 		return err
 	}
 
+	if err := e.handleRewrites(ctx, repoName, target, before, remote, start); err != nil {
+
+		e.logger.Error(
+			logging.Events.Mirror.UpdateFailed,
+			repoName,
+			err,
+		)
+
+		return err
+	}
+
 	e.logger.Duration(
 		logging.Events.Mirror.UpdateCompleted,
 		repoName,
 		time.Since(start),
 	)
 
-	return nil
+	return e.fetchLFS(ctx, repoName, target, e.gitEnv(askPass))
 }
 
 func (e *Engine) syncMirror(ctx context.Context, url string, target string) error {
@@ -255,7 +327,8 @@ func (e *Engine) syncMirror(ctx context.Context, url string, target string) erro
 
 // recoverCorruptMirror clones a fresh mirror, validates it, and atomically replaces
 // the active mirror. The quarantined mirror is removed only after the
-// replacement has been verified.
+// replacement has been verified and has taken over its preserved refs,
+// which GitHub no longer has.
 func (e *Engine) recoverCorruptMirror(
 	ctx context.Context,
 	url string,
@@ -283,6 +356,20 @@ func (e *Engine) recoverCorruptMirror(
 		return err
 	}
 
+	// Keep the fresh mirror's updates from pruning preserved refs.
+	if err := gitCommand(ctx, tmp, nil, "config", "--add", "remote.origin.fetch", gitbackRefspec); err != nil {
+		return err
+	}
+
+	// A corrupt mirror may not give its preserved refs up; it is kept
+	// then, so the history they hold can still be recovered by hand.
+	carryErr := gitCommand(
+		ctx,
+		tmp,
+		nil,
+		append(noGC, "fetch", "--no-tags", quarantine, "+refs/gitback/*:refs/gitback/*")...,
+	)
+
 	// Atomically replace the active mirror with the fresh one.
 	if err := os.Rename(tmp, target); err != nil {
 		return fmt.Errorf(
@@ -291,6 +378,24 @@ func (e *Engine) recoverCorruptMirror(
 		)
 	}
 
+	if carryErr != nil {
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Warn,
+				Event: logging.Events.Mirror.PreservedRefsCarryFailed,
+				Repo:  filepath.Base(target),
+
+				Details: map[string]any{
+					"quarantine": quarantine,
+					"error":      carryErr.Error(),
+				},
+			},
+		)
+
+		return nil
+	}
+
 	// Remove the quarantined mirror after successful replacement.
 	if err := os.RemoveAll(quarantine); err != nil {
 		e.logger.Warn(
@@ -0,0 +1,76 @@
+// internal/mirror/paths.go
+
+package mirror
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// ExpectedMirrors returns the mirror paths, relative to the mirror root,
+// that a successful sync recorded in data should have produced, mapped
+// to the asset name they belong to. Failed and empty assets are left out
+// since no mirror is guaranteed to exist for them.
+func ExpectedMirrors(data *state.MirrorState) map[string]string {
+
+	expected := make(map[string]string)
+
+	add := func(assets []state.Asset, relative func(string) string) {
+
+		for _, asset := range assets {
+
+			if !asset.LastSuccess || asset.Empty {
+				continue
+			}
+
+			expected[relative(asset.Name)] = asset.Name
+		}
+	}
+
+	add(data.Repositories, repositoryRelativePath)
+	add(data.Wikis, wikiRelativePath)
+	add(data.Gists, gistRelativePath)
+	add(data.Starred, starredRelativePath)
+
+	return expected
+}
+
+// Find returns the paths, relative to root, of every bare mirror below
+// it. Mirror directories end in ".git" and are not descended into.
+func Find(root string) ([]string, error) {
+
+	var mirrors []string
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() || path == root {
+			return nil
+		}
+
+		if !strings.HasSuffix(entry.Name(), ".git") {
+			return nil
+		}
+
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		mirrors = append(mirrors, relative)
+
+		return filepath.SkipDir
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mirrors, nil
+}
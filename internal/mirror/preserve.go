@@ -0,0 +1,468 @@
+// internal/mirror/preserve.go
+
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+)
+
+// PreservedRefPrefix is the namespace refs deleted or rewritten upstream
+// are kept under, as refs/gitback/preserved/<timestamp>/<ref without
+// "refs/">.
+const PreservedRefPrefix = "refs/gitback/preserved/"
+
+// preservedTimestampLayout names the namespace of one update. Ref names
+// can't contain ':', so this is the snapshot layout.
+const preservedTimestampLayout = "2006-01-02T15-04-05Z"
+
+// gitbackRefspec excludes GitBack's own refs from the mirror refspec.
+// Without it, `remote update --prune` deletes them as missing upstream.
+// Negative refspecs need git 2.29 or newer.
+const gitbackRefspec = "^refs/gitback/*"
+
+// Ways a ref can lose history in an update.
+const (
+	refDeleted = "deleted"
+	refForced  = "force-update"
+)
+
+// noGC keeps the update from running automatic gc or maintenance, which
+// could prune objects only the refs about to be preserved still reach.
+var noGC = []string{
+	"-c", "gc.auto=0",
+	"-c", "maintenance.auto=false",
+}
+
+// preparePreservation makes sure the mirror at target won't prune
+// preserved refs and returns its refs before the update.
+func (e *Engine) preparePreservation(ctx context.Context, target string) (map[string]string, error) {
+
+	output, err := exec.CommandContext(
+		ctx,
+		"git",
+		"-C",
+		target,
+		"config",
+		"--get-all",
+		"remote.origin.fetch",
+	).Output()
+
+	// exit status 1 only means the key is unset
+	var exitErr *exec.ExitError
+
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return nil, fmt.Errorf("read refspecs of %s: %w", target, err)
+	}
+
+	configured := false
+
+	for _, refspec := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(refspec) == gitbackRefspec {
+			configured = true
+		}
+	}
+
+	if !configured {
+
+		if err := gitCommand(ctx, target, nil, "config", "--add", "remote.origin.fetch", gitbackRefspec); err != nil {
+			return nil, err
+		}
+	}
+
+	return ReadRefs(ctx, target)
+}
+
+// rewrittenRef is a ref an update deleted, or moved to a commit that
+// doesn't contain its old one.
+type rewrittenRef struct {
+	Ref    string
+	Change string
+	Old    string
+	New    string
+}
+
+// ignoredRef reports whether a change to ref says nothing about lost
+// history: GitBack's own refs, and pull request merge refs, which
+// GitHub recomputes whenever the base moves.
+func ignoredRef(ref string) bool {
+
+	return strings.HasPrefix(ref, "refs/gitback/") ||
+		(strings.HasPrefix(ref, "refs/pull/") && strings.HasSuffix(ref, "/merge"))
+}
+
+// rewrittenRefs compares after, the refs of the mirror at target once
+// updated, with before, its refs ahead of the update.
+func rewrittenRefs(ctx context.Context, target string, before map[string]string, after map[string]string) ([]rewrittenRef, error) {
+
+	refs := make([]string, 0, len(before))
+
+	for ref := range before {
+		refs = append(refs, ref)
+	}
+
+	sort.Strings(refs)
+
+	var rewritten []rewrittenRef
+
+	for _, ref := range refs {
+
+		if ignoredRef(ref) {
+			continue
+		}
+
+		old := before[ref]
+		current, ok := after[ref]
+
+		change := refDeleted
+
+		if ok {
+
+			if current == old {
+				continue
+			}
+
+			ancestor, err := isAncestor(ctx, target, old, current)
+			if err != nil {
+				return nil, err
+			}
+
+			if ancestor {
+				continue
+			}
+
+			change = refForced
+		}
+
+		rewritten = append(rewritten, rewrittenRef{
+			Ref:    ref,
+			Change: change,
+			Old:    old,
+			New:    current,
+		})
+	}
+
+	return rewritten, nil
+}
+
+// staleRefs returns the refs an update without --prune left in place
+// although remote, the upstream refs listed before it, no longer has
+// them. Refs the update itself created or moved were recreated upstream
+// in the meantime and aren't stale.
+func staleRefs(before map[string]string, after map[string]string, remote map[string]string) []rewrittenRef {
+
+	var stale []rewrittenRef
+
+	for ref, old := range before {
+
+		if strings.HasPrefix(ref, "refs/gitback/") || after[ref] != old {
+			continue
+		}
+
+		if _, ok := remote[ref]; ok {
+			continue
+		}
+
+		stale = append(stale, rewrittenRef{
+			Ref:    ref,
+			Change: refDeleted,
+			Old:    old,
+		})
+	}
+
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Ref < stale[j].Ref })
+
+	return stale
+}
+
+// tracked returns refs without the ones ignoredRef rules out.
+func tracked(refs []rewrittenRef) []rewrittenRef {
+
+	var kept []rewrittenRef
+
+	for _, r := range refs {
+
+		if !ignoredRef(r.Ref) {
+			kept = append(kept, r)
+		}
+	}
+
+	return kept
+}
+
+// handleRewrites runs after every update: it keeps the refs the update
+// rewrote when preserve_refs is on, reports each of them, and counts
+// them against the safety threshold.
+//
+// remote is nil when the update pruned. Otherwise it holds the upstream
+// refs listed ahead of the update; the refs upstream deleted are
+// counted now and deleted by pruneMirrors, once the run's totals show
+// whether pruning is safe.
+func (e *Engine) handleRewrites(
+	ctx context.Context,
+	repoName string,
+	target string,
+	before map[string]string,
+	remote map[string]string,
+	at time.Time,
+) error {
+
+	after, err := ReadRefs(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	rewritten, err := rewrittenRefs(ctx, target, before, after)
+	if err != nil {
+		return err
+	}
+
+	if err := e.keepRewrites(ctx, repoName, target, rewritten, at); err != nil {
+		return err
+	}
+
+	if remote != nil {
+
+		stale := staleRefs(before, after, remote)
+
+		rewritten = append(rewritten, tracked(stale)...)
+
+		e.safety.deferPrune(pendingPrune{
+			repo:   repoName,
+			target: target,
+			refs:   stale,
+			at:     at,
+		})
+	}
+
+	e.safety.recordRewrites(e.mirrorName(target), rewritten)
+
+	if !e.cfg.Sync.PreserveRefs {
+		return nil
+	}
+
+	return e.expirePreservedRefs(ctx, repoName, target, at)
+}
+
+// keepRewrites preserves refs under the namespace of at when
+// preserve_refs is on, and reports each of them.
+func (e *Engine) keepRewrites(ctx context.Context, repoName string, target string, rewritten []rewrittenRef, at time.Time) error {
+
+	var namespace string
+
+	if e.cfg.Sync.PreserveRefs && len(rewritten) > 0 {
+
+		namespace = PreservedRefPrefix + at.UTC().Format(preservedTimestampLayout) + "/"
+
+		var updates strings.Builder
+
+		for _, r := range rewritten {
+			fmt.Fprintf(&updates, "create %s %s\n", namespace+strings.TrimPrefix(r.Ref, "refs/"), r.Old)
+		}
+
+		if err := gitCommand(ctx, target, strings.NewReader(updates.String()), "update-ref", "--stdin"); err != nil {
+			return fmt.Errorf("preserve refs of %s: %w", repoName, err)
+		}
+	}
+
+	for _, r := range rewritten {
+
+		details := map[string]any{
+			"ref":    r.Ref,
+			"change": r.Change,
+			"old":    r.Old,
+			"new":    r.New,
+		}
+
+		if namespace == "" {
+
+			fmt.Printf("[WARN] %s: %s %s\n", repoName, r.Ref, r.Change)
+
+		} else {
+
+			preserved := namespace + strings.TrimPrefix(r.Ref, "refs/")
+			details["preserved_as"] = preserved
+
+			fmt.Printf("[WARN] %s: %s %s, kept as %s\n", repoName, r.Ref, r.Change, preserved)
+		}
+
+		e.logger.Emit(
+			logging.Entry{
+				Level:   logging.Warn,
+				Event:   logging.Events.Mirror.RefRewritten,
+				Repo:    repoName,
+				Details: details,
+			},
+		)
+	}
+
+	return nil
+}
+
+// pruneRefs keeps and reports the stale refs of one update, then
+// deletes them. Each delete checks the ref's old value, so nothing that
+// moved since is lost.
+func (e *Engine) pruneRefs(ctx context.Context, p pendingPrune) error {
+
+	if err := e.keepRewrites(ctx, p.repo, p.target, tracked(p.refs), p.at); err != nil {
+		return err
+	}
+
+	var deletes strings.Builder
+
+	for _, r := range p.refs {
+		fmt.Fprintf(&deletes, "delete %s %s\n", r.Ref, r.Old)
+	}
+
+	if err := gitCommand(ctx, p.target, strings.NewReader(deletes.String()), "update-ref", "--stdin"); err != nil {
+		return fmt.Errorf("prune refs of %s: %w", p.repo, err)
+	}
+
+	return nil
+}
+
+// mirrorName returns target relative to the mirror root, such as
+// "repositories/owner/name.git".
+func (e *Engine) mirrorName(target string) string {
+
+	relative, err := filepath.Rel(e.cfg.Storage.MirrorRoot, target)
+	if err != nil {
+		return target
+	}
+
+	return filepath.ToSlash(relative)
+}
+
+// expirePreservedRefs deletes preserved refs older than
+// sync.preserved_refs_keep_within. Their objects go with the mirror's
+// next gc.
+func (e *Engine) expirePreservedRefs(ctx context.Context, repoName string, target string, now time.Time) error {
+
+	if e.cfg.Sync.PreservedRefsKeepWithin == "" {
+		return nil
+	}
+
+	within, err := config.ParseKeepWithin(e.cfg.Sync.PreservedRefsKeepWithin)
+	if err != nil {
+		return err
+	}
+
+	cutoff := now.Add(-within)
+
+	refs, err := ReadRefs(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	var updates strings.Builder
+	var expired int
+
+	for ref, oid := range refs {
+
+		if !strings.HasPrefix(ref, PreservedRefPrefix) {
+			continue
+		}
+
+		stamp, _, ok := strings.Cut(strings.TrimPrefix(ref, PreservedRefPrefix), "/")
+		if !ok {
+			continue
+		}
+
+		preservedAt, err := time.Parse(preservedTimestampLayout, stamp)
+		if err != nil || !preservedAt.Before(cutoff) {
+			continue
+		}
+
+		fmt.Fprintf(&updates, "delete %s %s\n", ref, oid)
+		expired++
+	}
+
+	if expired == 0 {
+		return nil
+	}
+
+	if err := gitCommand(ctx, target, strings.NewReader(updates.String()), "update-ref", "--stdin"); err != nil {
+		return fmt.Errorf("expire preserved refs of %s: %w", repoName, err)
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Mirror.PreservedRefsExpired,
+			Repo:  repoName,
+
+			Details: map[string]any{
+				"expired":     expired,
+				"keep_within": e.cfg.Sync.PreservedRefsKeepWithin,
+			},
+		},
+	)
+
+	return nil
+}
+
+// isAncestor reports whether old is reachable from current. Refs to
+// objects that aren't commits can't be compared and count as rewritten,
+// so they are preserved rather than lost.
+func isAncestor(ctx context.Context, gitDir string, old string, current string) (bool, error) {
+
+	err := exec.CommandContext(
+		ctx,
+		"git",
+		"-C",
+		gitDir,
+		"merge-base",
+		"--is-ancestor",
+		old,
+		current,
+	).Run()
+
+	if err == nil {
+		return true, nil
+	}
+
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// gitCommand runs a local git command in gitDir, with stdin when given.
+func gitCommand(ctx context.Context, gitDir string, stdin *strings.Reader, args ...string) error {
+
+	cmd := exec.CommandContext(
+		ctx,
+		"git",
+		append([]string{"-C", gitDir}, args...)...,
+	)
+
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
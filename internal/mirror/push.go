@@ -0,0 +1,116 @@
+// internal/mirror/push.go
+
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/logging"
+)
+
+// pushRefspecs are the refs a restore pushes. A mirror also holds
+// GitHub's read-only refs/pull/*, which GitHub rejects, and GitBack's
+// own refs/gitback/*, which never belonged to the repository.
+var pushRefspecs = []string{
+	"+refs/heads/*:refs/heads/*",
+	"+refs/tags/*:refs/tags/*",
+	"+refs/notes/*:refs/notes/*",
+}
+
+// PushMirror pushes the branches, tags and notes of the mirror at
+// source to remote, removing those remote has that source doesn't, using
+// the same credential flow and retry policy as sync. It is used by
+// restore to recreate repositories from a snapshot.
+func (e *Engine) PushMirror(ctx context.Context, source string, remote string) error {
+
+	repoName := strings.TrimSuffix(
+		filepath.Base(source),
+		".git",
+	)
+
+	askPass, err := e.createAskPassScript()
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(askPass)
+
+	// LFS objects go first, so the remote already has them when the
+	// refs pointing at them arrive.
+	if err := e.pushLFS(ctx, repoName, source, remote, e.gitEnv(askPass)); err != nil {
+		return err
+	}
+
+	args := append(
+		[]string{"-C", source, "push", "--prune", remote},
+		pushRefspecs...,
+	)
+
+	output, err := e.runGit(
+		ctx,
+		repoName,
+		e.gitEnv(askPass),
+		args...,
+	)
+
+	if err != nil {
+
+		e.logger.Error(
+			logging.Events.Restore.PushFailed,
+			repoName,
+			fmt.Errorf("%s", gitErrorMessage(output, err)),
+		)
+
+		return fmt.Errorf("push %s: %s", repoName, gitErrorMessage(output, err))
+	}
+
+	return nil
+}
+
+// pushLFS uploads the LFS objects stored in the mirror at source, if
+// any, to remote.
+func (e *Engine) pushLFS(ctx context.Context, repoName string, source string, remote string, env []string) error {
+
+	objects, _, err := LFSUsage(source)
+	if err != nil {
+		return err
+	}
+
+	if objects == 0 {
+		return nil
+	}
+
+	if !LFSAvailable() {
+		return fmt.Errorf("push %s: %w", repoName, ErrLFSUnavailable)
+	}
+
+	output, err := e.runGit(
+		ctx,
+		repoName,
+		env,
+
+		"-C",
+		source,
+		"lfs",
+		"push",
+		"--all",
+		remote,
+	)
+
+	if err != nil {
+
+		e.logger.Error(
+			logging.Events.Restore.PushFailed,
+			repoName,
+			fmt.Errorf("%s", gitErrorMessage(output, err)),
+		)
+
+		return fmt.Errorf("push LFS objects of %s: %s", repoName, gitErrorMessage(output, err))
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+// internal/mirror/push_test.go
+
+package mirror
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/runtime"
+)
+
+// testGit runs a git command for a test and returns its trimmed output.
+func testGit(t *testing.T, args ...string) string {
+
+	t.Helper()
+
+	cmd := exec.Command(
+		"git",
+		append([]string{"-c", "user.name=GitBack", "-c", "user.email=gitback@example.com", "-c", "init.defaultBranch=main"}, args...)...,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+func TestPushMirrorSkipsPullAndPreservedRefs(t *testing.T) {
+
+	dir := t.TempDir()
+
+	work := filepath.Join(dir, "work")
+
+	testGit(t, "init", "-q", work)
+	testGit(t, "-C", work, "commit", "-q", "--allow-empty", "-m", "first")
+	testGit(t, "-C", work, "branch", "feature")
+	testGit(t, "-C", work, "tag", "v1")
+	testGit(t, "-C", work, "notes", "add", "-m", "note", "HEAD")
+
+	source := filepath.Join(dir, "source.git")
+
+	testGit(t, "clone", "-q", "--mirror", work, source)
+
+	// What a GitHub mirror with preserved history holds besides the
+	// repository's own refs.
+	head := testGit(t, "-C", source, "rev-parse", "main")
+
+	testGit(t, "-C", source, "update-ref", "refs/pull/1/head", head)
+	testGit(t, "-C", source, "update-ref", PreservedRefPrefix+"2026-01-01T00-00-00Z/heads/old", head)
+
+	remote := filepath.Join(dir, "remote.git")
+
+	testGit(t, "init", "-q", "--bare", remote)
+	testGit(t, "-C", source, "push", "-q", remote, "main:refs/heads/stale")
+
+	layout := runtime.NewWithRoot(filepath.Join(dir, "home"))
+
+	if err := layout.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := logging.New(layout.LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { logger.Close() })
+
+	cfg := &config.Config{}
+	cfg.Sync.RetryAttempts = 1
+
+	if err := New(cfg, layout, logger).PushMirror(context.Background(), source, remote); err != nil {
+		t.Fatal(err)
+	}
+
+	refs := strings.Fields(testGit(t, "-C", remote, "for-each-ref", "--format=%(refname)"))
+
+	sort.Strings(refs)
+
+	want := []string{
+		"refs/heads/feature",
+		"refs/heads/main",
+		"refs/notes/commits",
+		"refs/tags/v1",
+	}
+
+	if strings.Join(refs, " ") != strings.Join(want, " ") {
+		t.Fatalf("remote has %v, want %v", refs, want)
+	}
+}
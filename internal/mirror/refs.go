@@ -0,0 +1,130 @@
+// internal/mirror/refs.go
+
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// ReadRefs returns every ref of the repository at gitDir mapped to the
+// object it points to.
+func ReadRefs(ctx context.Context, gitDir string) (map[string]string, error) {
+
+	output, err := exec.CommandContext(
+		ctx,
+		"git",
+		"-C",
+		gitDir,
+		"for-each-ref",
+		"--format=%(objectname) %(refname)",
+	).Output()
+
+	if err != nil {
+		return nil, fmt.Errorf("read refs of %s: %w", gitDir, err)
+	}
+
+	refs := make(map[string]string)
+
+	for _, line := range strings.Split(string(output), "\n") {
+
+		oid, ref, ok := strings.Cut(strings.TrimSpace(line), " ")
+
+		if !ok {
+			continue
+		}
+
+		refs[ref] = oid
+	}
+
+	return refs, nil
+}
+
+// remoteRefs lists the refs of the origin of the mirror at target, as
+// the next update would fetch them.
+func (e *Engine) remoteRefs(ctx context.Context, repoName string, target string, env []string) (map[string]string, error) {
+
+	output, err := e.runGit(
+		ctx,
+		repoName,
+		env,
+
+		"-C",
+		target,
+		"ls-remote",
+		"origin",
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("list remote refs of %s: %s", repoName, gitErrorMessage(output, err))
+	}
+
+	refs := make(map[string]string)
+
+	for _, line := range strings.Split(string(output), "\n") {
+
+		oid, ref, ok := strings.Cut(strings.TrimSpace(line), "\t")
+
+		// Peeled tags and HEAD aren't refs a fetch stores.
+		if !ok || !strings.HasPrefix(ref, "refs/") || strings.HasSuffix(ref, "^{}") {
+			continue
+		}
+
+		refs[ref] = oid
+	}
+
+	return refs, nil
+}
+
+// Fingerprint summarizes refs as a single hash; two mirrors have the same
+// fingerprint exactly when their refs point to the same objects.
+func Fingerprint(refs map[string]string) string {
+
+	names := make([]string, 0, len(refs))
+
+	for ref := range refs {
+		names = append(names, ref)
+	}
+
+	sort.Strings(names)
+
+	hash := sha256.New()
+
+	for _, ref := range names {
+		fmt.Fprintf(hash, "%s %s\n", refs[ref], ref)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordFingerprints sets the fingerprint of every successfully synced
+// asset from the refs of its mirror. A mirror whose refs can't be read
+// keeps an empty fingerprint, which makes the next snapshot assume it
+// changed.
+func (e *Engine) recordFingerprints(ctx context.Context, assets []state.Asset, relative func(string) string) {
+
+	for i, asset := range assets {
+
+		if !asset.LastSuccess || asset.Empty {
+			continue
+		}
+
+		refs, err := ReadRefs(
+			ctx,
+			filepath.Join(e.cfg.Storage.MirrorRoot, relative(asset.Name)),
+		)
+		if err != nil {
+			continue
+		}
+
+		assets[i].Fingerprint = Fingerprint(refs)
+	}
+}
@@ -0,0 +1,29 @@
+// internal/mirror/release.go
+
+package mirror
+
+import (
+	"context"
+
+	"github.com/flarexes/gitback/internal/release"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// syncReleases downloads the releases of every repository in the
+// inventory, reusing the files the last sync recorded when they still
+// match.
+func (e *Engine) syncReleases(ctx context.Context, ids map[string]int64) ([]state.Asset, error) {
+
+	engine, err := release.New(e.cfg, e.layout, e.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []state.Asset
+
+	if data, err := state.LoadMirrors(e.layout.MirrorsStateFile); err == nil {
+		previous = data.Releases
+	}
+
+	return engine.Sync(ctx, ids, previous)
+}
@@ -0,0 +1,194 @@
+// internal/mirror/relocate.go
+
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// repositoryIDs maps the clone URLs in the inventory to their GitHub
+// IDs, as the last discovery recorded them.
+func (e *Engine) repositoryIDs() map[string]int64 {
+
+	history, err := state.LoadInventoryHistory(e.layout.InventoryHistoryFile)
+	if err != nil {
+
+		e.logger.Error(
+			logging.Events.Inventory.ReadFailed,
+			e.layout.InventoryHistoryFile,
+			err,
+		)
+
+		return nil
+	}
+
+	return history.RepositoryIDs()
+}
+
+// relocateRepositories moves the mirrors of repositories that were
+// renamed or transferred since the last sync to the path of their new
+// URL, so they are updated rather than cloned again. A repository is
+// recognized by the GitHub ID the last sync recorded for it.
+func (e *Engine) relocateRepositories(ctx context.Context, ids map[string]int64) {
+
+	previous, err := state.LoadMirrors(e.layout.MirrorsStateFile)
+	if err != nil {
+		return
+	}
+
+	previousURLs := make(map[int64]string, len(previous.Repositories))
+
+	for _, repo := range previous.Repositories {
+
+		if repo.ID != 0 {
+			previousURLs[repo.ID] = repo.Name
+		}
+	}
+
+	for url, id := range ids {
+
+		from, ok := previousURLs[id]
+
+		if !ok || from == url {
+			continue
+		}
+
+		e.relocateRepository(ctx, id, from, url)
+	}
+}
+
+// relocateRepository moves the repository's mirror and its wiki's, with
+// any quarantined copies, from where the mirrors of from live to where
+// those of to belong, and points them at the new URL.
+func (e *Engine) relocateRepository(ctx context.Context, id int64, from string, to string) {
+
+	repoName := e.extractRepoName(to)
+
+	remotes := []string{to, repositoryWikiURL(to)}
+
+	for i, relative := range RepositoryMirrors(from) {
+
+		destination := RepositoryMirrors(to)[i]
+
+		moved, err := e.relocateMirror(ctx, relative, destination, remotes[i])
+
+		if err != nil {
+
+			e.logger.Emit(
+				logging.Entry{
+					Level: logging.Error,
+					Event: logging.Events.Mirror.RelocateFailed,
+					Repo:  repoName,
+
+					Details: map[string]any{
+						"id":    id,
+						"from":  relative,
+						"to":    destination,
+						"error": err.Error(),
+					},
+				},
+			)
+
+			fmt.Printf("[WARN] %s: could not move mirror from %s: %v\n", repoName, relative, err)
+
+			continue
+		}
+
+		if !moved {
+			continue
+		}
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Info,
+				Event: logging.Events.Mirror.Relocated,
+				Repo:  repoName,
+
+				Details: map[string]any{
+					"id":       id,
+					"from":     relative,
+					"to":       destination,
+					"from_url": from,
+				},
+			},
+		)
+
+		fmt.Printf("[MOVED] %s -> %s\n", relative, destination)
+	}
+}
+
+// relocateMirror moves the mirror at relative to destination, both below
+// the mirror root, and sets its origin to remote. It reports false when
+// there is no mirror to move; quarantined copies still move. A mirror
+// already at destination is never replaced.
+func (e *Engine) relocateMirror(ctx context.Context, relative string, destination string, remote string) (bool, error) {
+
+	source := filepath.Join(e.cfg.Storage.MirrorRoot, relative)
+	target := filepath.Join(e.cfg.Storage.MirrorRoot, destination)
+
+	if _, err := os.Stat(source); err != nil {
+
+		if os.IsNotExist(err) {
+			return false, e.relocateQuarantine(relative, destination)
+		}
+
+		return false, err
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		return false, fmt.Errorf("a mirror already exists at %s", destination)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return false, fmt.Errorf("create mirror directory: %w", err)
+	}
+
+	if err := os.Rename(source, target); err != nil {
+		return false, err
+	}
+
+	if err := gitCommand(ctx, target, nil, "remote", "set-url", "origin", remote); err != nil {
+		return true, err
+	}
+
+	return true, e.relocateQuarantine(relative, destination)
+}
+
+// relocateQuarantine moves quarantined copies of the mirror at relative,
+// including timestamped ones, along with it.
+func (e *Engine) relocateQuarantine(relative string, destination string) error {
+
+	source := filepath.Join(e.cfg.QuarantineDir(), relative)
+	target := filepath.Join(e.cfg.QuarantineDir(), destination)
+
+	stamped, err := filepath.Glob(source + ".*")
+	if err != nil {
+		return err
+	}
+
+	for _, path := range append([]string{source}, stamped...) {
+
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		moved := target + strings.TrimPrefix(path, source)
+
+		if err := os.MkdirAll(filepath.Dir(moved), 0700); err != nil {
+			return fmt.Errorf("create quarantine directory: %w", err)
+		}
+
+		if err := os.Rename(path, moved); err != nil {
+			return fmt.Errorf("move quarantined mirror: %w", err)
+		}
+	}
+
+	return nil
+}
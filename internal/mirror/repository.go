@@ -14,13 +14,6 @@ import (
 	"github.com/flarexes/gitback/internal/state"
 )
 
-func (e *Engine) repoMirrorRoot() string {
-	return filepath.Join(
-		e.cfg.Storage.MirrorRoot,
-		"repositories",
-	)
-}
-
 func (e *Engine) extractRepoName(repoURL string) string {
 
 	repo := strings.TrimSuffix(
@@ -43,6 +36,16 @@ func (e *Engine) extractRepoName(repoURL string) string {
 
 func (e *Engine) repositoryMirrorPath(repoURL string) string {
 
+	return filepath.Join(
+		e.cfg.Storage.MirrorRoot,
+		repositoryRelativePath(repoURL),
+	)
+}
+
+// repositoryRelativePath maps a clone URL to its mirror path relative to
+// the mirror root: repositories/<owner>/<name>.git.
+func repositoryRelativePath(repoURL string) string {
+
 	repo := strings.TrimSuffix(repoURL, ".git")
 
 	parts := strings.Split(repo, "/")
@@ -50,7 +53,7 @@ func (e *Engine) repositoryMirrorPath(repoURL string) string {
 	if len(parts) < 2 {
 
 		return filepath.Join(
-			e.repoMirrorRoot(),
+			"repositories",
 			filepath.Base(repoURL),
 		)
 	}
@@ -59,7 +62,7 @@ func (e *Engine) repositoryMirrorPath(repoURL string) string {
 	name := parts[len(parts)-1]
 
 	return filepath.Join(
-		e.repoMirrorRoot(),
+		"repositories",
 		owner,
 		name+".git",
 	)
@@ -0,0 +1,338 @@
+// internal/mirror/safety.go
+
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// safetyGuard watches one sync for mass deletion or history rewrites,
+// as a compromised token or a rogue admin would cause. Once a limit is
+// exceeded, or while an earlier alert is unacknowledged, it holds and
+// the run prunes nothing. Updates don't prune themselves; they leave
+// the refs upstream deleted to pruneMirrors, which runs once every
+// update is counted.
+//
+// A nil guard never holds; engines used outside Sync don't have one.
+type safetyGuard struct {
+	limits config.SafetyConfig
+	alert  *state.SafetyState
+
+	mu        sync.Mutex
+	hold      bool
+	removed   []string
+	rewritten []string
+	pending   []pendingPrune
+
+	removedExceeded   bool
+	rewrittenExceeded bool
+}
+
+// startSafety loads the current alert and counts the repositories that
+// left the inventory since the last sync, before any mirror is touched.
+// ids maps the inventory's URLs to GitHub IDs, so renamed repositories
+// don't count as removed.
+func (e *Engine) startSafety(ids map[string]int64) *safetyGuard {
+
+	guard := &safetyGuard{
+		limits: e.cfg.Safety,
+	}
+
+	alert, err := state.LoadSafety(e.layout.SafetyStateFile)
+
+	switch {
+
+	case err != nil:
+
+		// Without the state there's no telling whether an alert is
+		// pending, so hold as if one were.
+		guard.alert = &state.SafetyState{}
+		guard.hold = true
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Error,
+				Event: logging.Events.Safety.AlertActive,
+
+				Details: map[string]any{
+					"error": err.Error(),
+				},
+			},
+		)
+
+		fmt.Printf("[WARN] Safety state unreadable, pruning suspended: %v\n", err)
+
+	case alert.Active():
+
+		guard.alert = alert
+		guard.hold = true
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Warn,
+				Event: logging.Events.Safety.AlertActive,
+
+				Details: map[string]any{
+					"raised_at": alert.RaisedAt,
+					"reasons":   alert.Reasons,
+				},
+			},
+		)
+
+		fmt.Printf(
+			"[WARN] Safety alert raised at %s is unacknowledged, pruning suspended. Run: gitback acknowledge\n",
+			alert.RaisedAt,
+		)
+
+	default:
+		guard.alert = alert
+	}
+
+	guard.removed = e.removedRepositories(ids)
+
+	if guard.limits.MaxRemovedRepositories > 0 && len(guard.removed) > guard.limits.MaxRemovedRepositories {
+		guard.removedExceeded = true
+		guard.hold = true
+	}
+
+	return guard
+}
+
+// removedRepositories returns the repositories the previous sync
+// recorded that the inventory no longer lists, by URL or by ID. A
+// missing inventory lists nothing; one that can't be read is left to
+// sync to report.
+func (e *Engine) removedRepositories(ids map[string]int64) []string {
+
+	previous, err := state.LoadMirrors(e.layout.MirrorsStateFile)
+	if err != nil {
+		return nil
+	}
+
+	inventory, err := state.ReadInventory(e.layout.RepositoryInventoryFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil
+	}
+
+	listed := make(map[string]struct{}, len(inventory))
+
+	for _, repo := range inventory {
+		listed[repo] = struct{}{}
+	}
+
+	listedIDs := make(map[int64]struct{}, len(ids))
+
+	for _, id := range ids {
+		listedIDs[id] = struct{}{}
+	}
+
+	var removed []string
+
+	for _, repo := range previous.Repositories {
+
+		if _, ok := listed[repo.Name]; ok {
+			continue
+		}
+
+		if _, ok := listedIDs[repo.ID]; ok && repo.ID != 0 {
+			continue
+		}
+
+		removed = append(removed, repo.Name)
+	}
+
+	return removed
+}
+
+// recordRewrites counts refs of mirror that were deleted or rewritten
+// upstream. A deletion the current alert already lists is the same ref
+// still waiting to be pruned, reviewed or not, and doesn't count again.
+func (g *safetyGuard) recordRewrites(mirror string, refs []rewrittenRef) {
+
+	if g == nil || len(refs) == 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	listed := make(map[string]struct{}, len(g.alert.RewrittenRefs))
+
+	for _, ref := range g.alert.RewrittenRefs {
+		listed[ref] = struct{}{}
+	}
+
+	for _, r := range refs {
+
+		name := mirror + " " + r.Ref
+
+		if _, ok := listed[name]; ok && r.Change == refDeleted {
+			continue
+		}
+
+		g.rewritten = append(g.rewritten, name)
+	}
+
+	if g.limits.MaxRewrittenRefs > 0 && len(g.rewritten) > g.limits.MaxRewrittenRefs {
+		g.rewrittenExceeded = true
+		g.hold = true
+	}
+}
+
+// pendingPrune is the refs one update left in place because upstream
+// deleted them, stamped with the update's start for preserve_refs.
+type pendingPrune struct {
+	repo   string
+	target string
+	refs   []rewrittenRef
+	at     time.Time
+}
+
+// deferPrune queues the stale refs of an update for pruneMirrors.
+func (g *safetyGuard) deferPrune(p pendingPrune) {
+
+	if g == nil || len(p.refs) == 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.pending = append(g.pending, p)
+}
+
+// pruneMirrors deletes the refs queued by deferPrune unless the guard
+// holds, now that the run's totals are known. While it holds, every
+// one of them stays for the operator to review.
+func (e *Engine) pruneMirrors(ctx context.Context) {
+
+	guard := e.safety
+
+	guard.mu.Lock()
+	pending, hold := guard.pending, guard.hold
+	guard.pending = nil
+	guard.mu.Unlock()
+
+	if hold {
+
+		var kept int
+
+		for _, p := range pending {
+			kept += len(p.refs)
+		}
+
+		if kept > 0 {
+			fmt.Printf("[WARN] Pruning suspended, %d refs deleted upstream kept\n", kept)
+		}
+
+		return
+	}
+
+	for _, p := range pending {
+
+		if err := e.pruneRefs(ctx, p); err != nil {
+
+			e.logger.Error(
+				logging.Events.Mirror.UpdateFailed,
+				p.repo,
+				err,
+			)
+
+			fmt.Printf("[WARN] %s: %v\n", p.repo, err)
+		}
+	}
+}
+
+// finishSafety raises an alert if this run exceeded a limit, adding to
+// one that is still unacknowledged. Saving it is required: without the
+// state, the next run would prune and retention would delete.
+func (e *Engine) finishSafety(now time.Time) error {
+
+	guard := e.safety
+
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	if !guard.removedExceeded && !guard.rewrittenExceeded {
+		return nil
+	}
+
+	var reasons []string
+
+	if guard.removedExceeded {
+		reasons = append(
+			reasons,
+			fmt.Sprintf(
+				"%d repositories removed from the inventory (limit %d)",
+				len(guard.removed),
+				guard.limits.MaxRemovedRepositories,
+			),
+		)
+	}
+
+	if guard.rewrittenExceeded {
+		reasons = append(
+			reasons,
+			fmt.Sprintf(
+				"%d refs deleted or force-updated (limit %d)",
+				len(guard.rewritten),
+				guard.limits.MaxRewrittenRefs,
+			),
+		)
+	}
+
+	alert := guard.alert
+
+	if !alert.Active() {
+		alert = &state.SafetyState{
+			RaisedAt: now.UTC().Format(time.RFC3339),
+		}
+	}
+
+	alert.Reasons = append(alert.Reasons, reasons...)
+
+	if guard.removedExceeded {
+		alert.RemovedRepositories = append(alert.RemovedRepositories, guard.removed...)
+	}
+
+	alert.RewrittenRefs = append(alert.RewrittenRefs, guard.rewritten...)
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Critical,
+			Event: logging.Events.Safety.ThresholdExceeded,
+
+			Details: map[string]any{
+				"reasons":                  reasons,
+				"removed_repositories":     len(guard.removed),
+				"rewritten_refs":           len(guard.rewritten),
+				"max_removed_repositories": guard.limits.MaxRemovedRepositories,
+				"max_rewritten_refs":       guard.limits.MaxRewrittenRefs,
+			},
+		},
+	)
+
+	fmt.Println()
+	fmt.Println("[CRITICAL] Safety threshold exceeded")
+
+	for _, reason := range reasons {
+		fmt.Printf("  - %s\n", reason)
+	}
+
+	fmt.Println("  Pruning and snapshot retention are suspended until this is reviewed.")
+	fmt.Println("  Run: gitback acknowledge")
+
+	if err := state.SaveSafety(e.layout.SafetyStateFile, *alert); err != nil {
+		return fmt.Errorf("save safety alert: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// internal/mirror/safety_test.go
+
+package mirror
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/runtime"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+func TestUpdatesPruneOnlyWithinSafetyLimit(t *testing.T) {
+
+	for _, test := range []struct {
+		name    string
+		deleted []string
+		want    string
+	}{
+		{"within", []string{"one"}, "refs/heads/main refs/heads/two"},
+		{"exceeded", []string{"one", "two"}, "refs/heads/main refs/heads/one refs/heads/two"},
+	} {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			dir := t.TempDir()
+
+			work := filepath.Join(dir, "work")
+
+			testGit(t, "init", "-q", work)
+			testGit(t, "-C", work, "commit", "-q", "--allow-empty", "-m", "first")
+			testGit(t, "-C", work, "branch", "one")
+			testGit(t, "-C", work, "branch", "two")
+
+			layout := runtime.NewWithRoot(filepath.Join(dir, "home"))
+
+			if err := layout.EnsureDirs(); err != nil {
+				t.Fatal(err)
+			}
+
+			logger, err := logging.New(layout.LogFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { logger.Close() })
+
+			cfg := &config.Config{}
+			cfg.Storage.MirrorRoot = filepath.Join(dir, "mirrors")
+			cfg.Sync.RetryAttempts = 1
+
+			target := filepath.Join(cfg.Storage.MirrorRoot, "repositories", "octocat", "hello.git")
+
+			testGit(t, "clone", "-q", "--mirror", work, target)
+
+			for _, branch := range test.deleted {
+				testGit(t, "-C", work, "branch", "-q", "-D", branch)
+			}
+
+			engine := New(cfg, layout, logger)
+			engine.safety = &safetyGuard{
+				limits: config.SafetyConfig{MaxRewrittenRefs: 1},
+				alert:  &state.SafetyState{},
+			}
+
+			ctx := context.Background()
+
+			if err := engine.updateMirror(ctx, target); err != nil {
+				t.Fatal(err)
+			}
+
+			// Nothing is pruned before the run's totals are known.
+			if got := testGit(t, "-C", target, "for-each-ref", "--format=%(refname)", "refs/heads"); len(strings.Fields(got)) != 3 {
+				t.Fatalf("update pruned before the run was counted: %s", got)
+			}
+
+			engine.pruneMirrors(ctx)
+
+			got := strings.Join(strings.Fields(testGit(t, "-C", target, "for-each-ref", "--format=%(refname)", "refs/heads")), " ")
+
+			if got != test.want {
+				t.Fatalf("mirror has %s, want %s", got, test.want)
+			}
+		})
+	}
+}
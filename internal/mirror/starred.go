@@ -0,0 +1,183 @@
+// internal/mirror/starred.go
+
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// StarredDirectory holds the mirrors of starred repositories, below the
+// mirror root.
+const StarredDirectory = "starred"
+
+func (e *Engine) starredMirrorPath(repoURL string) string {
+
+	return filepath.Join(
+		e.cfg.Storage.MirrorRoot,
+		starredRelativePath(repoURL),
+	)
+}
+
+// starredRelativePath maps a clone URL to its mirror path relative to
+// the mirror root: starred/<owner>/<name>.git.
+func starredRelativePath(repoURL string) string {
+
+	return filepath.Join(
+		StarredDirectory,
+		strings.TrimPrefix(
+			repositoryRelativePath(repoURL),
+			"repositories"+string(filepath.Separator),
+		),
+	)
+}
+
+// StarredMirror returns the mirror path, relative to the mirror root,
+// of the starred repository with clone URL repoURL.
+func StarredMirror(repoURL string) string {
+	return starredRelativePath(repoURL)
+}
+
+// starredEngine returns a copy of the engine for starred repositories,
+// with their own worker budget and retry attempts.
+func (e *Engine) starredEngine() *Engine {
+
+	cfg := *e.cfg
+	cfg.Sync.Workers = e.cfg.Sync.StarredWorkers
+	cfg.Sync.RetryAttempts = e.cfg.Sync.StarredRetryAttempts
+
+	return &Engine{
+		cfg:    &cfg,
+		layout: e.layout,
+		logger: e.logger,
+
+		// Starred repositories are exempt from the safety limits:
+		// history rewritten in someone else's repository says nothing
+		// about this account. Without a guard their updates prune right
+		// away and never count towards, or wait on, an alert.
+		safety: nil,
+	}
+}
+
+func (e *Engine) syncStarredRepository(ctx context.Context, repo string) error {
+
+	return e.syncMirror(
+		ctx,
+		repo,
+		e.starredMirrorPath(repo),
+	)
+}
+
+// syncStarred mirrors every repository in the starred inventory. A
+// starred repository that fails is recorded like any other asset, but
+// never stops the sync or a snapshot. Neither does an inventory that
+// can't be read: it is recorded as a single failed asset named after
+// the inventory file.
+func (e *Engine) syncStarred(ctx context.Context) []state.Asset {
+
+	starred := e.starredEngine()
+
+	jobs := make(chan string)
+	results := make(chan state.Asset)
+
+	var wg sync.WaitGroup
+
+	starred.startWorkers(
+		ctx,
+		starred.syncStarredRepository,
+		jobs,
+		results,
+		&wg,
+	)
+
+	dispatchErr := make(chan error, 1)
+
+	go func() {
+		dispatchErr <- starred.dispatchStarredJobs(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var assets []state.Asset
+
+	for result := range results {
+
+		assets = append(
+			assets,
+			result,
+		)
+	}
+
+	if err := <-dispatchErr; err != nil {
+
+		fmt.Printf("[WARN] Starred repositories skipped: %v\n", err)
+
+		return []state.Asset{
+			{
+				Name:  e.layout.StarredInventoryFile,
+				Error: err.Error(),
+			},
+		}
+	}
+
+	return assets
+}
+
+// dispatchStarredJobs feeds the starred inventory to the worker pool,
+// following the same missing inventory rule as dispatchWikiJobs. An
+// empty inventory is normal: the account may not have starred anything.
+func (e *Engine) dispatchStarredJobs(jobs chan<- string) error {
+
+	defer close(jobs)
+
+	starred, err := state.ReadInventory(e.layout.StarredInventoryFile)
+
+	if err != nil {
+
+		if os.IsNotExist(err) {
+
+			e.logger.Warn(
+				logging.Events.Inventory.Missing,
+				e.layout.StarredInventoryFile,
+				"starred inventory file not found",
+			)
+
+			fmt.Println(
+				"[WARN] Starred inventory missing. Run: gitback discover",
+			)
+
+			return nil
+		}
+
+		e.logger.Error(
+			logging.Events.Inventory.ReadFailed,
+			e.layout.StarredInventoryFile,
+			err,
+		)
+
+		return fmt.Errorf(
+			"read starred inventory %s: %w",
+			e.layout.StarredInventoryFile,
+			err,
+		)
+	}
+
+	for _, repo := range starred {
+
+		fmt.Printf("[STARRED] %s\n", e.extractRepoName(repo))
+
+		jobs <- repo
+	}
+
+	return nil
+}
@@ -57,5 +57,9 @@ func (e *Engine) validateMirror(ctx context.Context, target string) error {
 		repoName,
 	)
 
+	// Git objects are intact; report any LFS objects the next fetch
+	// has to download again.
+	e.checkLFS(ctx, repoName, target)
+
 	return nil
 }
@@ -0,0 +1,192 @@
+// internal/mirror/wiki.go
+
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// ErrWikiEmpty is returned for wikis that are enabled on GitHub but have
+// no pages yet. GitHub only creates the wiki repository once the first
+// page is saved, so the remote does not exist.
+var ErrWikiEmpty = errors.New("wiki has no pages")
+
+// wikiMirrorPath maps "<owner>/<name>.wiki.git" remotes to
+// wikis/<owner>/<name>.wiki.git, mirroring the repository layout.
+func (e *Engine) wikiMirrorPath(wikiURL string) string {
+
+	return filepath.Join(
+		e.cfg.Storage.MirrorRoot,
+		wikiRelativePath(wikiURL),
+	)
+}
+
+func wikiRelativePath(wikiURL string) string {
+
+	parts := strings.Split(wikiURL, "/")
+
+	if len(parts) < 2 {
+
+		return filepath.Join(
+			"wikis",
+			filepath.Base(wikiURL),
+		)
+	}
+
+	return filepath.Join(
+		"wikis",
+		parts[len(parts)-2],
+		parts[len(parts)-1],
+	)
+}
+
+// probeWiki checks once, without retries, whether the wiki remote exists.
+// Empty wikis are common (has_wiki defaults to true on GitHub), so they
+// must not go through runGit's retry backoff or be reported as failures.
+//
+// Any other probe failure is ignored here; the regular clone/update path
+// retries it and reports the real error.
+func (e *Engine) probeWiki(ctx context.Context, wikiURL string) error {
+
+	askPass, err := e.createAskPassScript()
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(askPass)
+
+	cmd := exec.CommandContext(
+		ctx,
+		"git",
+		"ls-remote",
+		wikiURL,
+	)
+	cmd.Env = e.gitEnv(askPass)
+
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	if strings.Contains(strings.ToLower(string(output)), "not found") {
+		return ErrWikiEmpty
+	}
+
+	return nil
+}
+
+func (e *Engine) syncWiki(ctx context.Context, wikiURL string) error {
+
+	if err := e.probeWiki(ctx, wikiURL); err != nil {
+		return err
+	}
+
+	return e.syncMirror(
+		ctx,
+		wikiURL,
+		e.wikiMirrorPath(wikiURL),
+	)
+}
+
+func (e *Engine) syncWikis(ctx context.Context) ([]state.Asset, error) {
+
+	jobs := make(chan string)
+	results := make(chan state.Asset)
+
+	var wg sync.WaitGroup
+
+	e.startWorkers(
+		ctx,
+		e.syncWiki,
+		jobs,
+		results,
+		&wg,
+	)
+
+	dispatchErr := make(chan error, 1)
+
+	go func() {
+		dispatchErr <- e.dispatchWikiJobs(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var wikis []state.Asset
+
+	for result := range results {
+
+		wikis = append(
+			wikis,
+			result,
+		)
+	}
+
+	if err := <-dispatchErr; err != nil {
+		return nil, err
+	}
+
+	return wikis, nil
+}
+
+// dispatchWikiJobs feeds the wiki inventory to the worker pool, following
+// the same missing/empty inventory rules as dispatchRepositoryJobs.
+func (e *Engine) dispatchWikiJobs(jobs chan<- string) error {
+
+	defer close(jobs)
+
+	wikis, err := state.ReadInventory(e.layout.WikiInventoryFile)
+
+	if err != nil {
+
+		if os.IsNotExist(err) {
+
+			e.logger.Warn(
+				logging.Events.Inventory.Missing,
+				e.layout.WikiInventoryFile,
+				"wiki inventory file not found",
+			)
+
+			fmt.Println(
+				"[WARN] Wiki inventory missing. Run: gitback discover",
+			)
+
+			return nil
+		}
+
+		e.logger.Error(
+			logging.Events.Inventory.ReadFailed,
+			e.layout.WikiInventoryFile,
+			err,
+		)
+
+		return fmt.Errorf(
+			"read wiki inventory %s: %w",
+			e.layout.WikiInventoryFile,
+			err,
+		)
+	}
+
+	// Unlike repositories, an empty wiki inventory is normal: none of
+	// the discovered repositories may have the wiki feature enabled.
+	for _, wiki := range wikis {
+
+		fmt.Printf("[WIKI] %s\n", e.extractRepoName(wiki))
+
+		jobs <- wiki
+	}
+
+	return nil
+}
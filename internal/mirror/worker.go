@@ -4,6 +4,7 @@ package mirror
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	"github.com/flarexes/gitback/internal/state"
@@ -26,7 +27,21 @@ func (e *Engine) worker(
 
 	for asset := range jobs {
 
-		if err := syncFn(ctx, asset); err != nil {
+		err := syncFn(ctx, asset)
+
+		// An empty wiki is a known, healthy state rather than a failure.
+		if errors.Is(err, ErrWikiEmpty) {
+
+			results <- state.Asset{
+				Name:        asset,
+				LastSuccess: true,
+				Empty:       true,
+			}
+
+			continue
+		}
+
+		if err != nil {
 
 			results <- state.Asset{
 				Name:        asset,
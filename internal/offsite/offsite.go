@@ -0,0 +1,45 @@
+// internal/offsite/offsite.go
+
+package offsite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+)
+
+// Target is a remote location snapshots are replicated to. Files are
+// stored flat, under their local base name.
+type Target interface {
+
+	// Name identifies the target in output and logs.
+	Name() string
+
+	// Upload copies the local file to the target. An interrupted
+	// upload of the same file resumes where the target supports it.
+	Upload(ctx context.Context, file string) error
+
+	// List returns the names of all files stored on the target.
+	List(ctx context.Context) ([]string, error)
+
+	// Delete removes a file from the target.
+	Delete(ctx context.Context, name string) error
+
+	// Close releases any connection held by the target.
+	Close() error
+}
+
+// New returns the Target described by cfg.
+func New(cfg config.OffsiteConfig, logger *logging.Logger) (Target, error) {
+
+	switch cfg.Type {
+	case config.OffsiteS3:
+		return newS3(cfg, logger)
+	case config.OffsiteSFTP:
+		return newSFTP(cfg), nil
+	}
+
+	return nil, fmt.Errorf("unsupported offsite type %q", cfg.Type)
+}
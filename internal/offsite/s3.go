@@ -0,0 +1,475 @@
+// internal/offsite/s3.go
+
+package offsite
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// defaultPartSizeMB keeps archives of a few hundred GB within S3's
+// 10,000 part limit while bounding how much is re-sent on resume.
+const defaultPartSizeMB = 64
+
+// s3Target stores snapshots in an S3-compatible bucket.
+//
+// Large files use multipart uploads driven through minio.Core so an
+// interrupted upload can be resumed: the pending upload is found again
+// by key and parts whose MD5 already matches the local data are reused.
+// Every upload is checked against the stored object before it counts,
+// and leaves no pending multipart upload of its key behind.
+type s3Target struct {
+	cfg    config.OffsiteConfig
+	client minio.Core
+	logger *logging.Logger
+
+	partSize int64
+}
+
+func newS3(cfg config.OffsiteConfig, logger *logging.Logger) (*s3Target, error) {
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+
+	accessKey := cfg.AccessKeyID
+
+	if accessKey == "" {
+		accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+
+	if cfg.SecretAccessKeyFile != "" {
+
+		data, err := os.ReadFile(cfg.SecretAccessKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read secret access key: %w", err)
+		}
+
+		secretKey = strings.TrimSpace(string(data))
+	}
+
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf(
+			"s3 credentials not configured; set access_key_id/secret_access_key_file or AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY",
+		)
+	}
+
+	client, err := minio.NewCore(
+		endpoint.Host,
+		&minio.Options{
+			Creds: credentials.NewStaticV4(
+				accessKey,
+				secretKey,
+				os.Getenv("AWS_SESSION_TOKEN"),
+			),
+			Secure: endpoint.Scheme == "https",
+			Region: cfg.Region,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	partSizeMB := cfg.PartSizeMB
+
+	if partSizeMB == 0 {
+		partSizeMB = defaultPartSizeMB
+	}
+
+	return &s3Target{
+		cfg:      cfg,
+		client:   *client,
+		logger:   logger,
+		partSize: int64(partSizeMB) << 20,
+	}, nil
+}
+
+func (t *s3Target) Name() string {
+	return t.cfg.DisplayName()
+}
+
+// key returns the object key for a file name.
+func (t *s3Target) key(name string) string {
+	return path.Join(t.cfg.Prefix, name)
+}
+
+func (t *s3Target) Upload(ctx context.Context, file string) error {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	key := t.key(filepath.Base(file))
+
+	var etag string
+
+	if info.Size() <= t.partSize {
+
+		hash := md5.New()
+
+		if _, err := io.Copy(hash, f); err != nil {
+			return err
+		}
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		sum := hash.Sum(nil)
+
+		if _, err := t.client.PutObject(
+			ctx,
+			t.cfg.Bucket,
+			key,
+			f,
+			info.Size(),
+			base64.StdEncoding.EncodeToString(sum),
+			"",
+			minio.PutObjectOptions{},
+		); err != nil {
+			return err
+		}
+
+		etag = hex.EncodeToString(sum)
+
+	} else {
+
+		etag, err = t.uploadMultipart(ctx, f, info.Size(), key)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := t.verify(ctx, key, info.Size(), etag); err != nil {
+		return err
+	}
+
+	t.abortPending(ctx, key)
+
+	return nil
+}
+
+// verify checks the stored object against the uploaded file: its size,
+// and its ETag, which S3 derives from the MD5 of the data, or from the
+// MD5s of the parts for a multipart upload. Objects encrypted with
+// SSE-KMS or SSE-C have opaque ETags, so only their size is checked.
+func (t *s3Target) verify(ctx context.Context, key string, size int64, etag string) error {
+
+	info, err := t.client.StatObject(ctx, t.cfg.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("check uploaded %s: %w", key, err)
+	}
+
+	if info.Size != size {
+		return fmt.Errorf("uploaded %s is %d bytes, expected %d", key, info.Size, size)
+	}
+
+	if info.Metadata.Get("X-Amz-Server-Side-Encryption") == "aws:kms" ||
+		info.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "" {
+		return nil
+	}
+
+	if !strings.EqualFold(strings.Trim(info.ETag, `"`), etag) {
+		return fmt.Errorf("uploaded %s has ETag %s, expected %s", key, info.ETag, etag)
+	}
+
+	return nil
+}
+
+// abortPending aborts every multipart upload of key still pending after
+// it was uploaded: left by interrupted attempts that weren't resumed,
+// they would otherwise be stored, and billed, until a lifecycle rule
+// removes them. Failures are logged only; the object itself is fine.
+func (t *s3Target) abortPending(ctx context.Context, key string) {
+
+	uploads, err := t.client.ListMultipartUploads(ctx, t.cfg.Bucket, key, "", "", "", 1000)
+
+	if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		return
+	}
+
+	if err == nil {
+
+		for _, upload := range uploads.Uploads {
+
+			if upload.Key != key {
+				continue
+			}
+
+			if err = t.client.AbortMultipartUpload(ctx, t.cfg.Bucket, key, upload.UploadID); err != nil {
+				break
+			}
+
+			t.logger.Emit(
+				logging.Entry{
+					Level: logging.Info,
+					Event: logging.Events.Offsite.UploadAborted,
+
+					Details: map[string]any{
+						"target":    t.Name(),
+						"key":       key,
+						"upload_id": upload.UploadID,
+						"initiated": upload.Initiated,
+					},
+				},
+			)
+		}
+	}
+
+	if err != nil {
+
+		t.logger.Emit(
+			logging.Entry{
+				Level: logging.Warn,
+				Event: logging.Events.Offsite.AbortFailed,
+
+				Details: map[string]any{
+					"target": t.Name(),
+					"key":    key,
+					"error":  err.Error(),
+				},
+			},
+		)
+	}
+}
+
+// uploadMultipart uploads f in parts, resuming a pending upload of key.
+// It returns the ETag S3 gives the completed object.
+func (t *s3Target) uploadMultipart(ctx context.Context, f *os.File, size int64, key string) (string, error) {
+
+	uploadID, uploaded, err := t.pendingUpload(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	if uploadID == "" {
+
+		uploadID, err = t.client.NewMultipartUpload(
+			ctx,
+			t.cfg.Bucket,
+			key,
+			minio.PutObjectOptions{},
+		)
+		if err != nil {
+			return "", fmt.Errorf("start multipart upload: %w", err)
+		}
+	}
+
+	var parts []minio.CompletePart
+
+	// The ETag of a multipart object is the MD5 of its parts' MD5s.
+	etag := md5.New()
+
+	reused := 0
+
+	for number, offset := 1, int64(0); offset < size; number, offset = number+1, offset+t.partSize {
+
+		length := min(t.partSize, size-offset)
+
+		section := io.NewSectionReader(f, offset, length)
+
+		hash := md5.New()
+
+		if _, err := io.Copy(hash, section); err != nil {
+			return "", err
+		}
+
+		sum := hash.Sum(nil)
+
+		etag.Write(sum)
+
+		// Reuse the part when a previous attempt already uploaded
+		// exactly these bytes.
+		if etag, ok := uploaded[number]; ok && etag == hex.EncodeToString(sum) {
+
+			parts = append(parts, minio.CompletePart{PartNumber: number, ETag: etag})
+			reused++
+
+			continue
+		}
+
+		if _, err := section.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+
+		part, err := t.client.PutObjectPart(
+			ctx,
+			t.cfg.Bucket,
+			key,
+			uploadID,
+			number,
+			section,
+			length,
+			minio.PutObjectPartOptions{
+				Md5Base64: base64.StdEncoding.EncodeToString(sum),
+			},
+		)
+		if err != nil {
+			return "", fmt.Errorf("upload part %d: %w", number, err)
+		}
+
+		parts = append(parts, minio.CompletePart{PartNumber: number, ETag: part.ETag})
+	}
+
+	if reused > 0 {
+
+		t.logger.Emit(
+			logging.Entry{
+				Level: logging.Info,
+				Event: logging.Events.Offsite.UploadResumed,
+
+				Details: map[string]any{
+					"target": t.Name(),
+					"key":    key,
+					"reused": reused,
+					"parts":  len(parts),
+				},
+			},
+		)
+	}
+
+	_, err = t.client.CompleteMultipartUpload(
+		ctx,
+		t.cfg.Bucket,
+		key,
+		uploadID,
+		parts,
+		minio.PutObjectOptions{},
+	)
+	if err != nil {
+		return "", fmt.Errorf("complete multipart upload: %w", err)
+	}
+
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(etag.Sum(nil)), len(parts)), nil
+}
+
+// pendingUpload finds the newest incomplete multipart upload of key and
+// the ETags of its uploaded parts, by part number. It returns an empty
+// upload ID when there is nothing to resume.
+func (t *s3Target) pendingUpload(ctx context.Context, key string) (string, map[int]string, error) {
+
+	uploads, err := t.client.ListMultipartUploads(ctx, t.cfg.Bucket, key, "", "", "", 1000)
+
+	// Some S3 implementations answer NoSuchUpload instead of an empty
+	// list for buckets that never had a multipart upload.
+	if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		return "", nil, nil
+	}
+
+	if err != nil {
+		return "", nil, fmt.Errorf("list multipart uploads: %w", err)
+	}
+
+	var pending *minio.ObjectMultipartInfo
+
+	for i, upload := range uploads.Uploads {
+
+		if upload.Key != key {
+			continue
+		}
+
+		if pending == nil || upload.Initiated.After(pending.Initiated) {
+			pending = &uploads.Uploads[i]
+		}
+	}
+
+	if pending == nil {
+		return "", nil, nil
+	}
+
+	uploaded := make(map[int]string)
+
+	marker := 0
+
+	for {
+
+		result, err := t.client.ListObjectParts(ctx, t.cfg.Bucket, key, pending.UploadID, marker, 1000)
+		if err != nil {
+			return "", nil, fmt.Errorf("list uploaded parts: %w", err)
+		}
+
+		for _, part := range result.ObjectParts {
+			uploaded[part.PartNumber] = strings.Trim(part.ETag, `"`)
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+
+		marker = result.NextPartNumberMarker
+	}
+
+	return pending.UploadID, uploaded, nil
+}
+
+func (t *s3Target) List(ctx context.Context) ([]string, error) {
+
+	prefix := t.cfg.Prefix
+
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var names []string
+
+	for object := range t.client.Client.ListObjects(
+		ctx,
+		t.cfg.Bucket,
+		minio.ListObjectsOptions{Prefix: prefix},
+	) {
+
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		name := strings.TrimPrefix(object.Key, prefix)
+
+		// Skip "directories" below the prefix; snapshots are stored flat.
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// Close is a no-op; the S3 client holds no connection between requests.
+func (t *s3Target) Close() error {
+	return nil
+}
+
+func (t *s3Target) Delete(ctx context.Context, name string) error {
+
+	return t.client.RemoveObject(
+		ctx,
+		t.cfg.Bucket,
+		t.key(name),
+		minio.RemoveObjectOptions{},
+	)
+}
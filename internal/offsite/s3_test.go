@@ -0,0 +1,414 @@
+// internal/offsite/s3_test.go
+
+package offsite
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+)
+
+// fakeS3 is an in-memory S3 bucket serving the requests s3Target makes,
+// path-style and without checking signatures. With corrupt set, it
+// stores every object with its last byte flipped.
+type fakeS3 struct {
+	bucket  string
+	corrupt bool
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	uploads map[string]*fakeUpload
+	parts   int
+}
+
+type fakeObject struct {
+	data []byte
+	etag string
+}
+
+type fakeUpload struct {
+	key       string
+	initiated time.Time
+	parts     map[int][]byte
+}
+
+type fakePart struct {
+	PartNumber int
+	ETag       string
+	Size       int
+}
+
+type fakePendingUpload struct {
+	Key       string
+	UploadID  string `xml:"UploadId"`
+	Initiated time.Time
+}
+
+// etag returns the ETag S3 gives a single-part object or part.
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readBody returns the payload of a request, decoding the aws-chunked
+// encoding minio-go uses for signed uploads over plain HTTP.
+func readBody(r *http.Request) ([]byte, error) {
+
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	reader := bufio.NewReader(r.Body)
+
+	var data []byte
+
+	for {
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(line), ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if size == 0 {
+			return data, nil
+		}
+
+		chunk := make([]byte, size+2)
+
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, err
+		}
+
+		data = append(data, chunk[:size]...)
+	}
+}
+
+func writeXML(w http.ResponseWriter, value any) {
+
+	w.Header().Set("Content-Type", "application/xml")
+
+	if err := xml.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+s.bucket), "/")
+	query := r.URL.Query()
+
+	switch {
+
+	case r.Method == http.MethodGet && key == "" && query.Has("uploads"):
+
+		var list struct {
+			XMLName xml.Name `xml:"ListMultipartUploadsResult"`
+			Bucket  string
+			Uploads []fakePendingUpload `xml:"Upload"`
+		}
+
+		list.Bucket = s.bucket
+
+		for id, upload := range s.uploads {
+
+			if strings.HasPrefix(upload.key, query.Get("prefix")) {
+				list.Uploads = append(list.Uploads, fakePendingUpload{upload.key, id, upload.initiated})
+			}
+		}
+
+		writeXML(w, list)
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+
+		id := fmt.Sprintf("upload-%d", len(s.uploads)+1)
+
+		s.uploads[id] = &fakeUpload{key: key, initiated: time.Now().UTC(), parts: make(map[int][]byte)}
+
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: s.bucket, Key: key, UploadID: id})
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+
+		upload, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+
+		data, err := readBody(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+
+		upload.parts[number] = data
+		s.parts++
+
+		w.Header().Set("ETag", `"`+etag(data)+`"`)
+
+	case r.Method == http.MethodGet && query.Has("uploadId"):
+
+		upload, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+
+		var parts []fakePart
+
+		for number, data := range upload.parts {
+			parts = append(parts, fakePart{number, `"` + etag(data) + `"`, len(data)})
+		}
+
+		sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"ListPartsResult"`
+			Bucket  string
+			Key     string
+			Parts   []fakePart `xml:"Part"`
+		}{Bucket: s.bucket, Key: key, Parts: parts})
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+
+		upload, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+
+		var complete struct {
+			Parts []fakePart `xml:"Part"`
+		}
+
+		if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var parts [][]byte
+
+		for _, part := range complete.Parts {
+			parts = append(parts, upload.parts[part.PartNumber])
+		}
+
+		object := s.store(key, parts, true)
+
+		delete(s.uploads, query.Get("uploadId"))
+
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: s.bucket, Key: key, ETag: `"` + object.etag + `"`})
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+
+		data, err := readBody(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		object := s.store(key, [][]byte{data}, false)
+
+		w.Header().Set("ETag", `"`+object.etag+`"`)
+
+	case r.Method == http.MethodHead:
+
+		object, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("ETag", `"`+object.etag+`"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+// store saves an object made of parts, damaging its last byte when
+// corrupt is set, and gives it the ETag S3 would: the MD5 of the data,
+// or of the parts' MD5s for a multipart upload.
+func (s *fakeS3) store(key string, parts [][]byte, multipart bool) fakeObject {
+
+	if s.corrupt {
+		last := append([]byte(nil), parts[len(parts)-1]...)
+		last[len(last)-1] ^= 0xff
+		parts = append(parts[:len(parts)-1:len(parts)-1], last)
+	}
+
+	object := fakeObject{data: bytes.Join(parts, nil)}
+
+	if multipart {
+
+		var sums []byte
+
+		for _, part := range parts {
+			sum := md5.Sum(part)
+			sums = append(sums, sum[:]...)
+		}
+
+		object.etag = fmt.Sprintf("%s-%d", etag(sums), len(parts))
+
+	} else {
+		object.etag = etag(object.data)
+	}
+
+	s.objects[key] = object
+
+	return object
+}
+
+func newTestS3(t *testing.T) (*s3Target, *fakeS3) {
+
+	t.Helper()
+
+	fake := &fakeS3{
+		bucket:  "backups",
+		objects: make(map[string]fakeObject),
+		uploads: make(map[string]*fakeUpload),
+	}
+
+	server := httptest.NewServer(fake)
+
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "gitback")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	logger, err := logging.New(filepath.Join(t.TempDir(), "gitback.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { logger.Close() })
+
+	target, err := newS3(config.OffsiteConfig{
+		Type:     config.OffsiteS3,
+		Endpoint: server.URL,
+		Region:   "us-east-1",
+		Bucket:   fake.bucket,
+		Prefix:   "gitback",
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Small parts keep the multipart path cheap to exercise.
+	target.partSize = 1 << 10
+
+	return target, fake
+}
+
+func writeRandomFile(t *testing.T, name string, size int) (string, []byte) {
+
+	t.Helper()
+
+	content := make([]byte, size)
+
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(file, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file, content
+}
+
+func TestS3UploadResumesAndAbortsStaleUploads(t *testing.T) {
+
+	target, fake := newTestS3(t)
+
+	file, content := writeRandomFile(t, "gitback-snapshot.tar.zst", 3<<10+512)
+
+	key := "gitback/gitback-snapshot.tar.zst"
+	initiated := time.Now().UTC().Add(-time.Hour)
+
+	// An abandoned attempt, and a newer one that got its first part
+	// across before it was interrupted.
+	fake.uploads["stale"] = &fakeUpload{key: key, initiated: initiated, parts: map[int][]byte{1: []byte("old")}}
+	fake.uploads["pending"] = &fakeUpload{key: key, initiated: initiated.Add(time.Minute), parts: map[int][]byte{1: content[:1<<10]}}
+	fake.uploads["other"] = &fakeUpload{key: key + ".sha256", initiated: initiated, parts: map[int][]byte{}}
+
+	if err := target.Upload(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(fake.objects[key].data, content) {
+		t.Fatal("uploaded object differs from the local file")
+	}
+
+	if fake.parts != 3 {
+		t.Fatalf("uploaded %d parts, want 3 with the first one reused", fake.parts)
+	}
+
+	if len(fake.uploads) != 1 || fake.uploads["other"] == nil {
+		t.Fatalf("pending uploads left: %v, want only the one of another key", fake.uploads)
+	}
+}
+
+func TestS3UploadRejectsMismatchedObject(t *testing.T) {
+
+	target, fake := newTestS3(t)
+
+	fake.corrupt = true
+
+	for _, size := range []int{100, 3 << 10} {
+
+		file, _ := writeRandomFile(t, "gitback-snapshot.tar.zst", size)
+
+		err := target.Upload(context.Background(), file)
+
+		if err == nil || !strings.Contains(err.Error(), "ETag") {
+			t.Fatalf("upload of %d bytes stored as a different object: %v", size, err)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+// internal/offsite/sftp.go
+
+package offsite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpTarget stores snapshots in a directory on an SSH host.
+//
+// Files are written under a ".partial" name, read back and compared
+// against the local SHA-256, and only then renamed into place, so the
+// remote directory never holds a truncated or corrupted snapshot under
+// its real name.
+type sftpTarget struct {
+	cfg config.OffsiteConfig
+
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+func newSFTP(cfg config.OffsiteConfig) *sftpTarget {
+	return &sftpTarget{cfg: cfg}
+}
+
+func (t *sftpTarget) Name() string {
+	return t.cfg.DisplayName()
+}
+
+// connect opens the SSH connection and SFTP session on first use, and
+// again after an operation failed.
+func (t *sftpTarget) connect(ctx context.Context) (*sftp.Client, error) {
+
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	key, err := os.ReadFile(t.cfg.IdentityFile)
+	if err != nil {
+		return nil, fmt.Errorf("read identity file: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("parse identity file: %w", err)
+	}
+
+	knownHostsFile := t.cfg.KnownHostsFile
+
+	if knownHostsFile == "" {
+
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read known hosts: %w", err)
+	}
+
+	address := t.cfg.Host
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+
+	var dialer net.Dialer
+
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	sshConn, channels, requests, err := ssh.NewClientConn(
+		netConn,
+		address,
+		&ssh.ClientConfig{
+			User:            t.cfg.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+		},
+	)
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s: %w", address, err)
+	}
+
+	conn := ssh.NewClient(sshConn, channels, requests)
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("start sftp session: %w", err)
+	}
+
+	t.conn = conn
+	t.client = client
+
+	return client, nil
+}
+
+func (t *sftpTarget) Upload(ctx context.Context, file string) error {
+
+	client, err := t.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := t.upload(ctx, client, file); err != nil {
+		t.disconnect()
+		return err
+	}
+
+	return nil
+}
+
+// upload copies file to its ".partial" name, verifies it and renames it
+// into place. A ".partial" left by an interrupted upload is resumed when
+// it still matches the start of file.
+func (t *sftpTarget) upload(ctx context.Context, client *sftp.Client, file string) error {
+
+	if err := client.MkdirAll(t.cfg.Directory); err != nil {
+		return fmt.Errorf("create remote directory: %w", err)
+	}
+
+	remote := path.Join(t.cfg.Directory, filepath.Base(file))
+	partial := remote + ".partial"
+
+	local, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	hash := sha256.New()
+
+	offset, err := t.resumeOffset(ctx, client, local, partial)
+	if err != nil {
+		return err
+	}
+
+	// The hash covers the whole file, so the read back below also
+	// checks the part sent by an earlier attempt.
+	if _, err := io.CopyN(hash, local, offset); err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	dst, err := client.OpenFile(partial, flags)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", partial, err)
+	}
+
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		dst.Close()
+		return fmt.Errorf("seek %s: %w", partial, err)
+	}
+
+	_, err = io.Copy(dst, io.TeeReader(&contextReader{ctx: ctx, r: local}, hash))
+
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	// The ".partial" is kept, so the next attempt can resume it.
+	if err != nil {
+		return fmt.Errorf("upload %s: %w", partial, err)
+	}
+
+	// Read the file back rather than trusting the transfer.
+	remoteSum, err := t.sha256(ctx, client, partial)
+	if err != nil {
+		client.Remove(partial)
+		return err
+	}
+
+	if !bytes.Equal(remoteSum, hash.Sum(nil)) {
+		client.Remove(partial)
+		return fmt.Errorf("remote checksum mismatch for %s", remote)
+	}
+
+	if err := client.PosixRename(partial, remote); err != nil {
+		return fmt.Errorf("rename %s: %w", partial, err)
+	}
+
+	return nil
+}
+
+// resumeOffset returns how much of local the existing partial already
+// holds, or 0 when there is none or it doesn't match local's start. It
+// leaves local at its start.
+func (t *sftpTarget) resumeOffset(ctx context.Context, client *sftp.Client, local *os.File, partial string) (int64, error) {
+
+	remote, err := client.Stat(partial)
+	if err != nil || remote.Size() == 0 {
+		return 0, nil
+	}
+
+	info, err := local.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if remote.Size() > info.Size() {
+		return 0, nil
+	}
+
+	prefix := sha256.New()
+
+	if _, err := io.CopyN(prefix, local, remote.Size()); err != nil {
+		return 0, err
+	}
+
+	if _, err := local.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	remoteSum, err := t.sha256(ctx, client, partial)
+	if err != nil {
+		return 0, err
+	}
+
+	if !bytes.Equal(remoteSum, prefix.Sum(nil)) {
+		return 0, nil
+	}
+
+	return remote.Size(), nil
+}
+
+// sha256 hashes a remote file.
+func (t *sftpTarget) sha256(ctx context.Context, client *sftp.Client, name string) ([]byte, error) {
+
+	f, err := client.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+
+	// Large reads let the SFTP client keep several requests in flight.
+	buffer := make([]byte, 1<<20)
+
+	if _, err := io.CopyBuffer(hash, &contextReader{ctx: ctx, r: f}, buffer); err != nil {
+		return nil, fmt.Errorf("read back %s: %w", name, err)
+	}
+
+	return hash.Sum(nil), nil
+}
+
+func (t *sftpTarget) List(ctx context.Context) ([]string, error) {
+
+	client, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := client.ReadDir(t.cfg.Directory)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		t.disconnect()
+		return nil, err
+	}
+
+	var names []string
+
+	for _, entry := range entries {
+
+		if entry.Mode().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+func (t *sftpTarget) Delete(ctx context.Context, name string) error {
+
+	client, err := t.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Remove(path.Join(t.cfg.Directory, name)); err != nil {
+		t.disconnect()
+		return err
+	}
+
+	return nil
+}
+
+func (t *sftpTarget) Close() error {
+
+	if t.client == nil {
+		return nil
+	}
+
+	t.client.Close()
+
+	err := t.conn.Close()
+
+	t.client = nil
+	t.conn = nil
+
+	return err
+}
+
+// disconnect drops the connection after a failed operation, so the
+// next attempt reconnects instead of reusing one that may be dead.
+func (t *sftpTarget) disconnect() {
+	t.Close()
+}
+
+// contextReader stops a long copy once ctx is canceled; SFTP file
+// handles don't take a context of their own.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(p)
+}
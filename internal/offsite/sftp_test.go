@@ -0,0 +1,332 @@
+// internal/offsite/sftp_test.go
+
+package offsite
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshServer is an in-process SSH server with an SFTP subsystem serving
+// the local filesystem. The first connection it accepts is dropped
+// after the server has read dropAfter bytes from it.
+type sshServer struct {
+	listener  net.Listener
+	config    *ssh.ServerConfig
+	dropAfter int64
+
+	connections atomic.Int32
+
+	mu       sync.Mutex
+	received []*countingConn
+}
+
+// countingConn counts the bytes read from a connection, and closes it
+// once limit is exceeded when limit is positive.
+type countingConn struct {
+	net.Conn
+	limit int64
+	read  atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+
+	n, err := c.Conn.Read(p)
+
+	if c.read.Add(int64(n)) > c.limit && c.limit > 0 {
+		c.Conn.Close()
+	}
+
+	return n, err
+}
+
+func (s *sshServer) serve() {
+
+	for {
+
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		counted := &countingConn{Conn: conn}
+
+		if s.connections.Add(1) == 1 {
+			counted.limit = s.dropAfter
+		}
+
+		s.mu.Lock()
+		s.received = append(s.received, counted)
+		s.mu.Unlock()
+
+		go s.handle(counted)
+	}
+}
+
+func (s *sshServer) handle(conn net.Conn) {
+
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+
+			for request := range requests {
+
+				// The payload is the length-prefixed subsystem name.
+				ok := request.Type == "subsystem" && string(request.Payload[4:]) == "sftp"
+
+				request.Reply(ok, nil)
+
+				if !ok {
+					continue
+				}
+
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					channel.Close()
+					return
+				}
+
+				server.Serve()
+				server.Close()
+			}
+		}()
+	}
+}
+
+// newTestSFTP starts an SSH server and returns a target configured to
+// upload into a temporary directory on it.
+func newTestSFTP(t *testing.T, dropAfter int64) (*sftpTarget, *sshServer) {
+
+	t.Helper()
+
+	dir := t.TempDir()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientPublic, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorized, err := ssh.NewPublicKey(clientPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+
+			if !bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, os.ErrPermission
+			}
+
+			return nil, nil
+		},
+	}
+
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	server := &sshServer{
+		listener:  listener,
+		config:    serverConfig,
+		dropAfter: dropAfter,
+	}
+
+	go server.serve()
+
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identityFile := filepath.Join(dir, "id_ed25519")
+
+	if err := os.WriteFile(identityFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	address := listener.Addr().String()
+
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(address)}, hostSigner.PublicKey())
+
+	if err := os.WriteFile(knownHostsFile, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	target := newSFTP(config.OffsiteConfig{
+		Type:           config.OffsiteSFTP,
+		Host:           address,
+		User:           "backup",
+		IdentityFile:   identityFile,
+		KnownHostsFile: knownHostsFile,
+		Directory:      filepath.Join(dir, "remote"),
+	})
+
+	t.Cleanup(func() { target.Close() })
+
+	return target, server
+}
+
+func TestSFTPUploadResumesAfterDroppedConnection(t *testing.T) {
+
+	const size = 8 << 20
+
+	target, server := newTestSFTP(t, size/2)
+
+	content := make([]byte, size)
+
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "gitback-snapshot.tar.zst")
+
+	if err := os.WriteFile(file, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if err := target.Upload(ctx, file); err == nil {
+		t.Fatal("upload over a dropped connection succeeded")
+	}
+
+	remote := filepath.Join(target.cfg.Directory, filepath.Base(file))
+
+	info, err := os.Stat(remote + ".partial")
+	if err != nil {
+		t.Fatalf("partial upload not kept: %v", err)
+	}
+
+	if info.Size() == 0 || info.Size() >= size {
+		t.Fatalf("partial upload holds %d of %d bytes", info.Size(), size)
+	}
+
+	// The retry has to reconnect rather than reuse the dead client.
+	if err := target.Upload(ctx, file); err != nil {
+		t.Fatalf("retry after dropped connection: %v", err)
+	}
+
+	if got := server.connections.Load(); got != 2 {
+		t.Fatalf("got %d connections, want 2", got)
+	}
+
+	uploaded, err := os.ReadFile(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(uploaded, content) {
+		t.Fatal("uploaded file differs from the local file")
+	}
+
+	if _, err := os.Stat(remote + ".partial"); !os.IsNotExist(err) {
+		t.Fatalf("partial upload left behind: %v", err)
+	}
+
+	// Resuming sends only what the dropped connection didn't.
+	server.mu.Lock()
+	resumed := server.received[1].read.Load()
+	server.mu.Unlock()
+
+	if resumed >= size {
+		t.Fatalf("retry sent %d bytes for a %d byte file, want a resumed upload", resumed, size)
+	}
+}
+
+func TestSFTPListAndDelete(t *testing.T) {
+
+	target, _ := newTestSFTP(t, 0)
+
+	ctx := context.Background()
+
+	names, err := target.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 0 {
+		t.Fatalf("missing directory listed %v", names)
+	}
+
+	file := filepath.Join(t.TempDir(), "gitback-snapshot.tar.zst.sha256")
+
+	if err := os.WriteFile(file, []byte("checksum\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := target.Upload(ctx, file); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err = target.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 1 || names[0] != filepath.Base(file) {
+		t.Fatalf("listed %v, want [%s]", names, filepath.Base(file))
+	}
+
+	if err := target.Delete(ctx, filepath.Base(file)); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err = target.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 0 {
+		t.Fatalf("listed %v after delete", names)
+	}
+}
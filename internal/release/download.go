@@ -0,0 +1,301 @@
+// internal/release/download.go
+
+package release
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/filesystem"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/google/go-github/v88/github"
+)
+
+// FormatVersion is the layout version of NotesFile.
+const FormatVersion = 1
+
+// NotesFile holds a release as the GitHub REST API returns it, notes
+// included, next to its downloaded assets.
+const NotesFile = "release.json"
+
+type notes struct {
+	Version    int                       `json:"version"`
+	Repository string                    `json:"repository"`
+	Release    *github.RepositoryRelease `json:"release"`
+}
+
+// writeNotes writes release to path, without download counts, and
+// returns the SHA-256 of what was written.
+func writeNotes(path string, repository string, release *github.RepositoryRelease) (string, error) {
+
+	// Download counts change all the time and would make every sync
+	// look like a change worth a new snapshot.
+	stripped := *release
+	stripped.Assets = make([]*github.ReleaseAsset, len(release.Assets))
+
+	for i, asset := range release.Assets {
+
+		copied := *asset
+		copied.DownloadCount = nil
+
+		stripped.Assets[i] = &copied
+	}
+
+	content, err := json.MarshalIndent(
+		notes{
+			Version:    FormatVersion,
+			Repository: repository,
+			Release:    &stripped,
+		},
+		"",
+		"  ",
+	)
+	if err != nil {
+		return "", fmt.Errorf("encode %s: %w", NotesFile, err)
+	}
+
+	content = append(content, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("create release directory: %w", err)
+	}
+
+	if err := filesystem.AtomicWriteFile(
+		path,
+		0600,
+		func(w io.Writer) error {
+			_, err := w.Write(content)
+			return err
+		},
+	); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// syncAsset downloads one release asset to the file with the given
+// asset name, unless the file already holds it. It reports false when
+// the asset is over the size limit and was skipped.
+func (e *Engine) syncAsset(
+	ctx context.Context,
+	owner string,
+	repo string,
+	file *github.ReleaseAsset,
+	name string,
+	known map[string]state.Asset,
+) (state.Asset, bool) {
+
+	repoName := owner + "/" + repo
+	size := int64(file.GetSize())
+
+	if limit := int64(e.cfg.GitHub.MaxReleaseAssetMB) * 1024 * 1024; limit > 0 && size > limit {
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Warn,
+				Event: logging.Events.Release.AssetSkipped,
+				Repo:  repoName,
+
+				Details: map[string]any{
+					"asset":  name,
+					"size":   size,
+					"max_mb": e.cfg.GitHub.MaxReleaseAssetMB,
+				},
+			},
+		)
+
+		fmt.Printf("[SKIP] %s (%d MB, over max_release_asset_mb)\n", name, size/(1024*1024))
+
+		return state.Asset{}, false
+	}
+
+	asset := state.Asset{Name: name}
+
+	// GitHub publishes a digest for recently uploaded assets; older
+	// ones are compared with what the last sync downloaded.
+	digest, hasDigest := strings.CutPrefix(file.GetDigest(), "sha256:")
+
+	expected := digest
+
+	if previous, ok := known[name]; !hasDigest && ok && previous.LastSuccess {
+		expected = previous.Fingerprint
+	}
+
+	target := e.localPath(name)
+
+	if expected != "" {
+
+		sum, n, err := HashFile(target)
+
+		if err == nil && n == size && sum == expected {
+
+			asset.LastSuccess = true
+			asset.Fingerprint = sum
+
+			return asset, true
+		}
+	}
+
+	if !hasDigest {
+		digest = ""
+	}
+
+	sum, err := e.download(ctx, owner, repo, file, target, digest)
+
+	if err != nil {
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Error,
+				Event: logging.Events.Release.AssetDownloadFailed,
+				Repo:  repoName,
+				Error: err.Error(),
+
+				Details: map[string]any{
+					"asset": name,
+				},
+			},
+		)
+
+		asset.Error = err.Error()
+
+		return asset, true
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Release.AssetDownloaded,
+			Repo:  repoName,
+
+			Details: map[string]any{
+				"asset":  name,
+				"size":   size,
+				"sha256": sum,
+			},
+		},
+	)
+
+	asset.LastSuccess = true
+	asset.Fingerprint = sum
+
+	return asset, true
+}
+
+// download streams a release asset into target through a temporary file
+// beside it, so target only ever holds a complete download, and returns
+// the SHA-256 of its content. A download that doesn't match digest, when
+// GitHub published one, leaves target as it was.
+func (e *Engine) download(ctx context.Context, owner string, repo string, file *github.ReleaseAsset, target string, digest string) (string, error) {
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return "", fmt.Errorf("create release directory: %w", err)
+	}
+
+	body, _, err := e.api.Repositories.DownloadReleaseAsset(ctx, owner, repo, file.GetID(), http.DefaultClient)
+	if err != nil {
+		return "", err
+	}
+
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".download-*")
+	if err != nil {
+		return "", err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size := int64(file.GetSize())
+
+	// Reading one byte past the expected size is enough to tell that
+	// the download doesn't match it.
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(body, size+1))
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if n != size {
+		return "", fmt.Errorf("downloaded %d bytes, expected %d", n, size)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	if digest != "" && sum != digest {
+		return "", fmt.Errorf("content doesn't match the digest GitHub published (%s)", file.GetDigest())
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", err
+	}
+
+	return sum, nil
+}
+
+// HashFile returns the SHA-256 and size of the file at path, as
+// recorded in the fingerprint of a downloaded release file.
+func HashFile(path string) (string, int64, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	n, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
+
+// directoryName is the directory a release's files are kept in: its tag,
+// or for a draft without one, its ID.
+func directoryName(release *github.RepositoryRelease) string {
+
+	if release.GetTagName() == "" {
+		return fmt.Sprintf("draft-%d", release.GetID())
+	}
+
+	return fileName(release.GetTagName())
+}
+
+// fileName turns a tag or asset name into a single path element. Tags
+// may contain slashes, and neither may be allowed to leave the
+// releases directory.
+func fileName(name string) string {
+
+	escaped := url.PathEscape(name)
+
+	switch escaped {
+	case "":
+		return "_"
+	case ".", "..":
+		return strings.ReplaceAll(escaped, ".", "%2E")
+	}
+
+	return escaped
+}
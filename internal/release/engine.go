@@ -0,0 +1,331 @@
+// internal/release/engine.go
+// Package release downloads the notes and assets of GitHub releases,
+// which live only on GitHub and never reach a git mirror.
+
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/githubapi"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/runtime"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/google/go-github/v88/github"
+)
+
+type Engine struct {
+	cfg    *config.Config
+	layout runtime.Layout
+	logger *logging.Logger
+	api    *github.Client
+}
+
+func New(cfg *config.Config, layout runtime.Layout, logger *logging.Logger) (*Engine, error) {
+	api, err := githubapi.NewClient(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{cfg: cfg, layout: layout, logger: logger, api: api}, nil
+}
+
+// RelativePath maps a clone URL to its releases directory relative to
+// the mirror root: releases/<owner>/<name>. Like asset names, it always
+// uses forward slashes.
+func RelativePath(repoURL string) string {
+
+	owner, name := githubapi.SplitURL(repoURL)
+
+	return path.Join("releases", owner, name)
+}
+
+// Sync downloads the releases of every repository in the inventory and
+// returns one asset per file below the releases directory, named by its
+// path relative to the mirror root. A repository whose releases can't be
+// listed is recorded as a single failed asset named after its releases
+// directory, and keeps whatever was downloaded before.
+//
+// previous holds the release assets the last sync recorded; files whose
+// content still matches them are not downloaded again. ids maps clone
+// URLs to GitHub IDs, so a renamed or transferred repository's releases
+// move along with it.
+func (e *Engine) Sync(ctx context.Context, ids map[string]int64, previous []state.Asset) ([]state.Asset, error) {
+
+	repositories, err := state.ReadInventory(e.layout.RepositoryInventoryFile)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf(
+			"read repository inventory %s: %w",
+			e.layout.RepositoryInventoryFile,
+			err,
+		)
+	}
+
+	known := make(map[string]state.Asset, len(previous))
+	directories := make(map[int64]string)
+
+	for _, asset := range previous {
+
+		known[asset.Name] = asset
+
+		if asset.ID != 0 {
+			directories[asset.ID] = repositoryDirectory(asset.Name)
+		}
+	}
+
+	var assets []state.Asset
+
+	for i, repo := range repositories {
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		dir := RelativePath(repo)
+
+		// A renamed or transferred repository keeps its downloads, which
+		// then only need to be checked against GitHub again.
+		if moved, ok := directories[ids[repo]]; ok && ids[repo] != 0 && moved != dir {
+
+			if e.relocate(moved, dir, ids[repo]) {
+				known = rename(known, moved, dir)
+			}
+		}
+
+		synced, err := e.syncRepository(ctx, repo, ids[repo], known)
+
+		assets = append(assets, synced...)
+
+		// Every other repository would fail the same way.
+		var rateErr *github.RateLimitError
+
+		if errors.As(err, &rateErr) {
+
+			fmt.Printf("[WARN] GitHub rate limit reached, resets at %s\n", rateErr.Rate.Reset.UTC().Format(time.RFC3339))
+
+			// The rest keep what the last sync recorded for them.
+			for _, skipped := range repositories[i+1:] {
+				assets = append(assets, below(previous, RelativePath(skipped))...)
+			}
+
+			break
+		}
+	}
+
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Name < assets[j].Name
+	})
+
+	return assets, nil
+}
+
+// syncRepository downloads every release of one repository. The error
+// is the one that failed its listing, if any.
+func (e *Engine) syncRepository(
+	ctx context.Context,
+	repoURL string,
+	id int64,
+	known map[string]state.Asset,
+) ([]state.Asset, error) {
+
+	owner, name := githubapi.SplitURL(repoURL)
+	repoName := owner + "/" + name
+	dir := RelativePath(repoURL)
+
+	fmt.Printf("[RELEASES] %s\n", repoName)
+
+	releases, err := e.listReleases(ctx, owner, name)
+
+	if err != nil {
+
+		e.logger.Error(
+			logging.Events.Release.ListFailed,
+			repoName,
+			err,
+		)
+
+		return []state.Asset{{
+			Name:  dir,
+			ID:    id,
+			Error: err.Error(),
+		}}, err
+	}
+
+	var assets []state.Asset
+
+	for _, release := range releases {
+
+		if err := ctx.Err(); err != nil {
+			return assets, err
+		}
+
+		releaseDir := path.Join(dir, directoryName(release))
+
+		notes := state.Asset{
+			Name: path.Join(releaseDir, NotesFile),
+			ID:   id,
+		}
+
+		sum, err := writeNotes(e.localPath(notes.Name), repoName, release)
+
+		if err != nil {
+			notes.Error = err.Error()
+		} else {
+			notes.LastSuccess = true
+			notes.Fingerprint = sum
+		}
+
+		assets = append(assets, notes)
+
+		for _, file := range release.Assets {
+
+			asset, ok := e.syncAsset(
+				ctx,
+				owner,
+				name,
+				file,
+				path.Join(releaseDir, fileName(file.GetName())),
+				known,
+			)
+
+			if !ok {
+				continue
+			}
+
+			asset.ID = id
+
+			assets = append(assets, asset)
+		}
+	}
+
+	return assets, nil
+}
+
+func (e *Engine) listReleases(ctx context.Context, owner string, name string) ([]*github.RepositoryRelease, error) {
+
+	var all []*github.RepositoryRelease
+
+	opts := &github.ListOptions{PerPage: githubapi.PerPage}
+
+	for {
+
+		releases, resp, err := e.api.Repositories.ListReleases(ctx, owner, name, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, releases...)
+
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+
+		opts.Page = resp.NextPage
+	}
+}
+
+// relocate moves the releases directory of a repository that was
+// renamed or transferred, both relative to the mirror root. It reports
+// whether the directory moved; if not, the releases are downloaded
+// again at the new path and the old directory stays behind.
+func (e *Engine) relocate(from string, to string, id int64) bool {
+
+	source := e.localPath(from)
+	target := e.localPath(to)
+
+	if _, err := os.Stat(source); err != nil {
+		return false
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		return false
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return false
+	}
+
+	if err := os.Rename(source, target); err != nil {
+		return false
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Release.Relocated,
+			Repo:  strings.TrimPrefix(to, "releases/"),
+
+			Details: map[string]any{
+				"id":   id,
+				"from": from,
+				"to":   to,
+			},
+		},
+	)
+
+	return true
+}
+
+// localPath returns where the file or directory with the given asset
+// name lives on disk.
+func (e *Engine) localPath(name string) string {
+	return filepath.Join(e.cfg.Storage.MirrorRoot, filepath.FromSlash(name))
+}
+
+// repositoryDirectory returns the releases directory an asset name
+// belongs to: its first three path elements.
+func repositoryDirectory(name string) string {
+
+	parts := strings.SplitN(name, "/", 4)
+
+	if len(parts) < 3 {
+		return name
+	}
+
+	return path.Join(parts[:3]...)
+}
+
+// below returns the assets in or below dir.
+func below(assets []state.Asset, dir string) []state.Asset {
+
+	var found []state.Asset
+
+	for _, asset := range assets {
+		if asset.Name == dir || strings.HasPrefix(asset.Name, dir+"/") {
+			found = append(found, asset)
+		}
+	}
+
+	return found
+}
+
+// rename re-keys the assets below from to the same paths below to.
+func rename(known map[string]state.Asset, from string, to string) map[string]state.Asset {
+
+	renamed := make(map[string]state.Asset, len(known))
+
+	for name, asset := range known {
+
+		if strings.HasPrefix(name, from+"/") {
+			name = to + strings.TrimPrefix(name, from)
+		}
+
+		renamed[name] = asset
+	}
+
+	return renamed
+}
@@ -0,0 +1,408 @@
+// internal/restore/restore.go
+// Package restore unpacks snapshots and optionally pushes the restored
+// mirrors back to a remote.
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/mirror"
+	"github.com/flarexes/gitback/internal/runtime"
+	"github.com/flarexes/gitback/internal/snapshot"
+)
+
+// Options describes a single restore request.
+type Options struct {
+	// Snapshot is a snapshot file name or path.
+	Snapshot string
+
+	// Repositories limits the restore to the given "owner/name"
+	// repositories. Empty restores the whole snapshot.
+	Repositories []string
+
+	// Destination is the directory the snapshot is extracted into.
+	Destination string
+
+	// PushURL, when set, receives the branches, tags and notes of every
+	// restored repository. "{owner}" and "{name}" are replaced per
+	// repository. Archived and starred mirrors are not pushed.
+	PushURL string
+}
+
+type Engine struct {
+	cfg    *config.Config
+	layout runtime.Layout
+	logger *logging.Logger
+}
+
+func New(cfg *config.Config, layout runtime.Layout, logger *logging.Logger) *Engine {
+	return &Engine{
+		cfg:    cfg,
+		layout: layout,
+		logger: logger,
+	}
+}
+
+func (e *Engine) Restore(ctx context.Context, opts Options) error {
+
+	start := time.Now()
+
+	archive, err := snapshot.Resolve(e.cfg, opts.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	if err := ensureEmptyDestination(opts.Destination); err != nil {
+		return err
+	}
+
+	selected, err := selectRepositories(opts.Repositories)
+	if err != nil {
+		return err
+	}
+
+	if len(selected) > 1 && opts.PushURL != "" && !strings.Contains(opts.PushURL, "{name}") {
+		return fmt.Errorf("--push-url must contain {name} when restoring more than one repository")
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Restore.Started,
+
+			Details: map[string]any{
+				"snapshot":     archive,
+				"destination":  opts.Destination,
+				"repositories": opts.Repositories,
+			},
+		},
+	)
+
+	fmt.Println("[1/3] Verifying checksum")
+
+	// An incremental snapshot is only as good as every snapshot it
+	// builds on, so the whole chain is checked before extracting.
+	chain, err := snapshot.Chain(archive)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range chain {
+
+		if err := snapshot.VerifyChecksum(step); err != nil {
+			return err
+		}
+	}
+
+	e.logger.Info(
+		logging.Events.Restore.ChecksumVerified,
+		"",
+	)
+
+	if len(chain) > 1 {
+		fmt.Printf("[2/3] Extracting snapshot (chain of %d)\n", len(chain))
+	} else {
+		fmt.Println("[2/3] Extracting snapshot")
+	}
+
+	var include func(string) bool
+
+	if len(selected) > 0 {
+		include = func(name string) bool {
+			return selected.matches(name)
+		}
+	}
+
+	if err := snapshot.Materialize(ctx, e.cfg, archive, opts.Destination, include); err != nil {
+		return err
+	}
+
+	restored, err := findRepositoryMirrors(opts.Destination)
+	if err != nil {
+		return err
+	}
+
+	if len(selected) > 0 {
+
+		if missing := selected.missing(restored); len(missing) > 0 {
+			return fmt.Errorf(
+				"repositories not found in snapshot: %s",
+				strings.Join(missing, ", "),
+			)
+		}
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Restore.Extracted,
+
+			Details: map[string]any{
+				"destination":  opts.Destination,
+				"repositories": len(restored),
+			},
+		},
+	)
+
+	var pushed []string
+
+	if opts.PushURL != "" {
+
+		fmt.Println("[3/3] Pushing mirrors")
+
+		pushed, err = e.push(ctx, restored, opts.PushURL)
+		if err != nil {
+			return err
+		}
+
+	} else {
+		fmt.Println("[3/3] Skipping push (no --push-url)")
+	}
+
+	fmt.Println()
+	fmt.Println("Snapshot restored to " + opts.Destination)
+
+	e.logger.Emit(
+		logging.Entry{
+			Level:      logging.Info,
+			Event:      logging.Events.Restore.Completed,
+			DurationMS: time.Since(start).Milliseconds(),
+
+			Details: map[string]any{
+				"snapshot":     archive,
+				"destination":  opts.Destination,
+				"repositories": len(restored),
+				"pushed":       pushed,
+			},
+		},
+	)
+
+	return nil
+}
+
+func (e *Engine) push(ctx context.Context, restored []repository, pushURL string) ([]string, error) {
+
+	engine := mirror.New(e.cfg, e.layout, e.logger)
+
+	var pushed []string
+
+	for _, repo := range restored {
+
+		// Archived and starred mirrors are restored, but pushing them
+		// would recreate deleted repositories, or someone else's, under
+		// the new remote.
+		if repo.kind != "" {
+
+			fmt.Printf("[SKIP] %s/%s (%s)\n", repo.owner, repo.name, repo.kind)
+
+			continue
+		}
+
+		remote := strings.NewReplacer(
+			"{owner}", repo.owner,
+			"{name}", repo.name,
+		).Replace(pushURL)
+
+		fmt.Printf("[PUSH] %s/%s\n", repo.owner, repo.name)
+
+		e.logger.Info(
+			logging.Events.Restore.PushStarted,
+			repo.owner+"/"+repo.name,
+		)
+
+		if err := engine.PushMirror(ctx, repo.path, remote); err != nil {
+			return pushed, err
+		}
+
+		e.logger.Info(
+			logging.Events.Restore.PushCompleted,
+			repo.owner+"/"+repo.name,
+		)
+
+		pushed = append(pushed, repo.owner+"/"+repo.name)
+	}
+
+	return pushed, nil
+}
+
+// ensureEmptyDestination refuses to extract over existing data, so a
+// mistyped --to can never clobber a live mirror tree.
+func ensureEmptyDestination(dest string) error {
+
+	entries, err := os.ReadDir(dest)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return os.MkdirAll(dest, 0700)
+	}
+
+	if err != nil {
+		return fmt.Errorf("inspect destination %s: %w", dest, err)
+	}
+
+	if len(entries) > 0 {
+		return fmt.Errorf("destination %s is not empty", dest)
+	}
+
+	return nil
+}
+
+// Kinds of restored repository mirrors besides the live ones.
+const (
+	kindArchived = "archived"
+	kindStarred  = "starred"
+)
+
+// repository is a restored repository mirror. kind is empty for the
+// mirror of a repository still in the inventory when the snapshot was
+// taken.
+type repository struct {
+	owner string
+	name  string
+	path  string
+	kind  string
+}
+
+// archiveStamp matches the timestamp mirror.Archive adds to a second
+// archived copy of the same repository.
+var archiveStamp = regexp.MustCompile(`\.\d{8}T\d{6}Z$`)
+
+// findRepositoryMirrors lists the repository mirrors below dest:
+//
+//	<root>/repositories/<owner>/<name>.git
+//	<root>/starred/<owner>/<name>.git
+//	<root>/archived/repositories/<owner>/<name>.git
+//	<root>/archived/starred/<owner>/<name>.git
+//
+// The mirror root directory name is whatever the source installation
+// used, so it is discovered rather than assumed.
+func findRepositoryMirrors(dest string) ([]repository, error) {
+
+	patterns := []struct {
+		path []string
+		kind string
+	}{
+		{[]string{"repositories"}, ""},
+		{[]string{mirror.StarredDirectory}, kindStarred},
+		{[]string{mirror.ArchiveDirectory, "repositories"}, kindArchived},
+		{[]string{mirror.ArchiveDirectory, mirror.StarredDirectory}, kindArchived},
+	}
+
+	var repos []repository
+
+	for _, pattern := range patterns {
+
+		elements := append([]string{dest, "*"}, pattern.path...)
+
+		matches, err := filepath.Glob(
+			filepath.Join(append(elements, "*", "*.git")...),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(matches)
+
+		for _, match := range matches {
+
+			repos = append(repos, repository{
+				owner: filepath.Base(filepath.Dir(match)),
+				name:  archiveStamp.ReplaceAllString(strings.TrimSuffix(filepath.Base(match), ".git"), ""),
+				path:  match,
+				kind:  pattern.kind,
+			})
+		}
+	}
+
+	return repos, nil
+}
+
+// selection is the set of "owner/name" repositories requested via --repo.
+type selection map[string]struct{}
+
+func selectRepositories(names []string) (selection, error) {
+
+	selected := make(selection, len(names))
+
+	for _, name := range names {
+
+		parts := strings.Split(name, "/")
+
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid repository %q: expected owner/name", name)
+		}
+
+		selected[strings.ToLower(name)] = struct{}{}
+	}
+
+	return selected, nil
+}
+
+// matches reports whether an archive entry belongs to a selected
+// repository, or to its wiki. Entries look like
+// "<root>/repositories/<owner>/<name>.git/...",
+// "<root>/wikis/<owner>/<name>.wiki.git/..." and
+// "<root>/starred/<owner>/<name>.git/...", possibly below
+// "<root>/archived/", or "<root>/repositories/<owner>/<name>.git.bundle"
+// in incremental snapshots.
+func (s selection) matches(name string) bool {
+
+	parts := strings.Split(path.Clean(name), "/")
+
+	if len(parts) > 1 && parts[1] == mirror.ArchiveDirectory {
+		parts = append(parts[:1], parts[2:]...)
+	}
+
+	if len(parts) < 4 {
+		return false
+	}
+
+	var repo string
+
+	entry := strings.TrimSuffix(parts[3], snapshot.BundleSuffix)
+
+	switch parts[1] {
+	case "repositories", mirror.StarredDirectory:
+		repo = archiveStamp.ReplaceAllString(strings.TrimSuffix(entry, ".git"), "")
+	case "wikis":
+		repo = strings.TrimSuffix(archiveStamp.ReplaceAllString(strings.TrimSuffix(entry, ".git"), ""), ".wiki")
+	default:
+		return false
+	}
+
+	_, ok := s[strings.ToLower(parts[2]+"/"+repo)]
+
+	return ok
+}
+
+func (s selection) missing(restored []repository) []string {
+
+	found := make(map[string]struct{}, len(restored))
+
+	for _, repo := range restored {
+		found[strings.ToLower(repo.owner+"/"+repo.name)] = struct{}{}
+	}
+
+	var missing []string
+
+	for name := range s {
+
+		if _, ok := found[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
@@ -24,9 +24,20 @@ type Layout struct {
 	LockFile  string
 	TempDir   string
 
+	SigningKeyFile       string
+	SigningPublicKeyFile string
+
 	MirrorsStateFile        string
 	RepositoryInventoryFile string
 	GistInventoryFile       string
+	WikiInventoryFile       string
+	StarredInventoryFile    string
+	VerificationStateFile   string
+	OffsiteStateFile        string
+	SafetyStateFile         string
+	InventoryHistoryFile    string
+	MetadataStateFile       string
+	SnapshotContentsFile    string
 }
 
 // New resolves Layout from the OS home directory (XDG-style conventions).
@@ -63,9 +74,20 @@ func newFromRoot(home, tmp string) Layout {
 		LockFile:  filepath.Join(tmp, "gitback.lock"),
 		TempDir:   filepath.Join(stateDir, "tmp"),
 
+		SigningKeyFile:       filepath.Join(stateDir, "signing.key"),
+		SigningPublicKeyFile: filepath.Join(stateDir, "signing.pub"),
+
 		MirrorsStateFile:        filepath.Join(stateDir, "mirrors.json"),
 		RepositoryInventoryFile: filepath.Join(stateDir, "repositories.txt"),
 		GistInventoryFile:       filepath.Join(stateDir, "gists.txt"),
+		WikiInventoryFile:       filepath.Join(stateDir, "wikis.txt"),
+		StarredInventoryFile:    filepath.Join(stateDir, "starred.txt"),
+		VerificationStateFile:   filepath.Join(stateDir, "verification.json"),
+		OffsiteStateFile:        filepath.Join(stateDir, "offsite.json"),
+		SafetyStateFile:         filepath.Join(stateDir, "safety.json"),
+		InventoryHistoryFile:    filepath.Join(stateDir, "inventory_history.json"),
+		MetadataStateFile:       filepath.Join(stateDir, "metadata.json"),
+		SnapshotContentsFile:    filepath.Join(stateDir, "snapshot_contents.json"),
 	}
 }
 
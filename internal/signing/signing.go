@@ -0,0 +1,121 @@
+// internal/signing/signing.go
+// Package signing manages the ed25519 key gitback signs snapshot
+// manifests with.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/filesystem"
+	"github.com/flarexes/gitback/internal/runtime"
+)
+
+// LoadOrCreate returns the installation's signing key, generating and
+// persisting a new one on first use. The private key is stored as a
+// base64 ed25519 seed, the public key next to it as plain base64 so it
+// can be copied into another host's config.
+func LoadOrCreate(layout runtime.Layout) (ed25519.PrivateKey, error) {
+
+	data, err := os.ReadFile(layout.SigningKeyFile)
+
+	if err == nil {
+
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("signing key %s is malformed", layout.SigningKeyFile)
+		}
+
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate signing key: %w", err)
+	}
+
+	if err := writeKey(layout.SigningKeyFile, private.Seed()); err != nil {
+		return nil, err
+	}
+
+	if err := writeKey(layout.SigningPublicKeyFile, public); err != nil {
+		return nil, err
+	}
+
+	return private, nil
+}
+
+// PublicKey resolves the key manifests are verified against: the
+// configured value when set, otherwise this installation's own key.
+// The fallback only proves a manifest wasn't corrupted: anyone able to
+// replace the snapshots on this host can replace that key too, so only
+// a pinned key checks who made them.
+func PublicKey(configured string, layout runtime.Layout) (ed25519.PublicKey, error) {
+
+	value := strings.TrimSpace(configured)
+
+	if value == "" {
+
+		data, err := os.ReadFile(layout.SigningPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read signing public key: %w", err)
+		}
+
+		value = strings.TrimSpace(string(data))
+	}
+
+	return ParsePublicKey(value)
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key.
+func ParsePublicKey(value string) (ed25519.PublicKey, error) {
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("signing public key must be a base64-encoded ed25519 public key")
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// Sign returns the base64 signature of message.
+func Sign(key ed25519.PrivateKey, message []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, message))
+}
+
+// Verify checks a base64 signature produced by Sign.
+func Verify(key ed25519.PublicKey, message []byte, signature string) error {
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return fmt.Errorf("decode signature: %w", err)
+	}
+
+	if !ed25519.Verify(key, message, sig) {
+		return errors.New("signature does not match public key")
+	}
+
+	return nil
+}
+
+func writeKey(path string, key []byte) error {
+
+	return filesystem.AtomicWriteFile(
+		path,
+		0600,
+		func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, base64.StdEncoding.EncodeToString(key))
+			return err
+		},
+	)
+}
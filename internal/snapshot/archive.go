@@ -0,0 +1,317 @@
+// internal/snapshot/archive.go
+
+package snapshot
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrChecksumMismatch is returned when an archive no longer matches the
+// checksum recorded when it was created.
+var ErrChecksumMismatch = errors.New("snapshot checksum mismatch")
+
+// VerifyChecksum recomputes the SHA-256 of archive and compares it with
+// the "<archive>.sha256" file written by Engine.Create.
+func VerifyChecksum(archive string) error {
+
+	expected, err := readChecksum(archive)
+	if err != nil {
+		return err
+	}
+
+	actual, err := fileSHA256(archive)
+	if err != nil {
+		return err
+	}
+
+	if actual != expected {
+		return fmt.Errorf(
+			"%w: expected %s, got %s",
+			ErrChecksumMismatch,
+			expected,
+			actual,
+		)
+	}
+
+	return nil
+}
+
+// readChecksum returns the SHA-256 recorded in "<archive>.sha256".
+func readChecksum(archive string) (string, error) {
+
+	data, err := os.ReadFile(archive + ".sha256")
+	if err != nil {
+		return "", fmt.Errorf("read checksum file: %w", err)
+	}
+
+	// sha256sum format: "<hex>  <filename>"
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("checksum file %s is empty", archive+".sha256")
+	}
+
+	return strings.ToLower(fields[0]), nil
+}
+
+func fileSHA256(path string) (string, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Walk streams every entry of a snapshot to fn without extracting
+// anything to disk, decrypting it first if needed. The reader passed to
+// fn is only valid until fn returns.
+func Walk(ctx context.Context, cfg *config.Config, archive string, fn func(*tar.Header, io.Reader) error) error {
+
+	stream, err := openStream(cfg, archive)
+	if err != nil {
+		return err
+	}
+
+	defer stream.Close()
+
+	reader := tar.NewReader(stream)
+
+	for {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header, err := reader.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("read archive %s: %w", filepath.Base(archive), err)
+		}
+
+		if err := fn(header, reader); err != nil {
+			return err
+		}
+	}
+}
+
+// Extract unpacks the entries of archive accepted by include into dest.
+// A nil include extracts everything. Entry names that would escape dest
+// are rejected rather than skipped, since they indicate a tampered or
+// foreign archive.
+func Extract(
+	ctx context.Context,
+	cfg *config.Config,
+	archive string,
+	dest string,
+	include func(name string) bool,
+) error {
+
+	return Walk(ctx, cfg, archive, func(header *tar.Header, r io.Reader) error {
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+
+		if include != nil && !include(name) {
+			return nil
+		}
+
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("archive entry escapes destination: %s", header.Name)
+		}
+
+		target := filepath.Join(dest, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+
+		case tar.TypeDir:
+			return makeDirectory(dest, target)
+
+		case tar.TypeReg:
+			return extractFile(dest, target, header, r)
+
+		case tar.TypeSymlink:
+
+			if filepath.IsAbs(header.Linkname) ||
+				!within(dest, filepath.Join(filepath.Dir(target), header.Linkname)) {
+				return fmt.Errorf("archive symlink points outside destination: %s", header.Name)
+			}
+
+			if err := makeDirectory(dest, filepath.Dir(target)); err != nil {
+				return err
+			}
+
+			return os.Symlink(header.Linkname, target)
+
+		default:
+			// Mirrors only contain files, directories, and the odd
+			// symlink; anything else is not needed for a restore.
+			return nil
+		}
+	})
+}
+
+func extractFile(dest string, target string, header *tar.Header, r io.Reader) error {
+
+	if err := makeDirectory(dest, filepath.Dir(target)); err != nil {
+		return err
+	}
+
+	// An earlier entry may have left a symlink at target; opening it
+	// would write wherever it points.
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("archive entry replaces a symlink: %s", header.Name)
+	}
+
+	file, err := os.OpenFile(
+		target,
+		os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
+		os.FileMode(header.Mode).Perm()|0600,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("extract %s: %w", header.Name, err)
+	}
+
+	return file.Close()
+}
+
+// within reports whether target, once cleaned, is dest or below it.
+func within(dest string, target string) bool {
+
+	rel, err := filepath.Rel(dest, target)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// makeDirectory creates dir and its parents below dest like
+// os.MkdirAll, but refuses to go through a symlink: one extracted from
+// the archive could otherwise redirect later entries outside dest.
+func makeDirectory(dest string, dir string) error {
+
+	rel, err := filepath.Rel(dest, dir)
+	if err != nil || !within(dest, dir) {
+		return fmt.Errorf("archive entry escapes destination: %s", dir)
+	}
+
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return err
+	}
+
+	if rel == "." {
+		return nil
+	}
+
+	current := dest
+
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+
+		current = filepath.Join(current, part)
+
+		info, err := os.Lstat(current)
+
+		if errors.Is(err, os.ErrNotExist) {
+
+			if err := os.Mkdir(current, 0700); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry goes through a symlink: %s", current)
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("archive entry goes through a file: %s", current)
+		}
+	}
+
+	return nil
+}
+
+// openStream returns the tar stream of a snapshot: reassembled from the
+// chunk repository for an index, otherwise decrypted if needed and
+// decompressed.
+func openStream(cfg *config.Config, archive string) (io.ReadCloser, error) {
+
+	if IsIndex(archive) {
+		return openIndex(archive)
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	var source io.Reader = bufio.NewReader(file)
+
+	if IsEncrypted(archive) {
+
+		source, err = decrypt(cfg, source)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	decoder, err := zstd.NewReader(source)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("open zstd stream: %w", err)
+	}
+
+	return &archiveStream{decoder: decoder, file: file}, nil
+}
+
+// archiveStream closes both the decoder and the file underneath it.
+type archiveStream struct {
+	decoder *zstd.Decoder
+	file    *os.File
+}
+
+func (s *archiveStream) Read(p []byte) (int, error) {
+	return s.decoder.Read(p)
+}
+
+func (s *archiveStream) Close() error {
+	s.decoder.Close()
+	return s.file.Close()
+}
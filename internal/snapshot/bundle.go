@@ -0,0 +1,392 @@
+// internal/snapshot/bundle.go
+
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/mirror"
+)
+
+// BundleSuffix is appended to a mirror's archive path for the git
+// bundle holding its changes in an incremental snapshot.
+const BundleSuffix = ".bundle"
+
+// errEmptyBundle is returned when a mirror's refs changed but every
+// object they point to is already reachable from the parent's tips
+// (a branch moved backwards, or a new branch at an existing commit).
+var errEmptyBundle = errors.New("no new objects")
+
+// incrementalParent returns the manifest an incremental snapshot should
+// build on, or nil when the next snapshot has to be full: incremental
+// mode is off, there is no usable previous snapshot, or the chain has
+// reached snapshot.full_every.
+func (e *Engine) incrementalParent(ctx context.Context) (*Manifest, error) {
+
+	if e.cfg.Snapshot.Mode != config.SnapshotModeIncremental {
+		return nil, nil
+	}
+
+	snapshots, err := List(e.cfg.Snapshot.OutputDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+
+	archive := filepath.Join(e.cfg.Snapshot.OutputDirectory, snapshots[len(snapshots)-1])
+
+	previous, err := LoadManifest(archive)
+
+	// Snapshots without a manifest don't record ref tips to diff against.
+	if errors.Is(err, ErrManifestMissing) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if previous.Depth+1 >= e.cfg.Snapshot.FullEvery {
+		return nil, nil
+	}
+
+	// Bundles are stored under the mirror root's name, and replaying
+	// them onto a tree with a different name would silently do nothing.
+	if previous.Root != filepath.Base(filepath.Clean(e.cfg.Storage.MirrorRoot)) {
+		return nil, nil
+	}
+
+	// An encrypted parent's refs are kept in the state directory when it
+	// is created; the archive is only read if they were lost, which needs
+	// the identity.
+	if previous.reduced() {
+
+		data, err := os.ReadFile(e.layout.SnapshotContentsFile)
+
+		if err != nil || decodeContents(data, previous) != nil {
+
+			if err := readContents(ctx, e.cfg, archive, previous); err != nil {
+
+				fmt.Printf("      Contents of %s unavailable, creating a full snapshot\n", previous.Snapshot)
+
+				return nil, nil
+			}
+		}
+	}
+
+	return previous, nil
+}
+
+// writeBundles writes the entries of an incremental snapshot:
+//
+//	mirrors.json
+//	contents.json
+//	<mirror_root>/<mirror>.bundle
+//	<mirror_root>/<mirror>/{HEAD,config}
+//	<mirror_root>/<mirror>/lfs/objects/<oid>
+//	<mirror_root>/releases/<owner>/<name>/<tag>/<file>
+//	<mirror_root>/gists/<id>.json
+//	<mirror_root>/metadata/<owner>/<name>/<file>.json
+//
+// with one bundle per mirror whose refs changed since parent, holding
+// only objects not reachable from the parent's tips. Unchanged mirrors
+// have no entry at all; their refs are in the contents. Mirrors the
+// parent doesn't have also get their HEAD and config. LFS objects the
+// parent doesn't list are added as they are, and release files, gist
+// metadata and exported issues and pull requests whole when their
+// SHA-256 differs from the parent's. It returns the number of bundles written.
+func (e *Engine) writeBundles(ctx context.Context, tw *tar.Writer, entry []byte, contents Contents, parent *Manifest) (int, error) {
+
+	if err := addFile(
+		tw,
+		e.layout.MirrorsStateFile,
+		filepath.Base(e.layout.MirrorsStateFile),
+	); err != nil {
+		return 0, err
+	}
+
+	if err := addContents(tw, entry); err != nil {
+		return 0, err
+	}
+
+	previous := make(map[string]map[string]string, len(parent.Mirrors))
+	previousLFS := make(map[string]map[string]struct{}, len(parent.Mirrors))
+
+	for _, m := range parent.Mirrors {
+
+		previous[m.Path] = m.Refs
+		previousLFS[m.Path] = make(map[string]struct{}, len(m.LFS))
+
+		for _, oid := range m.LFS {
+			previousLFS[m.Path][oid] = struct{}{}
+		}
+	}
+
+	scratch, err := os.MkdirTemp(e.layout.TempDir, "bundle-*")
+	if err != nil {
+		return 0, fmt.Errorf("create scratch directory: %w", err)
+	}
+
+	defer os.RemoveAll(scratch)
+
+	root := filepath.Base(filepath.Clean(e.cfg.Storage.MirrorRoot))
+
+	bundles := 0
+
+	for _, m := range contents.Mirrors {
+
+		if err := ctx.Err(); err != nil {
+			return bundles, err
+		}
+
+		// LFS objects aren't part of any bundle, and can arrive without
+		// a ref changing when an earlier fetch missed them.
+		for _, oid := range m.LFS {
+
+			if _, ok := previousLFS[m.Path][oid]; ok {
+				continue
+			}
+
+			if err := addFile(
+				tw,
+				filepath.Join(e.cfg.Storage.MirrorRoot, filepath.FromSlash(m.Path), mirror.LFSObjectPath(oid)),
+				root+"/"+m.Path+"/"+filepath.ToSlash(mirror.LFSObjectPath(oid)),
+			); err != nil {
+				return bundles, err
+			}
+		}
+
+		// A mirror new since the parent gets its HEAD and config as
+		// well, so the replayed mirror keeps its default branch and
+		// origin like one extracted from a full snapshot.
+		if _, ok := previous[m.Path]; !ok {
+
+			for _, name := range []string{"HEAD", "config"} {
+
+				if err := addFile(
+					tw,
+					filepath.Join(e.cfg.Storage.MirrorRoot, filepath.FromSlash(m.Path), name),
+					root+"/"+m.Path+"/"+name,
+				); err != nil {
+					return bundles, err
+				}
+			}
+		}
+
+		if len(m.Refs) == 0 || sameRefs(m.Refs, previous[m.Path]) {
+			continue
+		}
+
+		file := filepath.Join(scratch, "mirror.bundle")
+
+		err := createBundle(
+			ctx,
+			filepath.Join(e.cfg.Storage.MirrorRoot, filepath.FromSlash(m.Path)),
+			file,
+			m.Refs,
+			previous[m.Path],
+		)
+
+		if errors.Is(err, errEmptyBundle) {
+			continue
+		}
+
+		if err != nil {
+			return bundles, fmt.Errorf("bundle %s: %w", m.Path, err)
+		}
+
+		if err := addFile(tw, file, root+"/"+m.Path+BundleSuffix); err != nil {
+			return bundles, err
+		}
+
+		if err := os.Remove(file); err != nil {
+			return bundles, err
+		}
+
+		bundles++
+	}
+
+	if err := addChangedFiles(tw, e.cfg.Storage.MirrorRoot, root, contents.Releases, parent.Releases); err != nil {
+		return bundles, err
+	}
+
+	if err := addChangedFiles(tw, e.cfg.Storage.MirrorRoot, root, contents.Gists, parent.Gists); err != nil {
+		return bundles, err
+	}
+
+	if err := addChangedFiles(tw, e.cfg.Storage.MirrorRoot, root, contents.Metadata, parent.Metadata); err != nil {
+		return bundles, err
+	}
+
+	return bundles, nil
+}
+
+// addChangedFiles adds the files below mirrorRoot whose SHA-256 differs
+// from the one previous records for them, in name order.
+func addChangedFiles(tw *tar.Writer, mirrorRoot string, root string, files map[string]string, previous map[string]string) error {
+
+	names := make([]string, 0, len(files))
+
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		if files[name] == previous[name] {
+			continue
+		}
+
+		if err := addFile(
+			tw,
+			filepath.Join(mirrorRoot, filepath.FromSlash(name)),
+			root+"/"+name,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createBundle writes a bundle of refs to file, excluding everything
+// reachable from the previous tips that still exist in the repository.
+func createBundle(ctx context.Context, gitDir string, file string, refs map[string]string, previous map[string]string) error {
+
+	exclude, err := existingObjects(ctx, gitDir, previous)
+	if err != nil {
+		return err
+	}
+
+	var revisions strings.Builder
+
+	names := make([]string, 0, len(refs))
+
+	for ref := range refs {
+		names = append(names, ref)
+	}
+
+	sort.Strings(names)
+
+	for _, ref := range names {
+		fmt.Fprintln(&revisions, ref)
+	}
+
+	for _, oid := range exclude {
+		fmt.Fprintln(&revisions, "^"+oid)
+	}
+
+	cmd := exec.CommandContext(
+		ctx,
+		"git",
+		"-C",
+		gitDir,
+		"bundle",
+		"create",
+		file,
+		"--stdin",
+	)
+
+	cmd.Stdin = strings.NewReader(revisions.String())
+
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+
+		if bytes.Contains(output, []byte("empty bundle")) {
+			return errEmptyBundle
+		}
+
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// existingObjects returns the distinct objects among refs that exist in
+// the repository. Tips that were force-pushed away and pruned since the
+// parent snapshot can't be excluded, and are left out.
+func existingObjects(ctx context.Context, gitDir string, refs map[string]string) ([]string, error) {
+
+	seen := make(map[string]struct{}, len(refs))
+
+	var input strings.Builder
+
+	for _, oid := range refs {
+
+		if _, ok := seen[oid]; ok {
+			continue
+		}
+
+		seen[oid] = struct{}{}
+
+		fmt.Fprintln(&input, oid)
+	}
+
+	if input.Len() == 0 {
+		return nil, nil
+	}
+
+	cmd := exec.CommandContext(
+		ctx,
+		"git",
+		"-C",
+		gitDir,
+		"cat-file",
+		"--batch-check=%(objectname)",
+	)
+
+	cmd.Stdin = strings.NewReader(input.String())
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("check objects in %s: %w", gitDir, err)
+	}
+
+	var existing []string
+
+	for _, line := range strings.Split(string(output), "\n") {
+
+		// Missing objects are reported as "<oid> missing".
+		fields := strings.Fields(line)
+
+		if len(fields) == 1 {
+			existing = append(existing, fields[0])
+		}
+	}
+
+	sort.Strings(existing)
+
+	return existing, nil
+}
+
+func sameRefs(a, b map[string]string) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for ref, oid := range a {
+
+		if b[ref] != oid {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,300 @@
+// internal/snapshot/chain.go
+
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/mirror"
+)
+
+// Chain returns the snapshots needed to reconstruct archive, starting
+// with the full snapshot it is based on and ending with archive itself.
+// A full snapshot is its own chain. Parents are looked up next to
+// archive.
+func Chain(archive string) ([]string, error) {
+
+	chain := []string{archive}
+
+	current := archive
+
+	for {
+
+		manifest, err := LoadManifest(current)
+
+		// Snapshots without a manifest predate incrementals and are full.
+		if errors.Is(err, ErrManifestMissing) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !manifest.Incremental() {
+			break
+		}
+
+		parent := filepath.Join(filepath.Dir(current), manifest.Parent)
+
+		if _, err := os.Stat(parent); err != nil {
+			return nil, fmt.Errorf(
+				"%s depends on %s, which is missing: %w",
+				filepath.Base(current),
+				manifest.Parent,
+				err,
+			)
+		}
+
+		chain = append([]string{parent}, chain...)
+		current = parent
+	}
+
+	return chain, nil
+}
+
+// Parents maps every incremental snapshot in dir to the snapshot it
+// builds on, read from the manifests. Retention uses it to keep the
+// chain behind every incremental snapshot it keeps.
+func Parents(dir string, snapshots []string) map[string]string {
+
+	parents := make(map[string]string)
+
+	for _, name := range snapshots {
+
+		manifest, err := LoadManifest(filepath.Join(dir, name))
+		if err != nil || !manifest.Incremental() {
+			continue
+		}
+
+		parents[name] = manifest.Parent
+	}
+
+	return parents
+}
+
+// Materialize reconstructs the mirror tree of archive in dest: the full
+// snapshot at the root of its chain is extracted, then every incremental
+// snapshot is replayed on top by unbundling its changes and setting each
+// mirror's refs to exactly those in its contents.
+//
+// include selects archive entries as for Extract; mirrors it rejects
+// are skipped in every step.
+func Materialize(
+	ctx context.Context,
+	cfg *config.Config,
+	archive string,
+	dest string,
+	include func(name string) bool,
+) error {
+
+	chain, err := Chain(archive)
+	if err != nil {
+		return err
+	}
+
+	if err := Extract(ctx, cfg, chain[0], dest, include); err != nil {
+		return err
+	}
+
+	if len(chain) == 1 {
+		return nil
+	}
+
+	previous, err := LoadManifest(chain[0])
+	if err != nil {
+		return err
+	}
+
+	if err := readContents(ctx, cfg, chain[0], previous); err != nil {
+		return err
+	}
+
+	for _, step := range chain[1:] {
+
+		manifest, err := LoadManifest(step)
+		if err != nil {
+			return err
+		}
+
+		if err := readContents(ctx, cfg, step, manifest); err != nil {
+			return err
+		}
+
+		if err := Extract(ctx, cfg, step, dest, include); err != nil {
+			return err
+		}
+
+		if err := replay(ctx, dest, previous, manifest, include); err != nil {
+			return fmt.Errorf("replay %s: %w", filepath.Base(step), err)
+		}
+
+		previous = manifest
+	}
+
+	return nil
+}
+
+// replay applies one extracted incremental snapshot to the mirrors in
+// dest, which hold the state of its parent.
+func replay(ctx context.Context, dest string, parent *Manifest, manifest *Manifest, include func(name string) bool) error {
+
+	selected := func(relative string) bool {
+		return include == nil || include(path.Join(manifest.Root, relative))
+	}
+
+	current := make(map[string]struct{}, len(manifest.Mirrors))
+
+	for _, m := range manifest.Mirrors {
+
+		current[m.Path] = struct{}{}
+
+		if !selected(m.Path) {
+			continue
+		}
+
+		gitDir := filepath.Join(dest, manifest.Root, filepath.FromSlash(m.Path))
+		bundle := gitDir + BundleSuffix
+
+		// Mirrors added since the parent start out empty. Their HEAD,
+		// config and LFS objects are already extracted, so the directory
+		// existing doesn't mean the repository does; git init keeps
+		// those files.
+		if _, err := os.Stat(filepath.Join(gitDir, "objects")); errors.Is(err, os.ErrNotExist) {
+
+			if err := git(ctx, "", "init", "--quiet", "--bare", gitDir); err != nil {
+				return err
+			}
+		}
+
+		if _, err := os.Stat(bundle); err == nil {
+
+			if err := git(ctx, gitDir, "bundle", "unbundle", bundle); err != nil {
+				return fmt.Errorf("unbundle %s: %w", m.Path, err)
+			}
+
+			if err := os.Remove(bundle); err != nil {
+				return err
+			}
+		}
+
+		if err := setRefs(ctx, gitDir, m.Refs); err != nil {
+			return fmt.Errorf("update refs of %s: %w", m.Path, err)
+		}
+	}
+
+	// Mirrors deleted since the parent.
+	for _, m := range parent.Mirrors {
+
+		if _, ok := current[m.Path]; ok || !selected(m.Path) {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(dest, manifest.Root, filepath.FromSlash(m.Path))); err != nil {
+			return err
+		}
+	}
+
+	// Release files, gist metadata and exported issues and pull
+	// requests deleted since the parent.
+	for _, files := range [][2]map[string]string{
+		{parent.Releases, manifest.Releases},
+		{parent.Gists, manifest.Gists},
+		{parent.Metadata, manifest.Metadata},
+	} {
+
+		for name := range files[0] {
+
+			if _, ok := files[1][name]; ok || !selected(name) {
+				continue
+			}
+
+			file := filepath.Join(dest, manifest.Root, filepath.FromSlash(name))
+
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+
+			removeEmptyParents(file, filepath.Join(dest, manifest.Root))
+		}
+	}
+
+	return nil
+}
+
+// removeEmptyParents removes the directories above file up to, but not
+// including, stop for as long as they are empty.
+func removeEmptyParents(file string, stop string) {
+
+	for dir := filepath.Dir(file); dir != stop && strings.HasPrefix(dir, stop); dir = filepath.Dir(dir) {
+
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// setRefs makes the refs of gitDir exactly refs, in one transaction.
+func setRefs(ctx context.Context, gitDir string, refs map[string]string) error {
+
+	existing, err := mirror.ReadRefs(ctx, gitDir)
+	if err != nil {
+		return err
+	}
+
+	var commands []string
+
+	for ref, oid := range refs {
+
+		if existing[ref] != oid {
+			commands = append(commands, fmt.Sprintf("update %s %s", ref, oid))
+		}
+	}
+
+	for ref := range existing {
+
+		if _, ok := refs[ref]; !ok {
+			commands = append(commands, "delete "+ref)
+		}
+	}
+
+	if len(commands) == 0 {
+		return nil
+	}
+
+	sort.Strings(commands)
+
+	cmd := exec.CommandContext(ctx, "git", "-C", gitDir, "update-ref", "--stdin")
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// git runs a git command, in gitDir when set.
+func git(ctx context.Context, gitDir string, args ...string) error {
+
+	if gitDir != "" {
+		args = append([]string{"-C", gitDir}, args...)
+	}
+
+	output, err := exec.CommandContext(ctx, "git", args...).CombinedOutput()
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+// internal/snapshot/chain_test.go
+
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flarexes/gitback/internal/state"
+)
+
+func TestMaterializeReplaysAddedMirrorsAndDeletedFiles(t *testing.T) {
+
+	dir := t.TempDir()
+
+	engine, cfg := newTestEngine(t, dir)
+
+	work := filepath.Join(dir, "work")
+
+	testGit(t, "init", "-q", work)
+	testGit(t, "-C", work, "commit", "-q", "--allow-empty", "-m", "first")
+	testGit(t, "-C", work, "branch", "-m", "develop")
+
+	testGit(t, "clone", "-q", "--mirror", work, filepath.Join(cfg.Storage.MirrorRoot, "repositories", "octocat", "hello.git"))
+
+	// One release file, recorded the way a sync records it.
+	release := "releases/octocat/hello/v1/hello.tar.gz"
+
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(cfg.Storage.MirrorRoot, release)), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(cfg.Storage.MirrorRoot, release), []byte("release"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := fileSHA256(filepath.Join(cfg.Storage.MirrorRoot, release))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveState := func(data state.MirrorState) {
+
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(engine.layout.MirrorsStateFile, encoded, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saveState(state.MirrorState{
+		Releases: []state.Asset{{Name: release, LastSuccess: true, Fingerprint: sum}},
+	})
+
+	ctx := context.Background()
+
+	if err := engine.Create(ctx, false, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshot names have a resolution of one second.
+	time.Sleep(time.Second)
+
+	// The release is deleted and a repository added before the next,
+	// incremental snapshot.
+	if err := os.RemoveAll(filepath.Join(cfg.Storage.MirrorRoot, "releases")); err != nil {
+		t.Fatal(err)
+	}
+
+	saveState(state.MirrorState{})
+
+	testGit(t, "clone", "-q", "--mirror", work, filepath.Join(cfg.Storage.MirrorRoot, "repositories", "octocat", "added.git"))
+
+	if err := engine.Create(ctx, false, true); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := List(cfg.Snapshot.OutputDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest := filepath.Join(cfg.Snapshot.OutputDirectory, snapshots[len(snapshots)-1])
+
+	if manifest, err := LoadManifest(latest); err != nil || !manifest.Incremental() {
+		t.Fatalf("latest snapshot is not incremental: %v", err)
+	}
+
+	dest := filepath.Join(dir, "restore")
+
+	if err := Materialize(ctx, cfg, latest, dest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "mirrors", "releases")); !os.IsNotExist(err) {
+		t.Fatalf("deleted release files still restored: %v", err)
+	}
+
+	added := filepath.Join(dest, "mirrors", "repositories", "octocat", "added.git")
+
+	if got := testGit(t, "-C", added, "config", "remote.origin.url"); got != work {
+		t.Fatalf("added mirror has origin %q, want %q", got, work)
+	}
+
+	if got := testGit(t, "-C", added, "symbolic-ref", "HEAD"); got != "refs/heads/develop" {
+		t.Fatalf("added mirror has HEAD %s, want refs/heads/develop", got)
+	}
+
+	testGit(t, "-C", added, "fsck", "--no-progress")
+}
@@ -0,0 +1,384 @@
+// internal/snapshot/diff.go
+
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// Ref changes reported by DiffSnapshots.
+const (
+	RefCreated     = "created"
+	RefDeleted     = "deleted"
+	RefFastForward = "fast-forward"
+	RefForced      = "force-update"
+
+	// RefChanged is an update whose history is no longer in the live
+	// mirror, so it can't be told apart.
+	RefChanged = "changed"
+)
+
+// Diff describes what changed between two snapshots.
+type Diff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	Added   []DiffAsset `json:"added"`
+	Removed []DiffAsset `json:"removed"`
+
+	// Mirrors lists ref changes of mirrors present in both snapshots.
+	Mirrors []MirrorDiff `json:"mirrors"`
+}
+
+// DiffAsset is a repository, wiki, gist, or starred repository added or
+// removed between two snapshots.
+type DiffAsset struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// MirrorDiff lists the ref changes of one mirror.
+type MirrorDiff struct {
+	Path string      `json:"path"`
+	Refs []RefChange `json:"refs"`
+}
+
+// RefChange is a single ref that differs between two snapshots. Commit
+// counts are nil when the objects involved are no longer in the live
+// mirror.
+type RefChange struct {
+	Ref    string `json:"ref"`
+	Change string `json:"change"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+
+	// AddedCommits are reachable from New but not Old; RemovedCommits
+	// are reachable from Old but not New.
+	AddedCommits   *int `json:"added_commits,omitempty"`
+	RemovedCommits *int `json:"removed_commits,omitempty"`
+}
+
+// DiffSnapshots compares snapshot from with snapshot to. Assets come from
+// the embedded mirror state, refs from the manifests, so neither snapshot
+// is extracted. Commit counts are computed in the live mirrors, which
+// still hold the objects of both snapshots unless history was rewritten
+// and pruned since.
+func DiffSnapshots(ctx context.Context, cfg *config.Config, from string, to string) (*Diff, error) {
+
+	diff := &Diff{
+		From:    filepath.Base(from),
+		To:      filepath.Base(to),
+		Mirrors: []MirrorDiff{},
+	}
+
+	var states [2]*state.MirrorState
+	var manifests [2]*Manifest
+
+	for i, archive := range []string{from, to} {
+
+		data, err := ReadMirrorState(ctx, cfg, archive)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest, err := LoadManifest(archive)
+
+		if errors.Is(err, ErrManifestMissing) {
+			return nil, fmt.Errorf("%s has no manifest, so its refs were not recorded", filepath.Base(archive))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := readContents(ctx, cfg, archive, manifest); err != nil {
+			return nil, err
+		}
+
+		states[i] = data
+		manifests[i] = manifest
+	}
+
+	diff.Added, diff.Removed = diffAssets(states[0], states[1])
+
+	previous := make(map[string]map[string]string, len(manifests[0].Mirrors))
+
+	for _, m := range manifests[0].Mirrors {
+		previous[m.Path] = m.Refs
+	}
+
+	for _, m := range manifests[1].Mirrors {
+
+		old, ok := previous[m.Path]
+
+		if !ok || sameRefs(old, m.Refs) {
+			continue
+		}
+
+		refs, err := diffRefs(
+			ctx,
+			filepath.Join(cfg.Storage.MirrorRoot, filepath.FromSlash(m.Path)),
+			old,
+			m.Refs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("diff %s: %w", m.Path, err)
+		}
+
+		diff.Mirrors = append(diff.Mirrors, MirrorDiff{
+			Path: m.Path,
+			Refs: refs,
+		})
+	}
+
+	sort.Slice(diff.Mirrors, func(i, j int) bool {
+		return diff.Mirrors[i].Path < diff.Mirrors[j].Path
+	})
+
+	return diff, nil
+}
+
+func diffAssets(from *state.MirrorState, to *state.MirrorState) ([]DiffAsset, []DiffAsset) {
+
+	added := []DiffAsset{}
+	removed := []DiffAsset{}
+
+	compare := func(kind string, before []state.Asset, after []state.Asset) {
+
+		names := func(assets []state.Asset) map[string]struct{} {
+
+			set := make(map[string]struct{}, len(assets))
+
+			for _, asset := range assets {
+				set[asset.Name] = struct{}{}
+			}
+
+			return set
+		}
+
+		beforeNames := names(before)
+		afterNames := names(after)
+
+		for name := range afterNames {
+			if _, ok := beforeNames[name]; !ok {
+				added = append(added, DiffAsset{Kind: kind, Name: name})
+			}
+		}
+
+		for name := range beforeNames {
+			if _, ok := afterNames[name]; !ok {
+				removed = append(removed, DiffAsset{Kind: kind, Name: name})
+			}
+		}
+	}
+
+	compare("repository", from.Repositories, to.Repositories)
+	compare("wiki", from.Wikis, to.Wikis)
+	compare("gist", from.Gists, to.Gists)
+	compare("starred", from.Starred, to.Starred)
+
+	for _, assets := range [][]DiffAsset{added, removed} {
+
+		sort.Slice(assets, func(i, j int) bool {
+
+			if assets[i].Kind != assets[j].Kind {
+				return assets[i].Kind < assets[j].Kind
+			}
+
+			return assets[i].Name < assets[j].Name
+		})
+	}
+
+	return added, removed
+}
+
+// diffRefs classifies every ref that differs between old and new, using
+// the mirror at gitDir for history.
+func diffRefs(ctx context.Context, gitDir string, old map[string]string, new map[string]string) ([]RefChange, error) {
+
+	// Objects are looked up once; a missing mirror has none.
+	tips := make(map[string]string, len(old)+len(new))
+
+	for ref, oid := range old {
+		tips["old "+ref] = oid
+	}
+
+	for ref, oid := range new {
+		tips["new "+ref] = oid
+	}
+
+	available := make(map[string]bool)
+
+	if _, err := os.Stat(gitDir); err == nil {
+
+		existing, err := existingObjects(ctx, gitDir, tips)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, oid := range existing {
+			available[oid] = true
+		}
+	}
+
+	// Commits a created ref brings, or a deleted ref loses, are counted
+	// against every tip on the other side.
+	oldTips := availableTips(old, available)
+	newTips := availableTips(new, available)
+
+	var changes []RefChange
+
+	for ref, oid := range new {
+
+		previous, ok := old[ref]
+
+		switch {
+
+		case !ok:
+
+			change := RefChange{Ref: ref, Change: RefCreated, New: oid}
+
+			if available[oid] {
+
+				count, err := countCommits(ctx, gitDir, []string{oid}, oldTips)
+				if err != nil {
+					return nil, err
+				}
+
+				change.AddedCommits = &count
+			}
+
+			changes = append(changes, change)
+
+		case previous != oid:
+
+			change, err := classifyUpdate(ctx, gitDir, ref, previous, oid, available)
+			if err != nil {
+				return nil, err
+			}
+
+			changes = append(changes, change)
+		}
+	}
+
+	for ref, oid := range old {
+
+		if _, ok := new[ref]; ok {
+			continue
+		}
+
+		change := RefChange{Ref: ref, Change: RefDeleted, Old: oid}
+
+		if available[oid] {
+
+			count, err := countCommits(ctx, gitDir, []string{oid}, newTips)
+			if err != nil {
+				return nil, err
+			}
+
+			change.RemovedCommits = &count
+		}
+
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Ref < changes[j].Ref
+	})
+
+	return changes, nil
+}
+
+func classifyUpdate(ctx context.Context, gitDir string, ref string, old string, new string, available map[string]bool) (RefChange, error) {
+
+	change := RefChange{Ref: ref, Change: RefChanged, Old: old, New: new}
+
+	if !available[old] || !available[new] {
+		return change, nil
+	}
+
+	added, err := countCommits(ctx, gitDir, []string{new}, []string{old})
+	if err != nil {
+		return change, err
+	}
+
+	removed, err := countCommits(ctx, gitDir, []string{old}, []string{new})
+	if err != nil {
+		return change, err
+	}
+
+	change.Change = RefFastForward
+
+	if removed > 0 {
+		change.Change = RefForced
+		change.RemovedCommits = &removed
+	}
+
+	change.AddedCommits = &added
+
+	return change, nil
+}
+
+func availableTips(refs map[string]string, available map[string]bool) []string {
+
+	var tips []string
+
+	for _, oid := range refs {
+		if available[oid] {
+			tips = append(tips, oid)
+		}
+	}
+
+	sort.Strings(tips)
+
+	return tips
+}
+
+// countCommits counts commits reachable from include but from none of
+// exclude. Revisions are passed on stdin, so any number of refs fits.
+func countCommits(ctx context.Context, gitDir string, include []string, exclude []string) (int, error) {
+
+	var revisions strings.Builder
+
+	for _, oid := range include {
+		fmt.Fprintln(&revisions, oid)
+	}
+
+	for _, oid := range exclude {
+		fmt.Fprintln(&revisions, "^"+oid)
+	}
+
+	cmd := exec.CommandContext(
+		ctx,
+		"git",
+		"-C",
+		gitDir,
+		"rev-list",
+		"--count",
+		"--stdin",
+	)
+
+	cmd.Stdin = strings.NewReader(revisions.String())
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("count commits: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
@@ -0,0 +1,166 @@
+// internal/snapshot/encryption.go
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/flarexes/gitback/internal/config"
+)
+
+// EncryptedExtension is the file suffix of age-encrypted snapshots.
+const EncryptedExtension = Extension + ".age"
+
+// IsArchive reports whether name is a snapshot: an archive, encrypted
+// or not, or an index in the chunk repository.
+func IsArchive(name string) bool {
+	return strings.HasSuffix(name, Extension) ||
+		strings.HasSuffix(name, EncryptedExtension) ||
+		IsIndex(name)
+}
+
+// IsEncrypted reports whether name is an age-encrypted snapshot.
+func IsEncrypted(name string) bool {
+	return strings.HasSuffix(name, EncryptedExtension)
+}
+
+// Name strips the archive extension from a snapshot file name, leaving
+// the creation timestamp.
+func Name(file string) string {
+
+	if IsEncrypted(file) {
+		return strings.TrimSuffix(file, EncryptedExtension)
+	}
+
+	if IsIndex(file) {
+		return strings.TrimSuffix(file, IndexExtension)
+	}
+
+	return strings.TrimSuffix(file, Extension)
+}
+
+// extension returns the suffix for new snapshots under cfg.
+func extension(cfg *config.Config) string {
+
+	if cfg.Snapshot.Backend == config.SnapshotBackendRepository {
+		return IndexExtension
+	}
+
+	if cfg.Snapshot.Encryption.Enabled() {
+		return EncryptedExtension
+	}
+
+	return Extension
+}
+
+// encrypt wraps w so everything written is age-encrypted to the
+// configured recipients or passphrase. The returned writer must be
+// closed to flush the final chunk.
+func encrypt(cfg *config.Config, w io.Writer) (io.WriteCloser, error) {
+
+	enc := cfg.Snapshot.Encryption
+
+	var recipients []age.Recipient
+
+	if enc.PassphraseFile != "" {
+
+		passphrase, err := readPassphrase(enc.PassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+
+		recipient, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	for _, value := range enc.Recipients {
+
+		recipient, err := age.ParseX25519Recipient(value)
+		if err != nil {
+			return nil, fmt.Errorf("parse age recipient: %w", err)
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	return age.Encrypt(w, recipients...)
+}
+
+// decrypt returns a reader over the plaintext of an encrypted snapshot,
+// using the configured identity file and/or passphrase.
+func decrypt(cfg *config.Config, r io.Reader) (io.Reader, error) {
+
+	enc := cfg.Snapshot.Encryption
+
+	var identities []age.Identity
+
+	if enc.IdentityFile != "" {
+
+		file, err := os.Open(enc.IdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("open age identity file: %w", err)
+		}
+
+		defer file.Close()
+
+		parsed, err := age.ParseIdentities(file)
+		if err != nil {
+			return nil, fmt.Errorf("parse age identity file: %w", err)
+		}
+
+		identities = append(identities, parsed...)
+	}
+
+	if enc.PassphraseFile != "" {
+
+		passphrase, err := readPassphrase(enc.PassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, identity)
+	}
+
+	if len(identities) == 0 {
+		return nil, errors.New(
+			"snapshot is encrypted; set snapshot.encryption.identity_file or snapshot.encryption.passphrase_file",
+		)
+	}
+
+	plaintext, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt snapshot: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+func readPassphrase(path string) (string, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase file: %w", err)
+	}
+
+	passphrase := strings.TrimRight(string(data), "\r\n")
+
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase file %s is empty", path)
+	}
+
+	return passphrase, nil
+}
@@ -0,0 +1,172 @@
+// internal/snapshot/info.go
+
+package snapshot
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// Checksum states reported by Describe. ChecksumPresent means the
+// checksum file exists and agrees with the manifest, but the archive
+// itself wasn't hashed.
+const (
+	ChecksumOK       = "ok"
+	ChecksumPresent  = "present"
+	ChecksumMismatch = "mismatch"
+	ChecksumMissing  = "missing"
+)
+
+// Info describes a snapshot as found on disk, without reading its
+// contents.
+type Info struct {
+	Name string `json:"name"`
+
+	// CreatedAt is parsed from the name, empty when it carries no
+	// timestamp.
+	CreatedAt string `json:"created_at,omitempty"`
+
+	// Size is the size of the snapshot file; for repository snapshots
+	// that is the index, not the chunks it refers to.
+	Size int64 `json:"size"`
+
+	Checksum string `json:"checksum"`
+
+	Encrypted   bool   `json:"encrypted"`
+	Incremental bool   `json:"incremental"`
+	Parent      string `json:"parent,omitempty"`
+	Repository  bool   `json:"repository"`
+	Signed      bool   `json:"signed"`
+}
+
+// Describe returns Info for every snapshot in dir, oldest first, in the
+// same filename-timestamp order List and retention use. Checksums are
+// only recomputed with verify, which reads each archive once.
+func Describe(dir string, verify bool) ([]Info, error) {
+
+	names, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]Info, 0, len(names))
+
+	for _, name := range names {
+
+		archive := filepath.Join(dir, name)
+
+		info := Info{
+			Name:       name,
+			Encrypted:  IsEncrypted(name),
+			Repository: IsIndex(name),
+		}
+
+		if createdAt, err := Timestamp(name); err == nil {
+			info.CreatedAt = createdAt.Format(time.RFC3339)
+		}
+
+		stat, err := os.Stat(archive)
+		if err != nil {
+			// removed since List read the directory
+			continue
+		}
+
+		info.Size = stat.Size()
+
+		// A missing or unreadable manifest only leaves the flags unset.
+		manifest, _ := LoadManifest(archive)
+
+		info.Checksum = checksumStatus(archive, stat.Size(), manifest, verify)
+
+		if manifest != nil {
+
+			info.Incremental = manifest.Incremental()
+			info.Parent = manifest.Parent
+
+			_, err := os.Stat(archive + SignatureSuffix)
+			info.Signed = err == nil
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// checksumStatus reports the checksum state of archive. Without verify
+// only the checksum file is read, and checked against the size and
+// checksum manifest records, when there is one.
+func checksumStatus(archive string, size int64, manifest *Manifest, verify bool) string {
+
+	if verify {
+
+		switch err := VerifyChecksum(archive); {
+		case err == nil:
+			return ChecksumOK
+		case errors.Is(err, ErrChecksumMismatch):
+			return ChecksumMismatch
+		default:
+			return ChecksumMissing
+		}
+	}
+
+	recorded, err := readChecksum(archive)
+	if err != nil {
+		return ChecksumMissing
+	}
+
+	if manifest != nil && (manifest.Size != size || !strings.EqualFold(manifest.SHA256, recorded)) {
+		return ChecksumMismatch
+	}
+
+	return ChecksumPresent
+}
+
+// errStopWalk ends a Walk early once the wanted entry has been read.
+var errStopWalk = errors.New("stop walk")
+
+// ReadMirrorState returns the mirror state embedded in a snapshot. It is
+// the first entry of every snapshot, so only the start of the stream is
+// read.
+func ReadMirrorState(ctx context.Context, cfg *config.Config, archive string) (*state.MirrorState, error) {
+
+	var data *state.MirrorState
+
+	err := Walk(ctx, cfg, archive, func(header *tar.Header, r io.Reader) error {
+
+		if header.Name != "mirrors.json" {
+			return nil
+		}
+
+		var decoded state.MirrorState
+
+		if err := json.NewDecoder(r).Decode(&decoded); err != nil {
+			return fmt.Errorf("parse embedded mirror state: %w", err)
+		}
+
+		data = &decoded
+
+		return errStopWalk
+	})
+
+	if err != nil && !errors.Is(err, errStopWalk) {
+		return nil, err
+	}
+
+	if data == nil {
+		return nil, fmt.Errorf("%s has no embedded mirror state", filepath.Base(archive))
+	}
+
+	return data, nil
+}
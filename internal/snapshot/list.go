@@ -0,0 +1,93 @@
+// internal/snapshot/list.go
+
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+)
+
+// Extension is the file suffix of unencrypted snapshot archives.
+const Extension = ".tar.zst"
+
+// TimestampLayout is the time format of snapshot names, always UTC.
+const TimestampLayout = "2006-01-02T15-04-05Z"
+
+// Timestamp parses the creation time encoded in a snapshot filename.
+func Timestamp(file string) (time.Time, error) {
+	return time.Parse(TimestampLayout, Name(filepath.Base(file)))
+}
+
+// List returns the snapshot names in dir, archives and repository
+// indexes alike, oldest first.
+//
+// Snapshot filenames use timestamps, so lexical ordering matches
+// chronological ordering.
+func List(dir string) ([]string, error) {
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []string
+
+	for _, entry := range entries {
+
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+
+		if !IsArchive(name) {
+			continue
+		}
+
+		snapshots = append(
+			snapshots,
+			name,
+		)
+	}
+
+	sort.Strings(snapshots)
+
+	return snapshots, nil
+}
+
+// Resolve accepts either a path to a snapshot or a bare snapshot name
+// from the configured output directory, with or without extension, and
+// returns the archive path.
+func Resolve(cfg *config.Config, name string) (string, error) {
+
+	candidates := []string{name}
+
+	if !strings.ContainsRune(name, os.PathSeparator) {
+
+		candidates = append(
+			candidates,
+			filepath.Join(cfg.Snapshot.OutputDirectory, name),
+			filepath.Join(cfg.Snapshot.OutputDirectory, name+Extension),
+			filepath.Join(cfg.Snapshot.OutputDirectory, name+EncryptedExtension),
+			filepath.Join(cfg.Snapshot.OutputDirectory, name+IndexExtension),
+		)
+	}
+
+	for _, candidate := range candidates {
+
+		info, err := os.Stat(candidate)
+
+		if err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("snapshot not found: %s", name)
+}
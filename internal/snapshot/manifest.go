@@ -0,0 +1,547 @@
+// internal/snapshot/manifest.go
+
+package snapshot
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/filesystem"
+	"github.com/flarexes/gitback/internal/mirror"
+	"github.com/flarexes/gitback/internal/signing"
+	"github.com/flarexes/gitback/internal/state"
+	"github.com/flarexes/gitback/internal/version"
+)
+
+const (
+	// ManifestSuffix and SignatureSuffix are appended to the archive
+	// name for the manifest and its detached signature.
+	ManifestSuffix  = ".manifest.json"
+	SignatureSuffix = ".manifest.sig"
+
+	// ContentsEntry is the archive entry holding the snapshot's
+	// Contents, right after the embedded mirror state.
+	ContentsEntry = "contents.json"
+
+	manifestVersion = 3
+
+	// KindFull snapshots contain complete mirrors. KindIncremental
+	// snapshots contain git bundles relative to their parent.
+	KindFull        = "full"
+	KindIncremental = "incremental"
+)
+
+// ErrManifestMissing is returned for snapshots created before manifests
+// were introduced, or whose manifest was removed.
+var ErrManifestMissing = errors.New("snapshot manifest not found")
+
+// Manifest describes a snapshot archive and where it came from. It is
+// signed so that replacing both the archive and its .sha256 file is
+// detectable by anyone holding the public key.
+//
+// The manifest of an encrypted snapshot is reduced to digests: its
+// Contents, which name every mirror, release and exported file, stay
+// inside the archive and are only bound by ContentsSHA256. Use
+// readContents to fill them in.
+type Manifest struct {
+	Version   int    `json:"version"`
+	Snapshot  string `json:"snapshot"`
+	CreatedAt string `json:"created_at"`
+
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	Encrypted bool   `json:"encrypted"`
+
+	GitbackVersion string `json:"gitback_version"`
+	RunID          string `json:"run_id"`
+
+	// Kind is KindFull or KindIncremental; manifests written before
+	// incremental snapshots existed leave it empty and are full.
+	// Parent names the snapshot an incremental builds on, and Depth
+	// counts incrementals since the last full snapshot.
+	Kind   string `json:"kind,omitempty"`
+	Parent string `json:"parent,omitempty"`
+	Depth  int    `json:"depth,omitempty"`
+
+	// Root is the base name of the mirror root inside the archive.
+	Root string `json:"root,omitempty"`
+
+	// Fingerprint is the combined mirror fingerprint recorded by the
+	// sync this snapshot captured, including the metadata export when
+	// enabled; see state.MirrorState.Fingerprint.
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// ContentsSHA256 is the SHA-256 of the ContentsEntry in the archive.
+	ContentsSHA256 string `json:"contents_sha256,omitempty"`
+
+	Contents
+}
+
+// Contents records what a snapshot holds. It is stored in the archive
+// as ContentsEntry and, unless the snapshot is encrypted, in the
+// manifest as well.
+type Contents struct {
+	Mirrors []MirrorRefs `json:"mirrors,omitempty"`
+
+	// Releases maps the release files the captured sync downloaded,
+	// by path relative to the mirror root, to their SHA-256. Incremental
+	// snapshots carry only those that changed since their parent.
+	Releases map[string]string `json:"releases,omitempty"`
+
+	// Gists maps the gist metadata files the captured sync recorded to
+	// their SHA-256, the same way.
+	Gists map[string]string `json:"gists,omitempty"`
+
+	// Metadata maps the exported issue and pull request files below
+	// metadata/ to their SHA-256, the same way.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Incremental reports whether the snapshot depends on a parent.
+func (m *Manifest) Incremental() bool {
+	return m.Kind == KindIncremental
+}
+
+// reduced reports whether the manifest leaves its Contents to the
+// archive.
+func (m *Manifest) reduced() bool {
+	return m.Encrypted && m.ContentsSHA256 != ""
+}
+
+// MirrorRefs records the ref tips of a single mirror at snapshot time,
+// keyed by its path relative to the mirror root.
+type MirrorRefs struct {
+	Path string            `json:"path"`
+	Refs map[string]string `json:"refs"`
+
+	// LFS lists the IDs of the Git LFS objects stored in the mirror.
+	LFS []string `json:"lfs,omitempty"`
+}
+
+// collectRefs reads the ref tips and LFS objects of every mirror being
+// archived. The sync lock is held for the whole snapshot, so these match
+// the archive.
+func (e *Engine) collectRefs(ctx context.Context) ([]MirrorRefs, error) {
+
+	paths, err := mirror.Find(e.cfg.Storage.MirrorRoot)
+	if err != nil {
+		return nil, fmt.Errorf("list mirrors: %w", err)
+	}
+
+	mirrors := make([]MirrorRefs, 0, len(paths))
+
+	for _, relative := range paths {
+
+		refs, err := mirror.ReadRefs(
+			ctx,
+			filepath.Join(e.cfg.Storage.MirrorRoot, relative),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		lfs, err := mirror.LFSObjects(
+			filepath.Join(e.cfg.Storage.MirrorRoot, relative),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		mirrors = append(mirrors, MirrorRefs{
+			Path: filepath.ToSlash(relative),
+			Refs: refs,
+			LFS:  lfs,
+		})
+	}
+
+	return mirrors, nil
+}
+
+// collectReleases reads the release files the last sync downloaded and
+// their SHA-256 from the mirror state, and hashes those archived with
+// removed repositories, which sync no longer records.
+func (e *Engine) collectReleases() (map[string]string, error) {
+
+	data, err := state.LoadMirrors(e.layout.MirrorsStateFile)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return e.hashFiles(nil, filepath.Join(mirror.ArchiveDirectory, "releases"))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var files map[string]string
+
+	for _, asset := range data.Releases {
+
+		if !asset.LastSuccess || asset.Fingerprint == "" {
+			continue
+		}
+
+		if files == nil {
+			files = make(map[string]string)
+		}
+
+		files[asset.Name] = asset.Fingerprint
+	}
+
+	return e.hashFiles(files, filepath.Join(mirror.ArchiveDirectory, "releases"))
+}
+
+// collectGistMetadata reads the gist metadata files the last sync
+// recorded and their SHA-256 from the mirror state.
+func (e *Engine) collectGistMetadata() (map[string]string, error) {
+
+	data, err := state.LoadMirrors(e.layout.MirrorsStateFile)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var files map[string]string
+
+	for _, asset := range data.Gists {
+
+		if asset.Metadata == "" {
+			continue
+		}
+
+		if files == nil {
+			files = make(map[string]string)
+		}
+
+		files[mirror.GistMetadataPath(asset.Name)] = asset.Metadata
+	}
+
+	return files, nil
+}
+
+// collectMetadata hashes the issue and pull request files exported
+// below the mirror root's metadata directory, and those archived with
+// removed repositories. The export state only fingerprints whole
+// repositories, so the files are read from disk.
+func (e *Engine) collectMetadata() (map[string]string, error) {
+
+	if !e.cfg.GitHub.BackupMetadata {
+		return nil, nil
+	}
+
+	files, err := e.hashFiles(nil, "metadata")
+	if err != nil {
+		return nil, err
+	}
+
+	return e.hashFiles(files, filepath.Join(mirror.ArchiveDirectory, "metadata"))
+}
+
+// hashFiles adds the SHA-256 of every file below dir, relative to the
+// mirror root, to files. A missing dir adds nothing.
+func (e *Engine) hashFiles(files map[string]string, dir string) (map[string]string, error) {
+
+	root := filepath.Join(e.cfg.Storage.MirrorRoot, dir)
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+
+		if errors.Is(err, fs.ErrNotExist) && path == root {
+			return filepath.SkipDir
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(e.cfg.Storage.MirrorRoot, path)
+		if err != nil {
+			return err
+		}
+
+		if files == nil {
+			files = make(map[string]string)
+		}
+
+		files[filepath.ToSlash(relative)] = sum
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("hash %s files: %w", dir, err)
+	}
+
+	return files, nil
+}
+
+// encodeContents returns the ContentsEntry of a snapshot.
+func encodeContents(contents Contents) ([]byte, error) {
+	return json.MarshalIndent(contents, "", "  ")
+}
+
+// addContents writes the ContentsEntry to the tar stream.
+func addContents(tw *tar.Writer, data []byte) error {
+
+	header := &tar.Header{
+		Name:    ContentsEntry,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("archive %s: %w", ContentsEntry, err)
+	}
+
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("archive %s: %w", ContentsEntry, err)
+	}
+
+	return nil
+}
+
+// writeManifest writes and signs the manifest for a finished archive.
+// entry is the archive's ContentsEntry, encoding contents. parent is
+// the manifest of the snapshot an incremental archive builds on, or nil
+// for a full snapshot.
+//
+// The manifest of an encrypted archive leaves out its contents, which
+// would otherwise reach every offsite target in plaintext. They are
+// kept in the state directory instead, so the next incremental snapshot
+// can build on this one without the identity.
+func (e *Engine) writeManifest(archive string, sum string, size int64, contents Contents, entry []byte, parent *Manifest) error {
+
+	key, err := signing.LoadOrCreate(e.layout)
+	if err != nil {
+		return err
+	}
+
+	contentsSum := sha256.Sum256(entry)
+
+	manifest := Manifest{
+		Version:   manifestVersion,
+		Snapshot:  filepath.Base(archive),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+
+		Size:      size,
+		SHA256:    sum,
+		Encrypted: IsEncrypted(archive),
+
+		GitbackVersion: version.Get(),
+		RunID:          e.logger.RunID(),
+
+		Kind: KindFull,
+		Root: filepath.Base(filepath.Clean(e.cfg.Storage.MirrorRoot)),
+
+		Fingerprint: e.fingerprint(),
+
+		ContentsSHA256: hex.EncodeToString(contentsSum[:]),
+	}
+
+	if manifest.Encrypted {
+
+		if err := filesystem.AtomicWriteFile(
+			e.layout.SnapshotContentsFile,
+			0600,
+			func(w io.Writer) error {
+				_, err := w.Write(entry)
+				return err
+			},
+		); err != nil {
+			return fmt.Errorf("save snapshot contents: %w", err)
+		}
+
+	} else {
+		manifest.Contents = contents
+	}
+
+	if parent != nil {
+		manifest.Kind = KindIncremental
+		manifest.Parent = parent.Snapshot
+		manifest.Depth = parent.Depth + 1
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(archive+ManifestSuffix, data, 0600); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	signature := signing.Sign(key, data) + "\n"
+
+	if err := os.WriteFile(archive+SignatureSuffix, []byte(signature), 0600); err != nil {
+		return fmt.Errorf("write manifest signature: %w", err)
+	}
+
+	return nil
+}
+
+// LoadManifest reads a snapshot's manifest without checking its
+// signature.
+func LoadManifest(archive string) (*Manifest, error) {
+
+	data, err := os.ReadFile(archive + ManifestSuffix)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrManifestMissing
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+// VerifyManifest checks the manifest signature against key, then checks
+// that the manifest describes this archive and agrees with its checksum
+// file. Callers should run VerifyChecksum as well, which ties the
+// checksum file to the archive contents.
+func VerifyManifest(archive string, key ed25519.PublicKey) (*Manifest, error) {
+
+	data, err := os.ReadFile(archive + ManifestSuffix)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrManifestMissing
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := os.ReadFile(archive + SignatureSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest signature: %w", err)
+	}
+
+	if err := signing.Verify(key, data, string(signature)); err != nil {
+		return nil, fmt.Errorf("manifest signature invalid: %w", err)
+	}
+
+	var manifest Manifest
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+
+	if manifest.Snapshot != filepath.Base(archive) {
+		return nil, fmt.Errorf(
+			"manifest describes %s, not %s",
+			manifest.Snapshot,
+			filepath.Base(archive),
+		)
+	}
+
+	info, err := os.Stat(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() != manifest.Size {
+		return nil, fmt.Errorf(
+			"archive size %d does not match signed size %d",
+			info.Size(),
+			manifest.Size,
+		)
+	}
+
+	checksum, err := os.ReadFile(archive + ".sha256")
+	if err != nil {
+		return nil, fmt.Errorf("read checksum file: %w", err)
+	}
+
+	fields := strings.Fields(string(checksum))
+
+	if len(fields) == 0 || !strings.EqualFold(fields[0], manifest.SHA256) {
+		return nil, errors.New("checksum file does not match signed checksum")
+	}
+
+	return &manifest, nil
+}
+
+// readContents fills in the Contents of a reduced manifest from the
+// archive's ContentsEntry, which has to match the digest the manifest
+// records. Other manifests already hold their contents.
+func readContents(ctx context.Context, cfg *config.Config, archive string, manifest *Manifest) error {
+
+	if !manifest.reduced() {
+		return nil
+	}
+
+	var data []byte
+
+	err := Walk(ctx, cfg, archive, func(header *tar.Header, r io.Reader) error {
+
+		if header.Name != ContentsEntry {
+			return nil
+		}
+
+		var err error
+
+		if data, err = io.ReadAll(r); err != nil {
+			return err
+		}
+
+		return errStopWalk
+	})
+
+	if err != nil && !errors.Is(err, errStopWalk) {
+		return err
+	}
+
+	if data == nil {
+		return fmt.Errorf("%s has no %s", filepath.Base(archive), ContentsEntry)
+	}
+
+	return decodeContents(data, manifest)
+}
+
+// decodeContents sets the Contents of manifest from data, a copy of
+// its ContentsEntry.
+func decodeContents(data []byte, manifest *Manifest) error {
+
+	sum := sha256.Sum256(data)
+
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), manifest.ContentsSHA256) {
+		return fmt.Errorf("%s does not match the manifest of %s", ContentsEntry, manifest.Snapshot)
+	}
+
+	if err := json.Unmarshal(data, &manifest.Contents); err != nil {
+		return fmt.Errorf("parse %s: %w", ContentsEntry, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+// internal/snapshot/manifest_test.go
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/runtime"
+)
+
+// testGit runs a git command for a test and returns its trimmed output.
+func testGit(t *testing.T, args ...string) string {
+
+	t.Helper()
+
+	cmd := exec.Command(
+		"git",
+		append([]string{"-c", "user.name=GitBack", "-c", "user.email=gitback@example.com", "-c", "init.defaultBranch=main"}, args...)...,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+// newTestEngine returns a snapshot engine in incremental mode writing
+// below dir, with an empty mirror state.
+func newTestEngine(t *testing.T, dir string) (*Engine, *config.Config) {
+
+	t.Helper()
+
+	layout := runtime.NewWithRoot(filepath.Join(dir, "home"))
+
+	if err := layout.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := logging.New(layout.LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { logger.Close() })
+
+	cfg := config.Default(layout)
+	cfg.Storage.MirrorRoot = filepath.Join(dir, "mirrors")
+	cfg.Snapshot.OutputDirectory = filepath.Join(dir, "snapshots")
+	cfg.Snapshot.Mode = config.SnapshotModeIncremental
+
+	if err := os.MkdirAll(cfg.Snapshot.OutputDirectory, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(layout.MirrorsStateFile, []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return New(&cfg, layout, logger), &cfg
+}
+
+func TestEncryptedManifestLeavesContentsInArchive(t *testing.T) {
+
+	dir := t.TempDir()
+
+	engine, cfg := newTestEngine(t, dir)
+
+	passphrase := filepath.Join(dir, "passphrase")
+
+	if err := os.WriteFile(passphrase, []byte("correct horse battery staple\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Snapshot.Encryption.PassphraseFile = passphrase
+
+	work := filepath.Join(dir, "work")
+
+	testGit(t, "init", "-q", work)
+	testGit(t, "-C", work, "commit", "-q", "--allow-empty", "-m", "first")
+
+	gitDir := filepath.Join(cfg.Storage.MirrorRoot, "repositories", "octocat", "secret-project.git")
+
+	testGit(t, "clone", "-q", "--mirror", work, gitDir)
+
+	ctx := context.Background()
+
+	if err := engine.Create(ctx, false, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshot names have a resolution of one second.
+	time.Sleep(time.Second)
+
+	testGit(t, "-C", work, "commit", "-q", "--allow-empty", "-m", "second")
+	testGit(t, "-C", gitDir, "fetch", "-q", "origin", "+refs/heads/*:refs/heads/*")
+
+	want := testGit(t, "-C", gitDir, "rev-parse", "main")
+
+	if err := engine.Create(ctx, false, true); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := List(cfg.Snapshot.OutputDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshots) != 2 {
+		t.Fatalf("got %d snapshots, want 2", len(snapshots))
+	}
+
+	latest := filepath.Join(cfg.Snapshot.OutputDirectory, snapshots[1])
+
+	for _, name := range snapshots {
+
+		data, err := os.ReadFile(filepath.Join(cfg.Snapshot.OutputDirectory, name) + ManifestSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(data), "secret-project") {
+			t.Fatalf("manifest of %s names a mirror:\n%s", name, data)
+		}
+	}
+
+	manifest, err := LoadManifest(latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !manifest.Incremental() || manifest.Parent != snapshots[0] {
+		t.Fatalf("latest snapshot is %q on %q, want incremental on %s", manifest.Kind, manifest.Parent, snapshots[0])
+	}
+
+	dest := filepath.Join(dir, "restore")
+
+	if err := Materialize(ctx, cfg, latest, dest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := filepath.Join(dest, "mirrors", "repositories", "octocat", "secret-project.git")
+
+	if got := testGit(t, "-C", restored, "rev-parse", "main"); got != want {
+		t.Fatalf("restored main is %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,345 @@
+// internal/snapshot/offsite.go
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/offsite"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+// sidecarSuffixes are the files stored next to every snapshot archive,
+// checksum last.
+var sidecarSuffixes = []string{ManifestSuffix, SignatureSuffix, ".sha256"}
+
+// replicate copies a new snapshot and its sidecars to every configured
+// offsite target, then applies the retention policy there.
+//
+// A failing target doesn't stop the others; the returned error lists
+// every target the snapshot didn't reach.
+func (e *Engine) replicate(ctx context.Context, archive string) error {
+
+	if len(e.cfg.Offsite) == 0 {
+		fmt.Println("      No offsite targets configured")
+		return nil
+	}
+
+	var failed []string
+
+	// Previous results are carried over so a failed attempt still
+	// reports the last snapshot that did reach the target.
+	previous, err := state.LoadOffsite(e.layout.OffsiteStateFile)
+	if err != nil {
+		previous = &state.OffsiteState{}
+	}
+
+	results := state.OffsiteState{
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	for _, cfg := range e.cfg.Offsite {
+
+		result := state.OffsiteTarget{
+			Name:          cfg.DisplayName(),
+			Type:          cfg.Type,
+			LastAttemptAt: time.Now().UTC().Format(time.RFC3339),
+		}
+
+		if last := previous.Target(result.Name); last != nil {
+			result.LastSnapshot = last.LastSnapshot
+			result.LastSuccessAt = last.LastSuccessAt
+		}
+
+		err := e.replicateTo(ctx, cfg, archive)
+
+		if err != nil {
+
+			result.LastError = err.Error()
+			results.Targets = append(results.Targets, result)
+
+			fmt.Printf("      [FAIL] %s: %v\n", cfg.DisplayName(), err)
+
+			e.logger.Emit(
+				logging.Entry{
+					Level: logging.Error,
+					Event: logging.Events.Offsite.UploadFailed,
+
+					Details: map[string]any{
+						"target":   cfg.DisplayName(),
+						"snapshot": archive,
+						"error":    err.Error(),
+					},
+				},
+			)
+
+			failed = append(failed, cfg.DisplayName())
+
+			continue
+		}
+
+		result.LastSnapshot = filepath.Base(archive)
+		result.LastSuccessAt = time.Now().UTC().Format(time.RFC3339)
+		results.Targets = append(results.Targets, result)
+
+		fmt.Printf("      [OK]   %s\n", cfg.DisplayName())
+	}
+
+	if err := state.SaveOffsite(e.layout.OffsiteStateFile, results); err != nil {
+
+		e.logger.Error(
+			logging.Events.Offsite.StateSaveFailed,
+			"",
+			err,
+		)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("offsite upload failed: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// replicateTo uploads archive to one target and, once it is there,
+// applies remote retention. Retention failures are logged only; the
+// snapshot itself did reach the target.
+func (e *Engine) replicateTo(ctx context.Context, cfg config.OffsiteConfig, archive string) error {
+
+	target, err := offsite.New(cfg, e.logger)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	if err := e.upload(ctx, target, archive); err != nil {
+		return err
+	}
+
+	if err := e.applyRemoteRetention(ctx, target); err != nil {
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Error,
+				Event: logging.Events.Offsite.RetentionFailed,
+
+				Details: map[string]any{
+					"target": target.Name(),
+					"error":  err.Error(),
+				},
+			},
+		)
+	}
+
+	return nil
+}
+
+// upload sends archive and its sidecars to target. The checksum goes
+// last, so its presence on the target marks a complete snapshot.
+func (e *Engine) upload(ctx context.Context, target offsite.Target, archive string) error {
+
+	start := time.Now()
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Offsite.UploadStarted,
+
+			Details: map[string]any{
+				"target":   target.Name(),
+				"snapshot": archive,
+			},
+		},
+	)
+
+	files := []string{archive}
+
+	for _, suffix := range sidecarSuffixes {
+		files = append(files, archive+suffix)
+	}
+
+	for _, file := range files {
+
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+
+		if err := e.retry(ctx, target, func() error {
+			return target.Upload(ctx, file)
+		}); err != nil {
+			return err
+		}
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Offsite.UploadCompleted,
+
+			DurationMS: time.Since(start).Milliseconds(),
+
+			Details: map[string]any{
+				"target":   target.Name(),
+				"snapshot": archive,
+			},
+		},
+	)
+
+	return nil
+}
+
+// retry runs fn up to sync.retry_attempts times, with the same linear
+// backoff as mirror operations.
+func (e *Engine) retry(ctx context.Context, target offsite.Target, fn func() error) error {
+
+	attempts := e.cfg.Sync.RetryAttempts
+
+	var err error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Warn,
+				Event: logging.Events.Offsite.Retry,
+
+				Details: map[string]any{
+					"target":       target.Name(),
+					"attempt":      attempt,
+					"max_attempts": attempts,
+					"error":        err.Error(),
+				},
+			},
+		)
+
+		timer := time.NewTimer(time.Duration(attempt*5) * time.Second)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
+
+// applyRemoteRetention deletes snapshots on target that the local
+// retention policy wouldn't keep, along with their sidecars.
+func (e *Engine) applyRemoteRetention(ctx context.Context, target offsite.Target) error {
+
+	if !e.cfg.Snapshot.RetentionEnabled() {
+		return nil
+	}
+
+	// Suspended like local retention; the new snapshot did upload.
+	if retentionSuspended(e.layout, e.logger, target.Name()) {
+		return nil
+	}
+
+	names, err := target.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[string]bool)
+
+	var snapshots []string
+
+	for _, name := range names {
+
+		stored[name] = true
+
+		if IsArchive(name) {
+			snapshots = append(snapshots, name)
+		}
+	}
+
+	sort.Strings(snapshots)
+
+	// Lineage comes from the local manifests: remote retention runs
+	// before local retention, so every snapshot still present remotely
+	// is normally still present here too.
+	decisions, err := PlanRetention(
+		e.cfg.Snapshot,
+		snapshots,
+		Parents(e.cfg.Snapshot.OutputDirectory, snapshots),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	var deleted []string
+	var failedDeletions []string
+
+	for _, decision := range decisions {
+
+		if decision.Keep {
+			continue
+		}
+
+		// Archive first: a leftover sidecar is harmless, a leftover
+		// archive without its checksum is not.
+		files := []string{decision.Snapshot}
+
+		for _, suffix := range sidecarSuffixes {
+
+			if stored[decision.Snapshot+suffix] {
+				files = append(files, decision.Snapshot+suffix)
+			}
+		}
+
+		for _, file := range files {
+
+			if err := target.Delete(ctx, file); err != nil {
+
+				failedDeletions = append(failedDeletions, file)
+
+				continue
+			}
+
+			deleted = append(deleted, file)
+		}
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Offsite.RetentionCompleted,
+
+			Details: map[string]any{
+				"target":           target.Name(),
+				"deleted":          deleted,
+				"failed_deletions": failedDeletions,
+			},
+		},
+	)
+
+	if len(failedDeletions) > 0 {
+		return fmt.Errorf("failed to delete %d remote files", len(failedDeletions))
+	}
+
+	return nil
+}
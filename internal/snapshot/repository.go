@@ -0,0 +1,517 @@
+// internal/snapshot/repository.go
+
+package snapshot
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/filesystem"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/klauspost/compress/zstd"
+)
+
+// IndexExtension is the file suffix of snapshots stored in the chunk
+// repository.
+const IndexExtension = ".index"
+
+// ChunkDirectory holds the chunks of the repository backend, below the
+// snapshot output directory.
+const ChunkDirectory = "chunks"
+
+const indexVersion = 1
+
+// Content-defined chunking parameters. A cut point depends only on the
+// 64 bytes before it, so an unchanged pack file splits into the same
+// chunks no matter where it lands in the stream.
+const (
+	minChunkSize = 512 << 10
+	maxChunkSize = 8 << 20
+
+	// average chunk size past the minimum is ~1 MiB. The mask takes the
+	// hash's high bits, which every one of those 64 bytes has shifted
+	// into; the low bits only see the last few.
+	chunkMask = (1<<20 - 1) << (64 - 20)
+)
+
+// gear maps every byte to a fixed pseudo-random value for the rolling
+// hash. It is derived rather than random so cut points, and with them
+// deduplication, stay stable across versions.
+var gear = func() [256]uint64 {
+
+	var table [256]uint64
+
+	for i := range table {
+		sum := sha256.Sum256([]byte{byte(i)})
+		table[i] = binary.LittleEndian.Uint64(sum[:8])
+	}
+
+	return table
+}()
+
+// Index is a snapshot in the chunk repository: the tar stream an
+// archive would hold, recorded as the ordered chunks it splits into.
+// Chunks are named by the SHA-256 of their contents and stored once,
+// zstd-compressed, however many snapshots use them.
+type Index struct {
+	Version   int    `json:"version"`
+	Snapshot  string `json:"snapshot"`
+	CreatedAt string `json:"created_at"`
+
+	// Size is the size of the uncompressed tar stream.
+	Size int64 `json:"size"`
+
+	Chunks []string `json:"chunks"`
+}
+
+// IsIndex reports whether name is a snapshot in the chunk repository.
+func IsIndex(name string) bool {
+	return strings.HasSuffix(name, IndexExtension)
+}
+
+// LoadIndex reads the index of a repository snapshot.
+func LoadIndex(archive string) (*Index, error) {
+
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	var index Index
+
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parse index %s: %w", filepath.Base(archive), err)
+	}
+
+	if index.Version > indexVersion {
+		return nil, fmt.Errorf(
+			"index %s has unsupported version %d",
+			filepath.Base(archive),
+			index.Version,
+		)
+	}
+
+	return &index, nil
+}
+
+// RepositorySize returns the total size of the chunks stored under the
+// snapshot directory dir, or 0 when the repository backend is unused.
+func RepositorySize(dir string) (int64, error) {
+
+	var size int64
+
+	err := filepath.WalkDir(filepath.Join(dir, ChunkDirectory), func(path string, entry fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+
+		return nil
+	})
+
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	return size, err
+}
+
+// chunkStats describes how a snapshot was stored in the repository.
+type chunkStats struct {
+	Chunks int
+	New    int
+
+	// Stored is the compressed size of the new chunks.
+	Stored int64
+}
+
+// writeIndex stores the tar stream produced by write in the chunk
+// repository next to index, then writes the index itself. Only chunks
+// not already in the repository are written. It returns the SHA-256 and
+// size of the index file, which the checksum and manifest cover; each
+// chunk is checked against its name when read.
+//
+// If the stream can't be completed, the chunks it added are removed
+// again so a failed run leaves the repository as it was.
+func (e *Engine) writeIndex(ctx context.Context, index string, write func(context.Context, *tar.Writer) error) (string, int64, chunkStats, error) {
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return "", 0, chunkStats{}, fmt.Errorf("create zstd encoder: %w", err)
+	}
+
+	defer encoder.Close()
+
+	store := &chunkStore{
+		dir:     filepath.Join(filepath.Dir(index), ChunkDirectory),
+		encoder: encoder,
+	}
+
+	chunks := &chunker{
+		buf:  make([]byte, 0, maxChunkSize),
+		emit: store.put,
+	}
+
+	counter := &countingWriter{}
+
+	tw := tar.NewWriter(io.MultiWriter(chunks, counter))
+
+	if err := write(ctx, tw); err != nil {
+		store.discard()
+		return "", 0, chunkStats{}, err
+	}
+
+	if err := tw.Close(); err != nil {
+		store.discard()
+		return "", 0, chunkStats{}, fmt.Errorf("finalize tar stream: %w", err)
+	}
+
+	if err := chunks.Close(); err != nil {
+		store.discard()
+		return "", 0, chunkStats{}, err
+	}
+
+	data, err := json.MarshalIndent(
+		Index{
+			Version:   indexVersion,
+			Snapshot:  filepath.Base(index),
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+			Size:      counter.n,
+			Chunks:    store.ids,
+		},
+		"",
+		"  ",
+	)
+	if err != nil {
+		store.discard()
+		return "", 0, chunkStats{}, err
+	}
+
+	data = append(data, '\n')
+
+	if err := filesystem.AtomicWriteFile(index, 0600, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		store.discard()
+		return "", 0, chunkStats{}, fmt.Errorf("write index: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	store.stats.Chunks = len(store.ids)
+
+	return hex.EncodeToString(sum[:]), int64(len(data)), store.stats, nil
+}
+
+// chunker splits the bytes written to it at content-defined cut points
+// using a gear rolling hash, and hands every chunk to emit. The slice
+// passed to emit is reused afterwards.
+type chunker struct {
+	buf  []byte
+	hash uint64
+	emit func([]byte) error
+}
+
+func (c *chunker) Write(p []byte) (int, error) {
+
+	for i, b := range p {
+
+		c.buf = append(c.buf, b)
+		c.hash = c.hash<<1 + gear[b]
+
+		if len(c.buf) < minChunkSize {
+			continue
+		}
+
+		if c.hash&chunkMask != 0 && len(c.buf) < maxChunkSize {
+			continue
+		}
+
+		// p[i] is already part of the chunk that failed.
+		if err := c.emit(c.buf); err != nil {
+			return i + 1, err
+		}
+
+		c.buf = c.buf[:0]
+		c.hash = 0
+	}
+
+	return len(p), nil
+}
+
+// Close emits the final, possibly short, chunk.
+func (c *chunker) Close() error {
+
+	if len(c.buf) == 0 {
+		return nil
+	}
+
+	err := c.emit(c.buf)
+	c.buf = c.buf[:0]
+
+	return err
+}
+
+// chunkStore writes chunks into the repository, skipping those already
+// present, and records the chunk list of the snapshot being written.
+type chunkStore struct {
+	dir     string
+	encoder *zstd.Encoder
+
+	ids     []string
+	created []string
+	stats   chunkStats
+}
+
+func (s *chunkStore) put(data []byte) error {
+
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+
+	s.ids = append(s.ids, id)
+
+	path := chunkPath(s.dir, id)
+
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	compressed := s.encoder.EncodeAll(data, nil)
+
+	if err := filesystem.AtomicWriteFile(path, 0600, func(w io.Writer) error {
+		_, err := w.Write(compressed)
+		return err
+	}); err != nil {
+		return fmt.Errorf("store chunk %s: %w", id, err)
+	}
+
+	s.created = append(s.created, path)
+	s.stats.New++
+	s.stats.Stored += int64(len(compressed))
+
+	return nil
+}
+
+// discard removes the chunks this snapshot added; nothing else refers
+// to them yet.
+func (s *chunkStore) discard() {
+
+	for _, path := range s.created {
+		os.Remove(path)
+	}
+}
+
+// chunkPath fans chunks out over 256 directories by the first byte of
+// their name.
+func chunkPath(dir string, id string) string {
+	return filepath.Join(dir, id[:2], id)
+}
+
+// openIndex returns the tar stream recorded by a repository snapshot.
+// Every chunk is checked against its name as it is read, so a damaged
+// chunk fails the read instead of yielding corrupt data.
+func openIndex(archive string) (io.ReadCloser, error) {
+
+	index, err := LoadIndex(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("create zstd decoder: %w", err)
+	}
+
+	return &chunkReader{
+		dir:     filepath.Join(filepath.Dir(archive), ChunkDirectory),
+		chunks:  index.Chunks,
+		decoder: decoder,
+	}, nil
+}
+
+// chunkReader concatenates the chunks of an index, one chunk in memory
+// at a time.
+type chunkReader struct {
+	dir     string
+	chunks  []string
+	decoder *zstd.Decoder
+
+	buf     []byte
+	current []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+
+	for len(r.current) == 0 {
+
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+
+	return n, nil
+}
+
+func (r *chunkReader) next() error {
+
+	id := r.chunks[0]
+	r.chunks = r.chunks[1:]
+
+	compressed, err := os.ReadFile(chunkPath(r.dir, id))
+	if err != nil {
+		return fmt.Errorf("read chunk %s: %w", id, err)
+	}
+
+	r.buf, err = r.decoder.DecodeAll(compressed, r.buf[:0])
+	if err != nil {
+		return fmt.Errorf("decompress chunk %s: %w", id, err)
+	}
+
+	sum := sha256.Sum256(r.buf)
+
+	if hex.EncodeToString(sum[:]) != id {
+		return fmt.Errorf("%w: chunk %s", ErrChecksumMismatch, id)
+	}
+
+	r.current = r.buf
+
+	return nil
+}
+
+func (r *chunkReader) Close() error {
+	r.decoder.Close()
+	return nil
+}
+
+// CollectGarbage deletes every chunk under the snapshot directory dir
+// that no remaining index refers to: all indexes are read to mark the
+// chunks in use, then everything else in the chunk directory is swept.
+// An index that can't be read stops the collection, since sweeping
+// without its marks would delete chunks it still needs.
+func CollectGarbage(dir string, logger *logging.Logger) error {
+
+	chunkDir := filepath.Join(dir, ChunkDirectory)
+
+	if _, err := os.Stat(chunkDir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	snapshots, err := List(dir)
+	if err != nil {
+		return err
+	}
+
+	marked := make(map[string]struct{})
+
+	for _, name := range snapshots {
+
+		if !IsIndex(name) {
+			continue
+		}
+
+		index, err := LoadIndex(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("mark chunks of %s: %w", name, err)
+		}
+
+		for _, id := range index.Chunks {
+			marked[id] = struct{}{}
+		}
+	}
+
+	var deleted int
+	var freed int64
+	var failedDeletions []string
+
+	err = filepath.WalkDir(chunkDir, func(path string, entry fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		// Anything unmarked goes, including temporary files left by an
+		// interrupted write; the snapshot lock rules out a live one.
+		if _, ok := marked[entry.Name()]; ok {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if err := os.Remove(path); err != nil {
+
+			failedDeletions = append(failedDeletions, entry.Name())
+
+			return nil
+		}
+
+		deleted++
+		freed += info.Size()
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("sweep chunks: %w", err)
+	}
+
+	logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Snapshot.GarbageCollected,
+
+			Details: map[string]any{
+				"referenced_chunks": len(marked),
+				"deleted_chunks":    deleted,
+				"freed_bytes":       freed,
+				"failed_deletions":  failedDeletions,
+			},
+		},
+	)
+
+	if len(failedDeletions) > 0 {
+		return fmt.Errorf("failed to delete %d chunks", len(failedDeletions))
+	}
+
+	return nil
+}
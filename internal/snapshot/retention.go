@@ -3,83 +3,260 @@
 package snapshot
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
-	"strings"
+	"slices"
+	"time"
 
 	"github.com/flarexes/gitback/internal/config"
 	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/runtime"
+	"github.com/flarexes/gitback/internal/state"
 )
 
-// ApplyRetention removes old snapshots after a
-// successful snapshot creation.
+// ErrRetentionSuspended is returned by ApplyRetention while a safety
+// alert is unacknowledged.
+var ErrRetentionSuspended = errors.New(
+	"snapshot retention is suspended by an unacknowledged safety alert; review it and run: gitback acknowledge",
+)
+
+// Retention rules, as reported in retention decisions.
+const (
+	RuleLast    = "last"
+	RuleWithin  = "within"
+	RuleDaily   = "daily"
+	RuleWeekly  = "weekly"
+	RuleMonthly = "monthly"
+	RuleYearly  = "yearly"
+
+	// RuleParent keeps snapshots a kept incremental snapshot builds on.
+	RuleParent = "parent"
+
+	// RuleUnrecognized keeps snapshots whose name carries no
+	// timestamp; retention never deletes what it can't date.
+	RuleUnrecognized = "unrecognized_name"
+)
+
+// RetentionDecision records whether a snapshot survives retention and
+// which rules kept it.
+type RetentionDecision struct {
+	Snapshot  string
+	CreatedAt time.Time
+	Keep      bool
+	Rules     []string
+}
+
+// bucketRule keeps the newest snapshot of each of the newest count
+// calendar periods, where key names the period a snapshot falls in.
+type bucketRule struct {
+	name  string
+	count int
+	key   func(time.Time) string
+}
+
+// PlanRetention decides which of snapshots (oldest first, as returned
+// by List) survive the configured policy at time now. Decisions are
+// returned in the same order. parents maps incremental snapshots to the
+// snapshot they build on, as returned by Parents.
 //
-// Retention is disabled when configured <= 0.
-func ApplyRetention(cfg *config.Config, logger *logging.Logger) error {
+// A snapshot is kept when any rule keeps it:
+//   - retention: the newest N snapshots
+//   - keep_within: snapshots younger than the duration
+//   - keep_daily/weekly/monthly/yearly: the newest snapshot of each of
+//     the newest N days/ISO weeks/months/years that have snapshots
+//   - parent: a kept incremental snapshot can't be restored without it
+func PlanRetention(cfg config.SnapshotConfig, snapshots []string, parents map[string]string, now time.Time) ([]RetentionDecision, error) {
 
-	snapshotDir := cfg.Snapshot.OutputDirectory
-	snapshotRetentionCount := cfg.Snapshot.Retention
+	var within time.Duration
 
-	if snapshotRetentionCount <= 0 {
+	if cfg.KeepWithin != "" {
 
-		logger.Info(
-			logging.Events.Snapshot.RetentionDisabled,
-			"",
-		)
+		duration, err := config.ParseKeepWithin(cfg.KeepWithin)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot.keep_within: %w", err)
+		}
 
-		return nil
+		within = duration
 	}
 
-	logger.Info(
-		logging.Events.Snapshot.RetentionStarted,
-		"",
-	)
+	buckets := []*bucketRule{
+		{
+			name:  RuleDaily,
+			count: cfg.KeepDaily,
+			key:   func(t time.Time) string { return t.Format("2006-01-02") },
+		},
+		{
+			name:  RuleWeekly,
+			count: cfg.KeepWeekly,
+			key: func(t time.Time) string {
+				year, week := t.ISOWeek()
+				return fmt.Sprintf("%d-W%02d", year, week)
+			},
+		},
+		{
+			name:  RuleMonthly,
+			count: cfg.KeepMonthly,
+			key:   func(t time.Time) string { return t.Format("2006-01") },
+		},
+		{
+			name:  RuleYearly,
+			count: cfg.KeepYearly,
+			key:   func(t time.Time) string { return t.Format("2006") },
+		},
+	}
 
-	entries, err := os.ReadDir(snapshotDir)
+	// last period each bucket rule kept a snapshot for
+	lastKey := make(map[string]string)
 
-	if err != nil {
-		return err
+	decisions := make([]RetentionDecision, len(snapshots))
+
+	last := cfg.Retention
+
+	// Walk newest first so each rule keeps the newest snapshot of a
+	// period and counts periods back from now.
+	for i := len(snapshots) - 1; i >= 0; i-- {
+
+		decision := RetentionDecision{
+			Snapshot: snapshots[i],
+		}
+
+		createdAt, err := Timestamp(snapshots[i])
+
+		if err != nil {
+
+			decision.Keep = true
+			decision.Rules = []string{RuleUnrecognized}
+			decisions[i] = decision
+
+			continue
+		}
+
+		decision.CreatedAt = createdAt
+
+		if last > 0 {
+
+			decision.Rules = append(decision.Rules, RuleLast)
+			last--
+		}
+
+		if within > 0 && now.Sub(createdAt) <= within {
+			decision.Rules = append(decision.Rules, RuleWithin)
+		}
+
+		for _, rule := range buckets {
+
+			if rule.count <= 0 {
+				continue
+			}
+
+			key := rule.key(createdAt)
+
+			if key == lastKey[rule.name] {
+				continue
+			}
+
+			decision.Rules = append(decision.Rules, rule.name)
+			lastKey[rule.name] = key
+			rule.count--
+		}
+
+		decision.Keep = len(decision.Rules) > 0
+		decisions[i] = decision
 	}
 
-	var snapshots []string
+	// Parents are always older than their children, so a single pass
+	// from newest to oldest keeps whole chains.
+	index := make(map[string]int, len(snapshots))
 
-	for _, entry := range entries {
+	for i, name := range snapshots {
+		index[name] = i
+	}
+
+	for i := len(decisions) - 1; i >= 0; i-- {
 
-		if entry.IsDir() {
+		if !decisions[i].Keep {
 			continue
 		}
 
-		name := entry.Name()
+		parent, ok := index[parents[decisions[i].Snapshot]]
 
-		if !strings.HasSuffix(name, ".tar.zst") {
+		if !ok || parent >= i || slices.Contains(decisions[parent].Rules, RuleParent) {
 			continue
 		}
 
-		snapshots = append(
-			snapshots,
-			name,
+		decisions[parent].Keep = true
+		decisions[parent].Rules = append(decisions[parent].Rules, RuleParent)
+	}
+
+	return decisions, nil
+}
+
+// ApplyRetention removes snapshots the configured policy doesn't keep,
+// after a successful snapshot creation or from `gitback snapshot prune`,
+// then garbage-collects chunks of the repository backend.
+//
+// Retention is disabled when no rule is configured, and suspended with
+// ErrRetentionSuspended while a safety alert is unacknowledged. The
+// returned decisions describe every snapshot considered.
+func ApplyRetention(cfg *config.Config, layout runtime.Layout, logger *logging.Logger) ([]RetentionDecision, error) {
+
+	snapshotDir := cfg.Snapshot.OutputDirectory
+
+	if !cfg.Snapshot.RetentionEnabled() {
+
+		logger.Info(
+			logging.Events.Snapshot.RetentionDisabled,
+			"",
 		)
+
+		return nil, nil
 	}
 
-	//
-	// Snapshot filenames use timestamps.
-	// Lexical ordering matches chronological ordering.
-	//
-	sort.Strings(snapshots)
+	if retentionSuspended(layout, logger, "local") {
+		return nil, ErrRetentionSuspended
+	}
 
-	if len(snapshots) <= snapshotRetentionCount {
-		return nil
+	logger.Info(
+		logging.Events.Snapshot.RetentionStarted,
+		"",
+	)
+
+	// List returns snapshots oldest first.
+	snapshots, err := List(snapshotDir)
+
+	if err != nil {
+		return nil, err
 	}
 
-	toDelete := snapshots[:len(snapshots)-snapshotRetentionCount]
+	decisions, err := PlanRetention(
+		cfg.Snapshot,
+		snapshots,
+		Parents(snapshotDir, snapshots),
+		time.Now().UTC(),
+	)
+
+	if err != nil {
+		return nil, err
+	}
 
 	var deletedSnapshots []string
 	var deletedChecksums []string
 	var missingChecksums []string
+	var deletedManifests []string
 	var failedDeletions []string
 
-	for _, snapshot := range toDelete {
+	kept := make(map[string][]string)
+
+	for _, decision := range decisions {
+
+		snapshot := decision.Snapshot
+
+		if decision.Keep {
+			kept[snapshot] = decision.Rules
+			continue
+		}
 
 		// delete snapshot file
 		snapshotPath := filepath.Join(
@@ -108,6 +285,40 @@ func ApplyRetention(cfg *config.Config, logger *logging.Logger) error {
 			snapshot,
 		)
 
+		// delete manifest and signature; snapshots created before
+		// manifests existed simply don't have them
+		for _, suffix := range []string{ManifestSuffix, SignatureSuffix} {
+
+			sidecar := snapshot + suffix
+
+			err := os.Remove(filepath.Join(snapshotDir, sidecar))
+
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			if err != nil {
+
+				failedDeletions = append(
+					failedDeletions,
+					sidecar,
+				)
+
+				logger.Error(
+					logging.Events.Snapshot.RetentionFailed,
+					"",
+					err,
+				)
+
+				continue
+			}
+
+			deletedManifests = append(
+				deletedManifests,
+				sidecar,
+			)
+		}
+
 		// delete corresponding checksum file
 		checksum := snapshot + ".sha256"
 
@@ -155,7 +366,9 @@ func ApplyRetention(cfg *config.Config, logger *logging.Logger) error {
 			Event: logging.Events.Snapshot.RetentionCompleted,
 
 			Details: map[string]any{
-				"retention": snapshotRetentionCount,
+				"retention": retentionPolicy(cfg.Snapshot),
+
+				"kept": kept,
 
 				"deleted_snapshots": deletedSnapshots,
 
@@ -163,10 +376,67 @@ func ApplyRetention(cfg *config.Config, logger *logging.Logger) error {
 
 				"missing_checksums": missingChecksums,
 
+				"deleted_manifests": deletedManifests,
+
 				"failed_deletions": failedDeletions,
 			},
 		},
 	)
 
-	return nil
+	// Deleting repository indexes leaves their chunks behind; sweep
+	// whatever no remaining snapshot uses.
+	if err := CollectGarbage(snapshotDir, logger); err != nil {
+
+		logger.Error(
+			logging.Events.Snapshot.GarbageCollectionFailed,
+			"",
+			err,
+		)
+	}
+
+	return decisions, nil
+}
+
+// retentionSuspended reports whether a safety alert holds retention on
+// target back, and logs it if so. A safety state that can't be read
+// holds it too: deleting old snapshots is what the alert guards against.
+func retentionSuspended(layout runtime.Layout, logger *logging.Logger, target string) bool {
+
+	alert, err := state.LoadSafety(layout.SafetyStateFile)
+
+	details := map[string]any{
+		"target": target,
+	}
+
+	switch {
+	case err != nil:
+		details["error"] = err.Error()
+	case alert.Active():
+		details["raised_at"] = alert.RaisedAt
+	default:
+		return false
+	}
+
+	logger.Emit(
+		logging.Entry{
+			Level:   logging.Warn,
+			Event:   logging.Events.Safety.RetentionBlocked,
+			Details: details,
+		},
+	)
+
+	return true
+}
+
+// retentionPolicy summarizes the configured rules for logging.
+func retentionPolicy(cfg config.SnapshotConfig) map[string]any {
+
+	return map[string]any{
+		"last":         cfg.Retention,
+		"keep_daily":   cfg.KeepDaily,
+		"keep_weekly":  cfg.KeepWeekly,
+		"keep_monthly": cfg.KeepMonthly,
+		"keep_yearly":  cfg.KeepYearly,
+		"keep_within":  cfg.KeepWithin,
+	}
 }
@@ -3,12 +3,13 @@
 package snapshot
 
 import (
+	"archive/tar"
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -33,18 +34,15 @@ func New(cfg *config.Config, layout runtime.Layout, logger *logging.Logger) *Eng
 	}
 }
 
-func (e *Engine) Create(ctx context.Context, force bool) error {
+// Create archives the mirrors as a new snapshot. Unless always is set,
+// nothing is created when the mirrors haven't changed since the latest
+// snapshot.
+func (e *Engine) Create(ctx context.Context, force bool, always bool) error {
 
 	start := time.Now()
 
-	// Verify dependencies before doing anything.
-	if err := e.verifyDependencies(); err != nil {
-
-		return err
-	}
-
 	// Verify mirror state
-	fmt.Println("[1/5] Verifying mirrors")
+	fmt.Println("[1/6] Verifying mirrors")
 	if err := e.verifyMirrors(); err != nil {
 
 		e.logger.Error(
@@ -64,28 +62,37 @@ func (e *Engine) Create(ctx context.Context, force bool) error {
 		)
 	}
 
-	timestamp := time.Now().
-		UTC().
-		Format("2006-01-02T15-04-05Z")
+	if !always {
 
-	tarFile := filepath.Join(e.cfg.Snapshot.OutputDirectory, timestamp+".tar")
-	archiveFile := tarFile + ".zst"
-	checksumFile := archiveFile + ".sha256"
+		latest, unchanged := e.unchanged()
 
-	// check if tarFile already exists to avoid collision
-	if _, err := os.Stat(tarFile); err == nil {
+		if unchanged {
 
-		err_msg := fmt.Errorf("temporary archive already exists: %s", tarFile)
+			fmt.Printf("      No changes since %s, skipping snapshot (use --always to create one anyway)\n", latest)
 
-		e.logger.Error(
-			logging.Events.Snapshot.CollisionDetected,
-			"",
-			err_msg,
-		)
+			e.logger.Emit(
+				logging.Entry{
+					Level: logging.Info,
+					Event: logging.Events.Snapshot.Skipped,
 
-		return err_msg
+					Details: map[string]any{
+						"latest":      latest,
+						"fingerprint": e.fingerprint(),
+					},
+				},
+			)
+
+			return nil
+		}
 	}
 
+	timestamp := time.Now().
+		UTC().
+		Format(TimestampLayout)
+
+	archiveFile := filepath.Join(e.cfg.Snapshot.OutputDirectory, timestamp+extension(e.cfg))
+	checksumFile := archiveFile + ".sha256"
+
 	// check if archiveFile already exists to avoid collision
 	if _, err := os.Stat(archiveFile); err == nil {
 
@@ -100,81 +107,174 @@ func (e *Engine) Create(ctx context.Context, force bool) error {
 		return err_msg
 	}
 
-	// Create tar archive.
+	// Create the compressed archive. Archiving, compression, and
+	// hashing happen in a single streaming pass.
 	e.logger.Info(
 		logging.Events.Snapshot.ArchiveStarted,
 		"",
 	)
 
-	fmt.Println("[2/5] Creating archive")
+	refs, err := e.collectRefs(ctx)
+	if err != nil {
+		return err
+	}
+
+	releases, err := e.collectReleases()
+	if err != nil {
+		return err
+	}
+
+	gists, err := e.collectGistMetadata()
+	if err != nil {
+		return err
+	}
+
+	metadata, err := e.collectMetadata()
+	if err != nil {
+		return err
+	}
+
+	contents := Contents{
+		Mirrors:  refs,
+		Releases: releases,
+		Gists:    gists,
+		Metadata: metadata,
+	}
+
+	entry, err := encodeContents(contents)
+	if err != nil {
+		return err
+	}
 
-	if err := e.createTar(ctx, tarFile); err != nil {
+	parent, err := e.incrementalParent(ctx)
+	if err != nil {
 		return err
 	}
 
+	write := func(ctx context.Context, tw *tar.Writer) error {
+		return e.writeEntries(ctx, tw, entry)
+	}
+
+	bundles := 0
+
+	if parent != nil {
+
+		fmt.Printf("[2/6] Creating incremental archive (parent %s)\n", parent.Snapshot)
+
+		write = func(ctx context.Context, tw *tar.Writer) error {
+
+			var err error
+
+			bundles, err = e.writeBundles(ctx, tw, entry, contents, parent)
+
+			return err
+		}
+
+	} else {
+		fmt.Println("[2/6] Creating archive")
+	}
+
+	details := map[string]any{
+		"archive": archiveFile,
+		"kind":    KindFull,
+	}
+
+	var sum string
+	var size int64
+
+	if e.cfg.Snapshot.Backend == config.SnapshotBackendRepository {
+
+		var stats chunkStats
+
+		sum, size, stats, err = e.writeIndex(ctx, archiveFile, write)
+		if err != nil {
+			return err
+		}
+
+		details["chunks"] = stats.Chunks
+		details["new_chunks"] = stats.New
+		details["stored_bytes"] = stats.Stored
+
+	} else {
+
+		sum, size, err = e.writeArchive(ctx, archiveFile, write)
+		if err != nil {
+			return err
+		}
+	}
+
+	details["size"] = size
+
+	if parent != nil {
+		details["kind"] = KindIncremental
+		details["parent"] = parent.Snapshot
+		details["bundles"] = bundles
+	}
+
 	e.logger.Emit(
 		logging.Entry{
 			Level: logging.Info,
 			Event: logging.Events.Snapshot.ArchiveCompleted,
 
-			Details: map[string]any{
-				"archive": tarFile,
-			},
+			Details: details,
 		},
 	)
 
-	// Always cleanup temporary tar file.
-	defer os.Remove(tarFile)
-
-	// Compress archive.
+	// Write checksum.
 	e.logger.Info(
-		logging.Events.Snapshot.CompressionStarted,
+		logging.Events.Snapshot.ChecksumStarted,
 		"",
 	)
 
-	fmt.Println("[3/5] Compressing archive")
+	fmt.Println("[3/6] Writing checksum")
 
-	if err := e.compress(ctx, tarFile); err != nil {
+	if err := writeChecksum(archiveFile, sum, checksumFile); err != nil {
 		return err
 	}
 
 	e.logger.Emit(
 		logging.Entry{
 			Level: logging.Info,
-			Event: logging.Events.Snapshot.CompressionCompleted,
+			Event: logging.Events.Snapshot.ChecksumCompleted,
 
 			Details: map[string]any{
-				"archive": archiveFile,
+				"checksum": checksumFile,
 			},
 		},
 	)
 
-	// Generate checksum.
-	e.logger.Info(
-		logging.Events.Snapshot.ChecksumStarted,
-		"",
-	)
-
-	fmt.Println("[4/5] Generating checksum")
+	// Write signed manifest.
+	fmt.Println("[4/6] Signing manifest")
 
-	if err := e.sha256(archiveFile, checksumFile); err != nil {
+	if err := e.writeManifest(archiveFile, sum, size, contents, entry, parent); err != nil {
 		return err
 	}
 
 	e.logger.Emit(
 		logging.Entry{
 			Level: logging.Info,
-			Event: logging.Events.Snapshot.ChecksumCompleted,
+			Event: logging.Events.Snapshot.ManifestSigned,
 
 			Details: map[string]any{
-				"checksum": checksumFile,
+				"manifest": archiveFile + ManifestSuffix,
+				"mirrors":  len(refs),
 			},
 		},
 	)
 
+	// Replicate offsite. A failed upload doesn't stop local retention,
+	// which always keeps the new snapshot, but fails the run afterwards.
+	fmt.Println("[5/6] Uploading to offsite targets")
+
+	offsiteErr := e.replicate(ctx, archiveFile)
+
 	// Apply retention policy.
-	fmt.Println("[5/5] Applying retention policy")
-	if err := ApplyRetention(e.cfg, e.logger); err != nil {
+	fmt.Println("[6/6] Applying retention policy")
+	if _, err := ApplyRetention(e.cfg, e.layout, e.logger); errors.Is(err, ErrRetentionSuspended) {
+
+		fmt.Println("  [SKIP] Suspended by an unacknowledged safety alert. Run: gitback acknowledge")
+
+	} else if err != nil {
 
 		e.logger.Error(
 			logging.Events.Snapshot.RetentionFailed,
@@ -196,31 +296,76 @@ func (e *Engine) Create(ctx context.Context, force bool) error {
 			Details: map[string]any{
 				"archive":    archiveFile,
 				"checksum":   checksumFile,
+				"manifest":   archiveFile + ManifestSuffix,
+				"size":       size,
 				"force_mode": force,
 			},
 		},
 	)
 
-	return nil
+	return offsiteErr
 }
 
-// verifyDependencies checks if required system dependencies are available.
-func (e *Engine) verifyDependencies() error {
+// fingerprint returns the combined mirror fingerprint recorded by the
+// last sync, or "" when it is unknown. With metadata backup enabled it
+// covers the last metadata export as well.
+func (e *Engine) fingerprint() string {
 
-	required := []string{"tar", "zstd"}
+	data, err := state.LoadMirrors(e.layout.MirrorsStateFile)
+	if err != nil {
+		return ""
+	}
 
-	for _, binary := range required {
+	fingerprint := data.Fingerprint()
 
-		if _, err := exec.LookPath(binary); err != nil {
+	if fingerprint == "" || !e.cfg.GitHub.BackupMetadata {
+		return fingerprint
+	}
 
-			return fmt.Errorf("%s not found in PATH", binary)
-		}
+	exported, err := state.LoadMetadata(e.layout.MetadataStateFile)
+	if err != nil || len(exported.Repositories) == 0 {
+		return ""
 	}
 
-	return nil
+	metadata := exported.Fingerprint()
+
+	if metadata == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(fingerprint + " " + metadata))
+
+	return hex.EncodeToString(sum[:])
 }
 
-// verifyMirrors checks the health of all mirrored repositories.
+// unchanged reports whether the latest snapshot already captured the
+// mirrors as they are now, and names that snapshot. Snapshots without a
+// recorded fingerprint never count as unchanged.
+func (e *Engine) unchanged() (string, bool) {
+
+	fingerprint := e.fingerprint()
+
+	if fingerprint == "" {
+		return "", false
+	}
+
+	snapshots, err := List(e.cfg.Snapshot.OutputDirectory)
+	if err != nil || len(snapshots) == 0 {
+		return "", false
+	}
+
+	latest := snapshots[len(snapshots)-1]
+
+	manifest, err := LoadManifest(filepath.Join(e.cfg.Snapshot.OutputDirectory, latest))
+	if err != nil {
+		return "", false
+	}
+
+	return latest, manifest.Fingerprint == fingerprint
+}
+
+// verifyMirrors checks the health of all mirrored repositories. Failed
+// starred repositories are only reported.
 func (e *Engine) verifyMirrors() error {
 
 	e.logger.Info(
@@ -287,94 +432,24 @@ func (e *Engine) verifyMirrors() error {
 		return fmt.Errorf("%s", builder.String())
 	}
 
-	e.logger.Info(
-		logging.Events.Snapshot.VerificationPassed,
-		"",
-	)
-
-	return nil
-}
-
-// Create a tar archive containing:
-//
-//	<mirror_root>/
-//
-//	state/mirrors.json
-func (e *Engine) createTar(ctx context.Context, output string) error {
-
-	mirrorRoot := e.cfg.Storage.MirrorRoot
-
-	stateDir := e.layout.StateDir
-
-	cmd := exec.CommandContext(
-		ctx,
-		"tar",
-		"-cf",
-		output,
-
-		// Add mirror directory.
-		"-C",
-		filepath.Dir(mirrorRoot),
-		filepath.Base(mirrorRoot),
-
-		// Add mirror state file.
-		"-C",
-		stateDir,
-		filepath.Base(e.layout.MirrorsStateFile),
-	)
-
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("tar failed: %s", strings.TrimSpace(string(out)))
-	}
-
-	return nil
-}
-
-// Compress a tar archive using zstd.
-func (e *Engine) compress(ctx context.Context, tarFile string) error {
-
-	cmd := exec.CommandContext(
-		ctx,
-		"zstd",
-		"-T2",
-		tarFile,
-	)
-
-	out, err := cmd.CombinedOutput()
+	// Starred repositories belong to third parties and can break or
+	// vanish at any time; the snapshot keeps their last mirrors.
+	var starredFailed int
 
-	if err != nil {
-		return fmt.Errorf("zstd failed: %s", string(out))
-	}
-
-	return nil
-}
-
-// Generate a SHA-256 checksum for a file.
-func (e *Engine) sha256(input string, output string) error {
-
-	file, err := os.Open(input)
-	if err != nil {
-		return err
+	for _, repo := range data.Starred {
+		if !repo.LastSuccess {
+			starredFailed++
+		}
 	}
 
-	defer file.Close()
-
-	hash := sha256.New()
-
-	if _, err := io.Copy(hash, file); err != nil {
-		return err
+	if starredFailed > 0 {
+		fmt.Printf("      [WARN] %d starred repositories failed to sync, keeping their last mirrors\n", starredFailed)
 	}
 
-	sum := fmt.Sprintf(
-		"%x  %s\n",
-		hash.Sum(nil),
-		filepath.Base(input),
+	e.logger.Info(
+		logging.Events.Snapshot.VerificationPassed,
+		"",
 	)
 
-	return os.WriteFile(
-		output,
-		[]byte(sum),
-		0600,
-	)
+	return nil
 }
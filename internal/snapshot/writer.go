@@ -0,0 +1,252 @@
+// internal/snapshot/writer.go
+
+package snapshot
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// writeArchive streams a snapshot straight into its final compressed
+// form:
+//
+//	archive/tar -> zstd [-> age] -> SHA-256 + destination file
+//
+// so no uncompressed intermediate is ever written and the checksum is
+// known as soon as the archive is complete. When encryption is enabled
+// the checksum covers the encrypted file, so it can be checked without
+// any key. The entries are written by write; see writeEntries and
+// writeBundles.
+//
+// Output is written to "<archive>.partial" and renamed into place only
+// once complete, so an interrupted run never leaves a truncated archive
+// that looks like a real snapshot.
+func (e *Engine) writeArchive(ctx context.Context, archive string, write func(context.Context, *tar.Writer) error) (string, int64, error) {
+
+	partial := archive + ".partial"
+
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", 0, fmt.Errorf("create archive: %w", err)
+	}
+
+	// Remove the partial file unless the rename succeeds.
+	defer os.Remove(partial)
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+
+	var sink io.WriteCloser = nopCloser{io.MultiWriter(file, hash, counter)}
+
+	if e.cfg.Snapshot.Encryption.Enabled() {
+
+		sink, err = encrypt(e.cfg, sink)
+		if err != nil {
+			file.Close()
+			return "", 0, fmt.Errorf("create age encryptor: %w", err)
+		}
+	}
+
+	encoder, err := zstd.NewWriter(
+		sink,
+		zstd.WithEncoderConcurrency(2),
+	)
+	if err != nil {
+		file.Close()
+		return "", 0, fmt.Errorf("create zstd encoder: %w", err)
+	}
+
+	tw := tar.NewWriter(encoder)
+
+	if err := write(ctx, tw); err != nil {
+		encoder.Close()
+		file.Close()
+		return "", 0, err
+	}
+
+	if err := tw.Close(); err != nil {
+		encoder.Close()
+		file.Close()
+		return "", 0, fmt.Errorf("finalize tar stream: %w", err)
+	}
+
+	if err := encoder.Close(); err != nil {
+		file.Close()
+		return "", 0, fmt.Errorf("finalize zstd stream: %w", err)
+	}
+
+	if err := sink.Close(); err != nil {
+		file.Close()
+		return "", 0, fmt.Errorf("finalize age stream: %w", err)
+	}
+
+	// Flush archive contents to disk before making it visible.
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return "", 0, fmt.Errorf("sync archive: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return "", 0, fmt.Errorf("close archive: %w", err)
+	}
+
+	if err := os.Rename(partial, archive); err != nil {
+		return "", 0, fmt.Errorf("activate archive: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), counter.n, nil
+}
+
+// writeEntries writes the entries of a full snapshot:
+//
+//	mirrors.json
+//	contents.json
+//	<mirror_root>/
+//
+// The mirror state and contents come first so they can be read without
+// decompressing the whole snapshot.
+func (e *Engine) writeEntries(ctx context.Context, tw *tar.Writer, contents []byte) error {
+
+	// Mirror state file.
+	if err := addFile(
+		tw,
+		e.layout.MirrorsStateFile,
+		filepath.Base(e.layout.MirrorsStateFile),
+	); err != nil {
+		return err
+	}
+
+	if err := addContents(tw, contents); err != nil {
+		return err
+	}
+
+	// Mirror directory, stored under its own base name.
+	mirrorRoot := filepath.Clean(e.cfg.Storage.MirrorRoot)
+	base := filepath.Base(mirrorRoot)
+
+	return filepath.WalkDir(mirrorRoot, func(path string, entry fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		// Stop promptly on SIGINT/SIGTERM; there's no subprocess to
+		// kill anymore, so the walk itself has to check.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(mirrorRoot, path)
+		if err != nil {
+			return err
+		}
+
+		return addFile(
+			tw,
+			path,
+			filepath.ToSlash(filepath.Join(base, relative)),
+		)
+	})
+}
+
+// addFile writes a single filesystem entry to the tar stream. Sockets,
+// devices, and other special files never appear in git mirrors and are
+// skipped.
+func addFile(tw *tar.Writer, path string, name string) error {
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	var link string
+
+	if info.Mode()&os.ModeSymlink != 0 {
+
+		link, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !info.Mode().IsRegular() && !info.IsDir() && link == "" {
+		return nil
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", path, err)
+	}
+
+	header.Name = name
+
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("archive %s: %w", path, err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if _, err := io.Copy(tw, file); err != nil {
+		return fmt.Errorf("archive %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// writeChecksum writes a sha256sum-compatible checksum file for archive.
+func writeChecksum(archive string, sum string, output string) error {
+
+	line := fmt.Sprintf(
+		"%s  %s\n",
+		sum,
+		filepath.Base(archive),
+	)
+
+	return os.WriteFile(
+		output,
+		[]byte(line),
+		0600,
+	)
+}
+
+// nopCloser adds a no-op Close to a writer, so the unencrypted and
+// encrypted pipelines can be finalized the same way.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// countingWriter records how many bytes pass through it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,73 @@
+// internal/state/fingerprint.go
+
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// Fingerprint combines the fingerprints of every asset into one value
+// that changes whenever any mirror's refs, stored LFS objects or gist
+// metadata change, or an asset is added or removed. It returns "" when
+// the state can't vouch for every mirror: an asset other than a starred
+// repository failed to sync, or was recorded before fingerprints
+// existed.
+func (s *MirrorState) Fingerprint() string {
+
+	var lines []string
+
+	groups := map[string][]Asset{
+		"repository": s.Repositories,
+		"wiki":       s.Wikis,
+		"gist":       s.Gists,
+		"release":    s.Releases,
+		"starred":    s.Starred,
+	}
+
+	for kind, assets := range groups {
+
+		for _, asset := range assets {
+
+			switch {
+			case asset.Empty:
+				lines = append(lines, fmt.Sprintf("%s %s empty", kind, asset.Name))
+			case !asset.LastSuccess && kind == "starred":
+				// A third-party repository that fails to sync keeps
+				// its last mirror, and mustn't force a new snapshot
+				// on every run for as long as it stays broken.
+				lines = append(lines, fmt.Sprintf("%s %s failed", kind, asset.Name))
+			case !asset.LastSuccess || asset.Fingerprint == "":
+				return ""
+			default:
+				line := fmt.Sprintf("%s %s %s", kind, asset.Name, asset.Fingerprint)
+
+				// LFS objects can arrive without any ref changing,
+				// when an earlier fetch missed them.
+				if asset.LFSObjects > 0 {
+					line += fmt.Sprintf(" lfs %d %d", asset.LFSObjects, asset.LFSBytes)
+				}
+
+				// Neither does editing a gist's description or
+				// commenting on it.
+				if asset.Metadata != "" {
+					line += " metadata " + asset.Metadata
+				}
+
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	sort.Strings(lines)
+
+	hash := sha256.New()
+
+	for _, line := range lines {
+		fmt.Fprintln(hash, line)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,126 @@
+// internal/state/history.go
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/flarexes/gitback/internal/filesystem"
+)
+
+// Reasons a repository left the inventory.
+const (
+	// RemovalMissing means GitHub no longer lists the repository: it
+	// was deleted, renamed, or the token lost access to it.
+	RemovalMissing = "missing"
+
+	// RemovalExcluded means it is still listed, but filter rules now
+	// exclude it.
+	RemovalExcluded = "excluded"
+)
+
+// RepositoryRecord tracks one repository across discoveries. Once it
+// leaves the inventory the record stays as a tombstone, with RemovedAt
+// set, so there is a trace of why its mirror stopped being synced.
+type RepositoryRecord struct {
+	Name string `json:"name"`
+
+	// ID is GitHub's numeric repository ID. It stays the same when the
+	// repository is renamed or transferred, unlike Name.
+	ID int64 `json:"id,omitempty"`
+
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"`
+
+	RemovedAt     string `json:"removed_at,omitempty"`
+	RemovalReason string `json:"removal_reason,omitempty"`
+
+	// Archived lists where its mirrors were moved, relative to the
+	// mirror root, and ArchivedFiles where its release and metadata
+	// directories went. PurgedAt is set once they were deleted after
+	// the grace period.
+	Archived      []string `json:"archived,omitempty"`
+	ArchivedFiles []string `json:"archived_files,omitempty"`
+	PurgedAt      string   `json:"purged_at,omitempty"`
+}
+
+// Removed reports whether the record is a tombstone.
+func (r *RepositoryRecord) Removed() bool {
+	return r.RemovedAt != ""
+}
+
+// InventoryHistory records every repository discovery has seen.
+type InventoryHistory struct {
+	GeneratedAt  string             `json:"generated_at"`
+	Repositories []RepositoryRecord `json:"repositories"`
+}
+
+// RepositoryIDs maps the clone URL of every repository currently in
+// the inventory to its GitHub ID, where known.
+func (h *InventoryHistory) RepositoryIDs() map[string]int64 {
+
+	ids := make(map[string]int64, len(h.Repositories))
+
+	for _, record := range h.Repositories {
+
+		if record.Removed() || record.ID == 0 {
+			continue
+		}
+
+		ids[record.Name] = record.ID
+	}
+
+	return ids
+}
+
+func SaveInventoryHistory(path string, data InventoryHistory) error {
+
+	return filesystem.AtomicWriteFile(
+		path,
+		0600,
+		func(w io.Writer) error {
+
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+
+			return encoder.Encode(data)
+		},
+	)
+}
+
+// LoadInventoryHistory reads the inventory history. A missing file
+// yields an empty history, as before the first discovery.
+func LoadInventoryHistory(path string) (*InventoryHistory, error) {
+
+	file, err := os.Open(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return &InventoryHistory{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf(
+			"open inventory history %s: %w",
+			path,
+			err,
+		)
+	}
+
+	defer file.Close()
+
+	var data InventoryHistory
+
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return nil, fmt.Errorf(
+			"load inventory history %s: %w",
+			path,
+			err,
+		)
+	}
+
+	return &data, nil
+}
@@ -0,0 +1,112 @@
+// internal/state/metadata.go
+
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/flarexes/gitback/internal/filesystem"
+)
+
+// MetadataRecord tracks the metadata export of one repository.
+type MetadataRecord struct {
+	Name string `json:"name"`
+	ID   int64  `json:"id,omitempty"`
+
+	// Since is when the last successful export started; the next one
+	// only asks GitHub for what was updated after it.
+	Since string `json:"since,omitempty"`
+
+	LastSuccess bool   `json:"last_success"`
+	Error       string `json:"error,omitempty"`
+
+	// Fingerprint summarizes the exported files; it changes whenever
+	// any of them does.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+type MetadataState struct {
+	GeneratedAt  string           `json:"generated_at"`
+	Repositories []MetadataRecord `json:"repositories"`
+}
+
+// Fingerprint combines the fingerprints of every repository's export,
+// like MirrorState.Fingerprint. It returns "" when an export failed.
+func (s *MetadataState) Fingerprint() string {
+
+	lines := make([]string, 0, len(s.Repositories))
+
+	for _, record := range s.Repositories {
+
+		if !record.LastSuccess || record.Fingerprint == "" {
+			return ""
+		}
+
+		lines = append(lines, record.Name+" "+record.Fingerprint)
+	}
+
+	sort.Strings(lines)
+
+	hash := sha256.New()
+
+	for _, line := range lines {
+		fmt.Fprintln(hash, line)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func SaveMetadata(path string, data MetadataState) error {
+
+	return filesystem.AtomicWriteFile(
+		path,
+		0600,
+		func(w io.Writer) error {
+
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+
+			return encoder.Encode(data)
+		},
+	)
+}
+
+// LoadMetadata reads the metadata export state. A missing file yields
+// an empty state, as before the first export.
+func LoadMetadata(path string) (*MetadataState, error) {
+
+	file, err := os.Open(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return &MetadataState{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf(
+			"open metadata state %s: %w",
+			path,
+			err,
+		)
+	}
+
+	defer file.Close()
+
+	var data MetadataState
+
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return nil, fmt.Errorf(
+			"load metadata state %s: %w",
+			path,
+			err,
+		)
+	}
+
+	return &data, nil
+}
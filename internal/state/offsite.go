@@ -0,0 +1,89 @@
+// internal/state/offsite.go
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/flarexes/gitback/internal/filesystem"
+)
+
+// OffsiteTarget records upload results for one offsite target.
+type OffsiteTarget struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	LastAttemptAt string `json:"last_attempt_at"`
+
+	// LastSnapshot and LastSuccessAt describe the newest snapshot
+	// that reached the target; they survive later failed attempts.
+	LastSnapshot  string `json:"last_snapshot,omitempty"`
+	LastSuccessAt string `json:"last_success_at,omitempty"`
+
+	// LastError is set when the most recent attempt failed.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// OffsiteState records the upload history of every configured target.
+type OffsiteState struct {
+	GeneratedAt string          `json:"generated_at"`
+	Targets     []OffsiteTarget `json:"targets"`
+}
+
+// Target returns the entry for name, or nil.
+func (s *OffsiteState) Target(name string) *OffsiteTarget {
+
+	for i := range s.Targets {
+
+		if s.Targets[i].Name == name {
+			return &s.Targets[i]
+		}
+	}
+
+	return nil
+}
+
+func SaveOffsite(path string, data OffsiteState) error {
+
+	return filesystem.AtomicWriteFile(
+		path,
+		0600,
+		func(w io.Writer) error {
+
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+
+			return encoder.Encode(data)
+		},
+	)
+}
+
+func LoadOffsite(path string) (*OffsiteState, error) {
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf(
+			"open offsite state %s: %w",
+			path,
+			err,
+		)
+	}
+
+	defer file.Close()
+
+	var data OffsiteState
+
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return nil, fmt.Errorf(
+			"load offsite state %s: %w",
+			path,
+			err,
+		)
+	}
+
+	return &data, nil
+}
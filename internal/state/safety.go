@@ -0,0 +1,81 @@
+// internal/state/safety.go
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/flarexes/gitback/internal/filesystem"
+)
+
+// SafetyState records the alert raised when a sync removed or rewrote
+// more than the safety thresholds allow. It stays active, suspending
+// pruning and snapshot retention, until acknowledged.
+type SafetyState struct {
+	RaisedAt string   `json:"raised_at,omitempty"`
+	Reasons  []string `json:"reasons,omitempty"`
+
+	// RemovedRepositories are inventory entries that disappeared;
+	// RewrittenRefs are "<repo> <ref>" pairs deleted or force-updated.
+	RemovedRepositories []string `json:"removed_repositories,omitempty"`
+	RewrittenRefs       []string `json:"rewritten_refs,omitempty"`
+
+	AcknowledgedAt string `json:"acknowledged_at,omitempty"`
+}
+
+// Active reports whether an alert is raised and not yet acknowledged.
+func (s *SafetyState) Active() bool {
+	return s.RaisedAt != "" && s.AcknowledgedAt == ""
+}
+
+func SaveSafety(path string, data SafetyState) error {
+
+	return filesystem.AtomicWriteFile(
+		path,
+		0600,
+		func(w io.Writer) error {
+
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+
+			return encoder.Encode(data)
+		},
+	)
+}
+
+// LoadSafety reads the safety state. A missing file means no alert was
+// ever raised and yields an empty state.
+func LoadSafety(path string) (*SafetyState, error) {
+
+	file, err := os.Open(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return &SafetyState{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf(
+			"open safety state %s: %w",
+			path,
+			err,
+		)
+	}
+
+	defer file.Close()
+
+	var data SafetyState
+
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return nil, fmt.Errorf(
+			"load safety state %s: %w",
+			path,
+			err,
+		)
+	}
+
+	return &data, nil
+}
@@ -16,8 +16,12 @@ func SaveMirrors(
 	path string,
 	syncStartedAt time.Time,
 	syncCompletedAt time.Time,
+	lastChangeAt time.Time,
 	repositories []Asset,
 	gists []Asset,
+	wikis []Asset,
+	releases []Asset,
+	starred []Asset,
 ) error {
 
 	data := MirrorState{
@@ -33,8 +37,15 @@ func SaveMirrors(
 			UTC().
 			Format(time.RFC3339),
 
+		LastChangeAt: lastChangeAt.
+			UTC().
+			Format(time.RFC3339),
+
 		Repositories: repositories,
 		Gists:        gists,
+		Wikis:        wikis,
+		Releases:     releases,
+		Starred:      starred,
 	}
 
 	return filesystem.AtomicWriteFile(
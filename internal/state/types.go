@@ -3,9 +3,34 @@
 package state
 
 type Asset struct {
-	Name        string `json:"name"`
+	Name string `json:"name"`
+
+	// ID is GitHub's numeric repository ID, which survives renames and
+	// transfers. Zero for gists, wikis, starred repositories and
+	// repositories recorded before IDs were tracked.
+	ID int64 `json:"id,omitempty"`
+
 	LastSuccess bool   `json:"last_success"`
 	Error       string `json:"error,omitempty"`
+
+	// Empty marks an asset that exists on GitHub but has no content to
+	// mirror, such as a wiki that is enabled but has no pages.
+	Empty bool `json:"empty,omitempty"`
+
+	// Fingerprint summarizes the mirror's refs after the last sync;
+	// it changes whenever any ref does. For a release file it is the
+	// SHA-256 of its content.
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// LFSObjects and LFSBytes count the Git LFS objects stored in the
+	// mirror after the last sync.
+	LFSObjects int   `json:"lfs_objects,omitempty"`
+	LFSBytes   int64 `json:"lfs_bytes,omitempty"`
+
+	// Description and Metadata are only set for gists: the gist's
+	// description, and the SHA-256 of its metadata file.
+	Description string `json:"description,omitempty"`
+	Metadata    string `json:"metadata,omitempty"`
 }
 
 type MirrorState struct {
@@ -13,6 +38,18 @@ type MirrorState struct {
 	SyncStartedAt   string `json:"sync_started_at,omitempty"`
 	SyncCompletedAt string `json:"sync_completed_at,omitempty"`
 
+	// LastChangeAt is when a sync last found any mirror changed.
+	LastChangeAt string `json:"last_change_at,omitempty"`
+
 	Repositories []Asset `json:"repositories"`
 	Gists        []Asset `json:"gists"`
+	Wikis        []Asset `json:"wikis,omitempty"`
+
+	// Starred lists the third-party repositories the account starred.
+	Starred []Asset `json:"starred,omitempty"`
+
+	// Releases lists downloaded release files by their path relative
+	// to the mirror root, and repositories whose releases couldn't be
+	// listed by their releases directory.
+	Releases []Asset `json:"releases,omitempty"`
 }
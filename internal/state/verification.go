@@ -0,0 +1,94 @@
+// internal/state/verification.go
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/flarexes/gitback/internal/filesystem"
+)
+
+// SnapshotVerification is the outcome of verifying a single snapshot.
+type SnapshotVerification struct {
+	Snapshot   string `json:"snapshot"`
+	VerifiedAt string `json:"verified_at"`
+	Success    bool   `json:"success"`
+
+	ChecksumValid  bool `json:"checksum_valid"`
+	Signed         bool `json:"signed"`
+	SignatureValid bool `json:"signature_valid"`
+	ArchiveValid   bool `json:"archive_valid"`
+
+	// KeyPinned is set when the signature was checked against the key
+	// pinned in config. Otherwise it was checked against this host's
+	// own key, which proves integrity but not who made the snapshot.
+	KeyPinned bool `json:"key_pinned"`
+
+	Mirrors    int      `json:"mirrors"`
+	FsckFailed []string `json:"fsck_failed,omitempty"`
+
+	// Missing lists mirrors recorded as synced in the embedded
+	// mirrors.json that are absent from the archive. Unexpected lists
+	// archived mirrors that mirrors.json doesn't mention.
+	Missing    []string `json:"missing,omitempty"`
+	Unexpected []string `json:"unexpected,omitempty"`
+
+	// MissingReleases and CorruptReleases list release files recorded
+	// as downloaded in mirrors.json that are absent from the archive or
+	// no longer match the SHA-256 recorded for them.
+	MissingReleases []string `json:"missing_releases,omitempty"`
+	CorruptReleases []string `json:"corrupt_releases,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// VerificationState records the most recent `gitback verify` run.
+type VerificationState struct {
+	GeneratedAt string                 `json:"generated_at"`
+	Snapshots   []SnapshotVerification `json:"snapshots"`
+}
+
+func SaveVerification(path string, data VerificationState) error {
+
+	return filesystem.AtomicWriteFile(
+		path,
+		0600,
+		func(w io.Writer) error {
+
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+
+			return encoder.Encode(data)
+		},
+	)
+}
+
+func LoadVerification(path string) (*VerificationState, error) {
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf(
+			"open verification state %s: %w",
+			path,
+			err,
+		)
+	}
+
+	defer file.Close()
+
+	var data VerificationState
+
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return nil, fmt.Errorf(
+			"load verification state %s: %w",
+			path,
+			err,
+		)
+	}
+
+	return &data, nil
+}
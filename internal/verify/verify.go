@@ -0,0 +1,450 @@
+// internal/verify/verify.go
+// Package verify checks snapshots end to end: checksum, archive
+// integrity, mirror integrity, and agreement with the embedded state,
+// down to the content of downloaded release files.
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarexes/gitback/internal/config"
+	"github.com/flarexes/gitback/internal/logging"
+	"github.com/flarexes/gitback/internal/mirror"
+	"github.com/flarexes/gitback/internal/release"
+	"github.com/flarexes/gitback/internal/runtime"
+	"github.com/flarexes/gitback/internal/signing"
+	"github.com/flarexes/gitback/internal/snapshot"
+	"github.com/flarexes/gitback/internal/state"
+)
+
+type Engine struct {
+	cfg    *config.Config
+	layout runtime.Layout
+	logger *logging.Logger
+}
+
+func New(cfg *config.Config, layout runtime.Layout, logger *logging.Logger) *Engine {
+	return &Engine{
+		cfg:    cfg,
+		layout: layout,
+		logger: logger,
+	}
+}
+
+// Run verifies every given snapshot path, records the results in the
+// verification state file for `gitback health`, and returns them.
+func (e *Engine) Run(ctx context.Context, archives []string) ([]state.SnapshotVerification, error) {
+
+	start := time.Now()
+
+	var results []state.SnapshotVerification
+
+	for _, archive := range archives {
+
+		result := e.Verify(ctx, archive)
+
+		// An interrupted run says nothing about the snapshots, so
+		// don't record partial results as failures.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	if err := state.SaveVerification(
+		e.layout.VerificationStateFile,
+		state.VerificationState{
+			GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+			Snapshots:   results,
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	failed := 0
+
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level:      logging.Info,
+			Event:      logging.Events.Verify.Summary,
+			DurationMS: time.Since(start).Milliseconds(),
+
+			Details: map[string]any{
+				"snapshots": len(results),
+				"passed":    len(results) - failed,
+				"failed":    failed,
+			},
+		},
+	)
+
+	return results, nil
+}
+
+// Verify runs every check against a single snapshot. Checks stop at the
+// first stage that makes later stages meaningless (a bad checksum or an
+// unreadable archive), otherwise every problem found is reported.
+func (e *Engine) Verify(ctx context.Context, archive string) state.SnapshotVerification {
+
+	name := filepath.Base(archive)
+
+	result := state.SnapshotVerification{
+		Snapshot:   name,
+		VerifiedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Verify.Started,
+
+			Details: map[string]any{
+				"snapshot": name,
+			},
+		},
+	)
+
+	if err := e.verify(ctx, archive, &result); err != nil {
+		result.Error = err.Error()
+	}
+
+	result.Success = result.Error == "" &&
+		len(result.FsckFailed) == 0 &&
+		len(result.Missing) == 0 &&
+		len(result.MissingReleases) == 0 &&
+		len(result.CorruptReleases) == 0
+
+	if !result.Success {
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Error,
+				Event: logging.Events.Verify.Failed,
+				Error: result.Error,
+
+				Details: map[string]any{
+					"result": result,
+				},
+			},
+		)
+
+		return result
+	}
+
+	e.logger.Emit(
+		logging.Entry{
+			Level: logging.Info,
+			Event: logging.Events.Verify.Completed,
+
+			Details: map[string]any{
+				"result": result,
+			},
+		},
+	)
+
+	return result
+}
+
+func (e *Engine) verify(ctx context.Context, archive string, result *state.SnapshotVerification) error {
+
+	// Checksum, of every snapshot an incremental snapshot builds on too
+	chain, err := snapshot.Chain(archive)
+	if err != nil {
+
+		e.logger.Error(
+			logging.Events.Verify.ArchiveFailed,
+			"",
+			err,
+		)
+
+		return err
+	}
+
+	for _, step := range chain {
+
+		if err := snapshot.VerifyChecksum(step); err != nil {
+
+			e.logger.Error(
+				logging.Events.Verify.ChecksumFailed,
+				"",
+				err,
+			)
+
+			return err
+		}
+	}
+
+	result.ChecksumValid = true
+
+	// Signed manifest
+	if err := e.verifySignature(archive, result); err != nil {
+
+		e.logger.Error(
+			logging.Events.Verify.SignatureFailed,
+			"",
+			err,
+		)
+
+		return err
+	}
+
+	// Decompression and extraction into a scratch directory. Extracting
+	// everything proves the whole stream decompresses and gives fsck a
+	// real repository to work with. Incremental snapshots are replayed
+	// onto their chain, which also proves every bundle applies.
+	scratch, err := os.MkdirTemp(e.layout.TempDir, "verify-*")
+	if err != nil {
+		return fmt.Errorf("create scratch directory: %w", err)
+	}
+
+	defer os.RemoveAll(scratch)
+
+	if err := snapshot.Materialize(ctx, e.cfg, archive, scratch, nil); err != nil {
+
+		e.logger.Error(
+			logging.Events.Verify.ArchiveFailed,
+			"",
+			err,
+		)
+
+		return err
+	}
+
+	result.ArchiveValid = true
+
+	mirrorRoot, err := findMirrorRoot(scratch)
+	if err != nil {
+		return err
+	}
+
+	archived, err := mirror.Find(mirrorRoot)
+	if err != nil {
+		return fmt.Errorf("list archived mirrors: %w", err)
+	}
+
+	result.Mirrors = len(archived)
+
+	// Mirror integrity
+	for _, relative := range archived {
+
+		if err := fsck(ctx, filepath.Join(mirrorRoot, relative)); err != nil {
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			e.logger.Error(
+				logging.Events.Verify.FsckFailed,
+				relative,
+				err,
+			)
+
+			result.FsckFailed = append(result.FsckFailed, relative)
+		}
+	}
+
+	// Embedded state
+	data, err := state.LoadMirrors(filepath.Join(scratch, "mirrors.json"))
+	if err != nil {
+		return err
+	}
+
+	e.compareState(data, archived, result)
+
+	return e.compareReleases(data, mirrorRoot, result)
+}
+
+// verifySignature checks the snapshot's signed manifest. Snapshots
+// without a manifest predate signing and pass unless a public key is
+// pinned in config, in which case every snapshot must be signed by it.
+func (e *Engine) verifySignature(archive string, result *state.SnapshotVerification) error {
+
+	pinned := e.cfg.Snapshot.Signing.PublicKey != ""
+
+	if _, err := os.Stat(archive + snapshot.ManifestSuffix); errors.Is(err, os.ErrNotExist) {
+
+		if pinned {
+			return errors.New("snapshot has no signed manifest")
+		}
+
+		return nil
+	}
+
+	result.Signed = true
+
+	key, err := signing.PublicKey(e.cfg.Snapshot.Signing.PublicKey, e.layout)
+	if err != nil {
+		return err
+	}
+
+	if _, err := snapshot.VerifyManifest(archive, key); err != nil {
+		return err
+	}
+
+	result.SignatureValid = true
+	result.KeyPinned = pinned
+
+	return nil
+}
+
+// compareState checks the archived mirrors against the mirror state
+// embedded in the snapshot.
+func (e *Engine) compareState(data *state.MirrorState, archived []string, result *state.SnapshotVerification) {
+
+	expected := mirror.ExpectedMirrors(data)
+
+	present := make(map[string]struct{}, len(archived))
+
+	for _, relative := range archived {
+
+		present[relative] = struct{}{}
+
+		// Mirrors of removed repositories are archived on purpose and
+		// never appear in the mirror state.
+		if mirror.IsArchived(relative) {
+			continue
+		}
+
+		if _, ok := expected[relative]; !ok {
+			result.Unexpected = append(result.Unexpected, relative)
+		}
+	}
+
+	for relative, name := range expected {
+
+		if _, ok := present[relative]; !ok {
+			result.Missing = append(result.Missing, name)
+		}
+	}
+
+	sort.Strings(result.Missing)
+
+	if len(result.Missing) > 0 || len(result.Unexpected) > 0 {
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Warn,
+				Event: logging.Events.Verify.ManifestMismatch,
+
+				Details: map[string]any{
+					"snapshot":   result.Snapshot,
+					"missing":    result.Missing,
+					"unexpected": result.Unexpected,
+				},
+			},
+		)
+	}
+}
+
+// compareReleases checks every release file the embedded mirror state
+// records as downloaded: it has to be in the archive, with the content
+// the sync hashed.
+func (e *Engine) compareReleases(data *state.MirrorState, mirrorRoot string, result *state.SnapshotVerification) error {
+
+	for _, asset := range data.Releases {
+
+		if !asset.LastSuccess || asset.Fingerprint == "" {
+			continue
+		}
+
+		sum, _, err := release.HashFile(filepath.Join(mirrorRoot, filepath.FromSlash(asset.Name)))
+
+		if errors.Is(err, os.ErrNotExist) {
+			result.MissingReleases = append(result.MissingReleases, asset.Name)
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("hash release file %s: %w", asset.Name, err)
+		}
+
+		if sum != asset.Fingerprint {
+			result.CorruptReleases = append(result.CorruptReleases, asset.Name)
+		}
+	}
+
+	if len(result.MissingReleases) > 0 || len(result.CorruptReleases) > 0 {
+
+		e.logger.Emit(
+			logging.Entry{
+				Level: logging.Warn,
+				Event: logging.Events.Verify.ReleaseMismatch,
+
+				Details: map[string]any{
+					"snapshot": result.Snapshot,
+					"missing":  result.MissingReleases,
+					"corrupt":  result.CorruptReleases,
+				},
+			},
+		)
+	}
+
+	return nil
+}
+
+// findMirrorRoot returns the single top-level directory of an extracted
+// snapshot. Its name is the base name of the mirror root on the host
+// that created the snapshot, so it can't be assumed.
+func findMirrorRoot(scratch string) (string, error) {
+
+	entries, err := os.ReadDir(scratch)
+	if err != nil {
+		return "", err
+	}
+
+	var dirs []string
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+
+	if len(dirs) != 1 {
+		return "", fmt.Errorf(
+			"expected one mirror directory in snapshot, found %d",
+			len(dirs),
+		)
+	}
+
+	return filepath.Join(scratch, dirs[0]), nil
+}
+
+func fsck(ctx context.Context, target string) error {
+
+	output, err := exec.CommandContext(
+		ctx,
+		"git",
+		"-C",
+		target,
+		"fsck",
+		"--no-dangling",
+	).CombinedOutput()
+
+	if err != nil {
+
+		msg := strings.TrimSpace(string(output))
+
+		if msg == "" {
+			msg = err.Error()
+		}
+
+		return errors.New(msg)
+	}
+
+	return nil
+}